@@ -51,6 +51,11 @@ func validateConfig(config *Config) error {
 			return fmt.Errorf("invalid QUIC version: %s", v)
 		}
 	}
+	switch config.CongestionControl {
+	case 0, CongestionControlNewReno, CongestionControlCubic:
+	default:
+		return fmt.Errorf("invalid congestion control algorithm: %d", uint8(config.CongestionControl))
+	}
 	return nil
 }
 
@@ -104,6 +109,10 @@ func populateConfig(config *Config) *Config {
 	if initialPacketSize == 0 {
 		initialPacketSize = protocol.InitialPacketSize
 	}
+	congestionControl := config.CongestionControl
+	if congestionControl == 0 {
+		congestionControl = CongestionControlNewReno
+	}
 
 	return &Config{
 		GetConfigForClient:             config.GetConfigForClient,
@@ -121,6 +130,7 @@ func populateConfig(config *Config) *Config {
 		TokenStore:                     config.TokenStore,
 		EnableDatagrams:                config.EnableDatagrams,
 		InitialPacketSize:              initialPacketSize,
+		CongestionControl:              congestionControl,
 		DisablePathMTUDiscovery:        config.DisablePathMTUDiscovery,
 		Allow0RTT:                      config.Allow0RTT,
 		Tracer:                         config.Tracer,
@@ -68,6 +68,12 @@ var _ = Describe("Config", func() {
 			Expect(validateConfig(conf)).To(Succeed())
 			Expect(conf.InitialPacketSize).To(BeZero())
 		})
+
+		It("validates the congestion control algorithm", func() {
+			Expect(validateConfig(&Config{CongestionControl: CongestionControlNewReno})).To(Succeed())
+			Expect(validateConfig(&Config{CongestionControl: CongestionControlCubic})).To(Succeed())
+			Expect(validateConfig(&Config{CongestionControl: CongestionControlAlgorithm(7)})).To(MatchError("invalid congestion control algorithm: 7"))
+		})
 	})
 
 	configWithNonZeroNonFunctionFields := func() *Config {
@@ -119,6 +125,8 @@ var _ = Describe("Config", func() {
 				f.Set(reflect.ValueOf(true))
 			case "InitialPacketSize":
 				f.Set(reflect.ValueOf(uint16(1350)))
+			case "CongestionControl":
+				f.Set(reflect.ValueOf(CongestionControlCubic))
 			case "DisablePathMTUDiscovery":
 				f.Set(reflect.ValueOf(true))
 			case "Allow0RTT":
@@ -186,6 +194,7 @@ var _ = Describe("Config", func() {
 			Expect(c.MaxIncomingStreams).To(BeEquivalentTo(protocol.DefaultMaxIncomingStreams))
 			Expect(c.MaxIncomingUniStreams).To(BeEquivalentTo(protocol.DefaultMaxIncomingUniStreams))
 			Expect(c.DisablePathMTUDiscovery).To(BeFalse())
+			Expect(c.CongestionControl).To(Equal(CongestionControlNewReno))
 			Expect(c.GetConfigForClient).To(BeNil())
 		})
 	})
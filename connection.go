@@ -185,6 +185,9 @@ type connection struct {
 	creationTime time.Time
 	// The idle timeout is set based on the max of the time we received the last packet...
 	lastPacketReceivedTime time.Time
+	// lastPacketReceivedNanos mirrors lastPacketReceivedTime, as Unix nanoseconds.
+	// It is read by ConnectionStats, which may be called from a different go routine.
+	lastPacketReceivedNanos atomic.Int64
 	// ... and the time we sent a new ack-eliciting packet after receiving a packet.
 	firstAckElicitingPacketAfterIdleSentTime time.Time
 	// pacingDeadline is the time when the next packet should be sent
@@ -197,6 +200,8 @@ type connection struct {
 	// It is reset as soon as we receive a packet from the peer.
 	keepAlivePingSent bool
 	keepAliveInterval time.Duration
+	// keepAlivePingsSent counts the keep-alive PINGs sent on this connection.
+	keepAlivePingsSent atomic.Uint64
 
 	datagramQueue *datagramQueue
 
@@ -277,6 +282,7 @@ var newConnection = func(
 		s.rttStats,
 		clientAddressValidated,
 		s.conn.capabilities().ECN,
+		s.config.CongestionControl != CongestionControlCubic,
 		s.perspective,
 		s.tracer,
 		s.logger,
@@ -387,6 +393,7 @@ var newClientConnection = func(
 		s.rttStats,
 		false, // has no effect
 		s.conn.capabilities().ECN,
+		s.config.CongestionControl != CongestionControlCubic,
 		s.perspective,
 		s.tracer,
 		s.logger,
@@ -485,10 +492,12 @@ func (s *connection) preSetup() {
 
 	now := time.Now()
 	s.lastPacketReceivedTime = now
+	s.lastPacketReceivedNanos.Store(now.UnixNano())
 	s.creationTime = now
 
 	s.datagramQueue = newDatagramQueue(s.scheduleSending, s.logger)
 	s.connState.Version = s.version
+	s.connState.CongestionControl = s.config.CongestionControl
 }
 
 // run the connection main loop
@@ -612,6 +621,7 @@ runLoop:
 			s.logger.Debugf("Sending a keep-alive PING to keep the connection alive.")
 			s.framer.QueueControlFrame(&wire.PingFrame{})
 			s.keepAlivePingSent = true
+			s.keepAlivePingsSent.Add(1)
 		} else if !s.handshakeComplete && now.Sub(s.creationTime) >= s.config.handshakeTimeout() {
 			s.destroyImpl(qerr.ErrHandshakeTimeout)
 			continue
@@ -680,6 +690,19 @@ func (s *connection) ConnectionState() ConnectionState {
 	return s.connState
 }
 
+func (s *connection) ConnectionStats() ConnectionStats {
+	stats := s.sentPacketHandler.ConnectionStats()
+	return ConnectionStats{
+		MinRTT:             stats.MinRTT,
+		LatestRTT:          stats.LatestRTT,
+		SmoothedRTT:        stats.SmoothedRTT,
+		MeanDeviation:      stats.MeanDeviation,
+		CongestionWindow:   uint64(stats.CongestionWindow),
+		KeepAlivePingsSent: s.keepAlivePingsSent.Load(),
+		IdleTime:           time.Since(time.Unix(0, s.lastPacketReceivedNanos.Load())),
+	}
+}
+
 // Time when the connection should time out
 func (s *connection) nextIdleTimeoutTime() time.Time {
 	idleTimeout := max(s.idleTimeout, s.rttStats.PTO(true)*3)
@@ -1201,6 +1224,7 @@ func (s *connection) handleUnpackedLongHeaderPacket(
 	}
 
 	s.lastPacketReceivedTime = rcvTime
+	s.lastPacketReceivedNanos.Store(rcvTime.UnixNano())
 	s.firstAckElicitingPacketAfterIdleSentTime = time.Time{}
 	s.keepAlivePingSent = false
 
@@ -1226,6 +1250,7 @@ func (s *connection) handleUnpackedShortHeaderPacket(
 	log func([]logging.Frame),
 ) error {
 	s.lastPacketReceivedTime = rcvTime
+	s.lastPacketReceivedNanos.Store(rcvTime.UnixNano())
 	s.firstAckElicitingPacketAfterIdleSentTime = time.Time{}
 	s.keepAlivePingSent = false
 
@@ -2274,8 +2299,31 @@ func (s *connection) onMTUIncreased(mtu protocol.ByteCount) {
 }
 
 func (s *connection) SendDatagram(p []byte) error {
+	f, err := s.newDatagramFrame(p)
+	if err != nil {
+		return err
+	}
+	return s.datagramQueue.Add(f)
+}
+
+func (s *connection) TrySendDatagram(p []byte) error {
+	f, err := s.newDatagramFrame(p)
+	if err != nil {
+		return err
+	}
+	if !s.datagramQueue.TryAdd(f) {
+		return ErrDatagramQueueFull
+	}
+	return nil
+}
+
+func (s *connection) DatagramQueueLen() int {
+	return s.datagramQueue.SendQueueLen()
+}
+
+func (s *connection) newDatagramFrame(p []byte) (*wire.DatagramFrame, error) {
 	if !s.supportsDatagrams() {
-		return errors.New("datagram support disabled")
+		return nil, errors.New("datagram support disabled")
 	}
 
 	f := &wire.DatagramFrame{DataLenPresent: true}
@@ -2286,11 +2334,11 @@ func (s *connection) SendDatagram(p []byte) error {
 		protocol.ByteCount(s.maxPayloadSizeEstimate.Load()),
 	)
 	if protocol.ByteCount(len(p)) > maxDataLen {
-		return &DatagramTooLargeError{MaxDatagramPayloadSize: int64(maxDataLen)}
+		return nil, &DatagramTooLargeError{MaxDatagramPayloadSize: int64(maxDataLen)}
 	}
 	f.Data = make([]byte, len(p))
 	copy(f.Data, p)
-	return s.datagramQueue.Add(f)
+	return f, nil
 }
 
 func (s *connection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
@@ -2300,6 +2348,46 @@ func (s *connection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
 	return s.datagramQueue.Receive(ctx)
 }
 
+func (s *connection) Ping(ctx context.Context) (time.Duration, error) {
+	h := &pingAckHandler{framer: s.framer, acked: make(chan struct{})}
+	start := time.Now()
+	s.framer.QueuePing(h)
+	s.scheduleSending()
+	select {
+	case <-h.acked:
+		return time.Since(start), nil
+	case <-s.ctx.Done():
+		return 0, context.Cause(s.ctx)
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// pingAckHandler handles acknowledgements and losses of PING frames sent by Ping.
+type pingAckHandler struct {
+	framer *framer
+	acked  chan struct{}
+}
+
+var _ ackhandler.FrameHandler = &pingAckHandler{}
+
+func (h *pingAckHandler) OnAcked(wire.Frame) {
+	// If the PING frame was declared lost, both the original and the retransmission might be acknowledged.
+	select {
+	case <-h.acked:
+	default:
+		close(h.acked)
+	}
+}
+
+func (h *pingAckHandler) OnLost(wire.Frame) {
+	select {
+	case <-h.acked:
+	default:
+		h.framer.QueuePing(h)
+	}
+}
+
 func (s *connection) LocalAddr() net.Addr {
 	return s.conn.LocalAddr()
 }
@@ -2165,6 +2165,23 @@ var _ = Describe("Connection", func() {
 			Eventually(sent).Should(BeClosed())
 		})
 
+		It("counts the keep-alive PINGs", func() {
+			setRemoteIdleTimeout(5 * time.Second)
+			conn.lastPacketReceivedTime = time.Now().Add(-5 * time.Second / 2)
+			conn.lastPacketReceivedNanos.Store(conn.lastPacketReceivedTime.UnixNano())
+			Expect(conn.ConnectionStats().KeepAlivePingsSent).To(BeZero())
+			sent := make(chan struct{})
+			packer.EXPECT().PackCoalescedPacket(false, gomock.Any(), conn.version).Do(func(bool, protocol.ByteCount, protocol.Version) (*coalescedPacket, error) {
+				close(sent)
+				return nil, nil
+			})
+			runConn()
+			Eventually(sent).Should(BeClosed())
+			stats := conn.ConnectionStats()
+			Expect(stats.KeepAlivePingsSent).To(BeEquivalentTo(1))
+			Expect(stats.IdleTime).To(BeNumerically(">=", 5*time.Second/2))
+		})
+
 		It("sends a PING after a maximum of protocol.MaxKeepAliveInterval", func() {
 			conn.config.MaxIdleTimeout = time.Hour
 			setRemoteIdleTimeout(time.Hour)
@@ -2510,6 +2527,24 @@ var _ = Describe("Connection", func() {
 			Expect(conn.SendDatagram(make([]byte, derr.MaxDatagramPayloadSize))).To(Succeed())
 		})
 
+		It("drops datagrams when the send queue is full", func() {
+			conn.peerParams = &wire.TransportParameters{MaxDatagramFrameSize: 1000}
+			for i := 0; i < maxDatagramSendQueueLen; i++ {
+				Expect(conn.TrySendDatagram([]byte("foobar"))).To(Succeed())
+				Expect(conn.DatagramQueueLen()).To(Equal(i + 1))
+			}
+			Expect(conn.TrySendDatagram([]byte("foobar"))).To(MatchError(ErrDatagramQueueFull))
+			Expect(conn.DatagramQueueLen()).To(Equal(maxDatagramSendQueueLen))
+			conn.datagramQueue.Pop()
+			Expect(conn.DatagramQueueLen()).To(Equal(maxDatagramSendQueueLen - 1))
+			Expect(conn.TrySendDatagram([]byte("foobar"))).To(Succeed())
+		})
+
+		It("doesn't try to send datagrams if the peer didn't enable support", func() {
+			conn.peerParams = &wire.TransportParameters{MaxDatagramFrameSize: 0}
+			Expect(conn.TrySendDatagram(make([]byte, 200))).To(MatchError("datagram support disabled"))
+		})
+
 		It("receives datagrams", func() {
 			conn.config.EnableDatagrams = true
 			conn.datagramQueue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("foobar")})
@@ -68,6 +68,27 @@ func (h *datagramQueue) Add(f *wire.DatagramFrame) error {
 	}
 }
 
+// TryAdd queues a new DATAGRAM frame for sending, unless the queue is full.
+// It returns false if the frame was not queued.
+func (h *datagramQueue) TryAdd(f *wire.DatagramFrame) bool {
+	h.sendMx.Lock()
+	if h.sendQueue.Len() >= maxDatagramSendQueueLen {
+		h.sendMx.Unlock()
+		return false
+	}
+	h.sendQueue.PushBack(f)
+	h.sendMx.Unlock()
+	h.hasData()
+	return true
+}
+
+// SendQueueLen returns the number of DATAGRAM frames queued for sending.
+func (h *datagramQueue) SendQueueLen() int {
+	h.sendMx.Lock()
+	defer h.sendMx.Unlock()
+	return h.sendQueue.Len()
+}
+
 // Peek gets the next DATAGRAM frame for sending.
 // If actually sent out, Pop needs to be called before the next call to Peek.
 func (h *datagramQueue) Peek() *wire.DatagramFrame {
@@ -58,6 +58,18 @@ var _ = Describe("Datagram Queue", func() {
 			Expect(f.Data).To(Equal([]byte("foobar")))
 		})
 
+		It("doesn't block when trying to add a datagram to a full queue", func() {
+			for i := 0; i < maxDatagramSendQueueLen; i++ {
+				Expect(queue.TryAdd(&wire.DatagramFrame{Data: []byte{0}})).To(BeTrue())
+			}
+			Expect(queue.SendQueueLen()).To(Equal(maxDatagramSendQueueLen))
+			Expect(queue.TryAdd(&wire.DatagramFrame{Data: []byte("foobar")})).To(BeFalse())
+			Expect(queue.SendQueueLen()).To(Equal(maxDatagramSendQueueLen))
+			queue.Pop()
+			Expect(queue.SendQueueLen()).To(Equal(maxDatagramSendQueueLen - 1))
+			Expect(queue.TryAdd(&wire.DatagramFrame{Data: []byte("foobar")})).To(BeTrue())
+		})
+
 		It("returns the same datagram multiple times, when Pop isn't called", func() {
 			Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foo")})).To(Succeed())
 			Expect(queue.Add(&wire.DatagramFrame{Data: []byte("bar")})).To(Succeed())
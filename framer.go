@@ -34,6 +34,7 @@ type framer struct {
 	controlFrameMutex          sync.Mutex
 	controlFrames              []wire.Frame
 	pathResponses              []*wire.PathResponseFrame
+	pings                      []ackhandler.FrameHandler
 	queuedTooManyControlFrames bool
 }
 
@@ -53,7 +54,16 @@ func (f *framer) HasData() bool {
 	}
 	f.controlFrameMutex.Lock()
 	defer f.controlFrameMutex.Unlock()
-	return len(f.streamsWithControlFrames) > 0 || len(f.controlFrames) > 0 || len(f.pathResponses) > 0
+	return len(f.streamsWithControlFrames) > 0 || len(f.controlFrames) > 0 || len(f.pathResponses) > 0 || len(f.pings) > 0
+}
+
+// QueuePing queues a PING frame.
+// The handler is notified when the PING frame is acknowledged or declared lost.
+func (f *framer) QueuePing(h ackhandler.FrameHandler) {
+	f.controlFrameMutex.Lock()
+	defer f.controlFrameMutex.Unlock()
+
+	f.pings = append(f.pings, h)
 }
 
 func (f *framer) QueueControlFrame(frame wire.Frame) {
@@ -94,6 +104,18 @@ func (f *framer) AppendControlFrames(frames []ackhandler.Frame, maxLen protocol.
 		}
 	}
 
+	// add PING frames that need to be tracked
+	for len(f.pings) > 0 {
+		frame := &wire.PingFrame{}
+		frameLen := frame.Length(v)
+		if length+frameLen > maxLen {
+			break
+		}
+		frames = append(frames, ackhandler.Frame{Frame: frame, Handler: f.pings[0]})
+		length += frameLen
+		f.pings = f.pings[1:]
+	}
+
 	// add stream-related control frames
 	for id, str := range f.streamsWithControlFrames {
 	start:
@@ -156,6 +156,40 @@ var _ = Describe("Framer", func() {
 		})
 	})
 
+	Context("handling tracked PING frames", func() {
+		It("adds PING frames with their handlers", func() {
+			Expect(framer.HasData()).To(BeFalse())
+			h1 := &pingAckHandler{framer: framer, acked: make(chan struct{})}
+			h2 := &pingAckHandler{framer: framer, acked: make(chan struct{})}
+			framer.QueuePing(h1)
+			framer.QueuePing(h2)
+			Expect(framer.HasData()).To(BeTrue())
+			frames, length := framer.AppendControlFrames(nil, 1, protocol.Version1)
+			Expect(frames).To(Equal([]ackhandler.Frame{{Frame: &wire.PingFrame{}, Handler: h1}}))
+			Expect(length).To(Equal(protocol.ByteCount(1)))
+			frames, _ = framer.AppendControlFrames(nil, 1000, protocol.Version1)
+			Expect(frames).To(Equal([]ackhandler.Frame{{Frame: &wire.PingFrame{}, Handler: h2}}))
+			Expect(framer.HasData()).To(BeFalse())
+		})
+
+		It("requeues lost PING frames, until they are acknowledged", func() {
+			h := &pingAckHandler{framer: framer, acked: make(chan struct{})}
+			framer.QueuePing(h)
+			frames, _ := framer.AppendControlFrames(nil, 1000, protocol.Version1)
+			Expect(frames).To(HaveLen(1))
+			frames[0].Handler.OnLost(frames[0].Frame)
+			frames, _ = framer.AppendControlFrames(nil, 1000, protocol.Version1)
+			Expect(frames).To(HaveLen(1))
+			Expect(h.acked).ToNot(BeClosed())
+			frames[0].Handler.OnAcked(frames[0].Frame)
+			Expect(h.acked).To(BeClosed())
+			// the original packet might still be acknowledged
+			frames[0].Handler.OnAcked(frames[0].Frame)
+			frames[0].Handler.OnLost(frames[0].Frame)
+			Expect(framer.HasData()).To(BeFalse())
+		})
+	})
+
 	Context("handling PATH_RESPONSE frames", func() {
 		It("packs a single PATH_RESPONSE per packet", func() {
 			f1 := &wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
@@ -1,11 +1,18 @@
 package http3
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/quic-go/quic-go"
+
+	"github.com/quic-go/qpack"
 )
 
 // A Hijacker allows hijacking of the stream creating part of a quic.Session from a http.Response.Body.
@@ -97,10 +104,42 @@ type hijackableBody struct {
 	// either when Read() errors, or when Close() is called.
 	reqDone       chan<- struct{}
 	reqDoneClosed bool
+
+	info responseInfo
+
+	// set for 2xx responses to CONNECT requests, which turn the request stream into a tunnel
+	isTunnel bool
+	// only set for CONNECT requests sent with RoundTripOpt.DontCloseRequestStream
+	requestStream io.WriteCloser
+	// only set for the http.Response, used to reprioritize the request, see ResponseController.SetPriority
+	updatePriority func(Priority) error
+	// set for responses to HEAD requests, which never have a body
+	// The Content-Length of these responses refers to the body of the corresponding GET response.
+	isHead bool
+	clock  clock
+
+	maxSize int64 // maximum size of the body, 0 means no limit
+	read    int64 // number of bytes read so far
+	err     error // sticky error, set when maxSize is exceeded
 }
 
 var _ io.ReadCloser = &hijackableBody{}
 
+// responseInfo is the metadata of a response received by the client.
+// It is exposed by functions like RequestTimings and ResponseProtocol.
+type responseInfo struct {
+	// only set if the raw header fields are preserved
+	rawHeaderFields []qpack.HeaderField
+	// set if the request was sent in 0-RTT, and the server accepted the 0-RTT data
+	served0RTT bool
+	// the Link header field values of the last 103 (Early Hints) response
+	earlyHintsLinks []string
+	// the :protocol pseudo header field, only set for 2xx responses to CONNECT requests
+	protocol string
+	// the timing breakdown of the request, see RequestTimings
+	timings Timings
+}
+
 func newResponseBody(str *stream, contentLength int64, done chan<- struct{}) *hijackableBody {
 	return &hijackableBody{
 		body:    *newBody(str, contentLength),
@@ -109,11 +148,149 @@ func newResponseBody(str *stream, contentLength int64, done chan<- struct{}) *hi
 }
 
 func (r *hijackableBody) Read(b []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.isHead {
+		// The server might not have sent the FIN yet.
+		// Stop reading, so the stream isn't tracked as active any more.
+		r.body.str.CancelRead(quic.StreamErrorCode(ErrCodeNoError))
+		r.requestDone()
+		r.bodyDone()
+		return 0, io.EOF
+	}
+	if r.maxSize > 0 {
+		// If the Content-Length already exceeds the limit, there's no need to read the body.
+		if r.body.hasContentLength && r.read+r.body.remainingContentLength > r.maxSize {
+			return 0, r.exceededMaxSize()
+		}
+		// Read at most one byte more than allowed, so we can detect when the limit is exceeded.
+		if remaining := r.maxSize - r.read + 1; int64(len(b)) > remaining {
+			b = b[:remaining]
+		}
+	}
 	n, err := r.body.Read(b)
-	if err != nil {
+	r.read += int64(n)
+	if r.maxSize > 0 && r.read > r.maxSize {
+		return n - int(r.read-r.maxSize), r.exceededMaxSize()
+	}
+	// Hitting the read deadline doesn't end the request, the application might continue reading.
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
 		r.requestDone()
 	}
-	return n, maybeReplaceError(err)
+	err = r.truncationError(maybeReplaceError(err))
+	if err == io.EOF {
+		r.bodyDone()
+	}
+	return n, err
+}
+
+func (r *hijackableBody) bodyDone() {
+	if r.info.timings.BodyDone.IsZero() && !r.info.timings.Headers.IsZero() {
+		r.info.timings.BodyDone = r.clock.Now()
+	}
+}
+
+// truncationError makes errors caused by a truncated body wrap io.ErrUnexpectedEOF,
+// allowing the application to distinguish them from the end of the body:
+// The stream might have been reset by the server, the connection might have been closed,
+// or the stream might have ended before the number of bytes announced in the Content-Length was received.
+func (r *hijackableBody) truncationError(err error) error {
+	if err == io.EOF {
+		if r.body.hasContentLength && r.body.remainingContentLength > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	var h3Err *Error
+	var connErr *ConnectionError
+	if (errors.As(err, &h3Err) && h3Err.Remote) || errors.As(err, &connErr) {
+		return fmt.Errorf("%w: %w", io.ErrUnexpectedEOF, err)
+	}
+	return err
+}
+
+func (r *hijackableBody) exceededMaxSize() error {
+	r.err = ErrResponseBodyTooLarge
+	r.body.str.CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+	r.requestDone()
+	return r.err
+}
+
+// SetReadDeadline sets the deadline for future Read calls and any currently-blocked Read call.
+// It is backed by the read deadline of the underlying QUIC stream.
+// If the deadline is exceeded, Read returns an error that satisfies the net.Error interface,
+// with Timeout() returning true.
+// A zero value for t means Read will not time out.
+func (r *hijackableBody) SetReadDeadline(t time.Time) error {
+	return r.body.str.SetReadDeadline(t)
+}
+
+// responseBodyOf returns the hijackableBody of a response received by this package.
+// It returns nil if the Body of the response was replaced.
+func responseBodyOf(rsp *http.Response) *hijackableBody {
+	switch b := rsp.Body.(type) {
+	case *hijackableBody:
+		return b
+	case *gzipReader:
+		return b.responseBody()
+	case *BufferedBody:
+		return responseBodyOf(&http.Response{Body: b.body})
+	case *resumableBody:
+		return responseBodyOf(&http.Response{Body: b.currentBody()})
+	}
+	return nil
+}
+
+// A BufferedBody is a response body that is read through a bufio.Reader.
+// It allows peeking at the body without consuming it, which is useful for protocols
+// that frame messages within the body (e.g. length-prefixed messages).
+// A BufferedBody is returned when RoundTripOpt.BufferedBodySize is set.
+type BufferedBody struct {
+	body io.ReadCloser
+	br   *bufio.Reader
+}
+
+var _ io.ReadCloser = &BufferedBody{}
+
+func newBufferedBody(body io.ReadCloser, size int) *BufferedBody {
+	return &BufferedBody{body: body, br: bufio.NewReaderSize(body, size)}
+}
+
+func (b *BufferedBody) Read(p []byte) (int, error) {
+	return b.br.Read(p)
+}
+
+// Peek returns the next n bytes of the body without consuming them.
+// The returned slice is only valid until the next call to Read, Peek or Discard.
+// If fewer than n bytes are returned, it also returns an error explaining why:
+// io.EOF if the end of the body was reached, or bufio.ErrBufferFull if n is larger
+// than the size of the buffer.
+func (b *BufferedBody) Peek(n int) ([]byte, error) {
+	return b.br.Peek(n)
+}
+
+// Discard skips the next n bytes of the body, returning the number of bytes discarded.
+func (b *BufferedBody) Discard(n int) (int, error) {
+	return b.br.Discard(n)
+}
+
+// Buffered returns the number of bytes that can be read from the buffer
+// without reading from the underlying stream.
+func (b *BufferedBody) Buffered() int {
+	return b.br.Buffered()
+}
+
+// SetReadDeadline sets the read deadline on the underlying response body.
+func (b *BufferedBody) SetReadDeadline(t time.Time) error {
+	if rb, ok := b.body.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return rb.SetReadDeadline(t)
+	}
+	return errors.New("http3: response body doesn't support read deadlines")
+}
+
+func (b *BufferedBody) Close() error {
+	return b.body.Close()
 }
 
 func (r *hijackableBody) requestDone() {
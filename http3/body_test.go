@@ -1,9 +1,13 @@
 package http3
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"io"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/quic-go/quic-go"
 	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
@@ -38,6 +42,18 @@ var _ = Describe("Response Body", func() {
 		Expect(err).To(HaveOccurred())
 	})
 
+	It("doesn't close the reqDone channel when the read deadline is exceeded", func() {
+		str := mockquic.NewMockStream(mockCtrl)
+		deadline := time.Now().Add(time.Hour)
+		str.EXPECT().SetReadDeadline(deadline)
+		str.EXPECT().Read(gomock.Any()).Return(0, os.ErrDeadlineExceeded)
+		rb := newResponseBody(&stream{Stream: str}, -1, reqDone)
+		Expect(rb.SetReadDeadline(deadline)).To(Succeed())
+		_, err := rb.Read([]byte{0})
+		Expect(err).To(MatchError(os.ErrDeadlineExceeded))
+		Expect(reqDone).ToNot(BeClosed())
+	})
+
 	It("closes responses", func() {
 		str := mockquic.NewMockStream(mockCtrl)
 		rb := newResponseBody(&stream{Stream: str}, -1, reqDone)
@@ -98,4 +114,143 @@ var _ = Describe("Response Body", func() {
 			Expect(data).To(Equal([]byte("foo")))
 		})
 	})
+
+	Context("maximum body size", func() {
+		It("reads bodies up to the maximum size", func() {
+			var buf bytes.Buffer
+			buf.Write(getDataFrame([]byte("foo")))
+			buf.Write(getDataFrame([]byte("bar")))
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			rb := newResponseBody(&stream{Stream: str}, -1, reqDone)
+			rb.maxSize = 6
+			data, err := io.ReadAll(rb)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foobar")))
+		})
+
+		It("errors when a body of unknown length exceeds the maximum size", func() {
+			var buf bytes.Buffer
+			buf.Write(getDataFrame([]byte("foo")))
+			buf.Write(getDataFrame([]byte("bar")))
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			rb := newResponseBody(&stream{Stream: str}, -1, reqDone)
+			rb.maxSize = 4
+			data, err := io.ReadAll(rb)
+			Expect(err).To(MatchError(ErrResponseBodyTooLarge))
+			Expect(data).To(Equal([]byte("foob")))
+			Expect(reqDone).To(BeClosed())
+			// check that repeated calls to Read also return the right error
+			n, err := rb.Read([]byte{0})
+			Expect(n).To(BeZero())
+			Expect(err).To(MatchError(ErrResponseBodyTooLarge))
+		})
+
+		It("errors right away when the Content-Length exceeds the maximum size", func() {
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			rb := newResponseBody(&stream{Stream: str}, 7, reqDone)
+			rb.maxSize = 6
+			n, err := rb.Read(make([]byte, 10))
+			Expect(n).To(BeZero())
+			Expect(err).To(MatchError(ErrResponseBodyTooLarge))
+			Expect(reqDone).To(BeClosed())
+		})
+	})
+
+	Context("buffered body", func() {
+		// frames the messages using a 1 byte length prefix
+		frameMessages := func(msgs ...string) []byte {
+			var b []byte
+			for _, m := range msgs {
+				b = append(b, byte(len(m)))
+				b = append(b, m...)
+			}
+			return b
+		}
+
+		It("frames multiple messages from one body", func() {
+			var buf bytes.Buffer
+			data := frameMessages("foo", "foobar", "", "lorem ipsum")
+			// split the messages across DATA frames at arbitrary positions
+			buf.Write(getDataFrame(data[:2]))
+			buf.Write(getDataFrame(data[2:9]))
+			buf.Write(getDataFrame(data[9:]))
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			b := newBufferedBody(newResponseBody(&stream{Stream: str}, int64(len(data)), reqDone), 16)
+
+			var msgs []string
+			for {
+				prefix, err := b.Peek(1)
+				if err == io.EOF {
+					break
+				}
+				Expect(err).ToNot(HaveOccurred())
+				l := int(prefix[0])
+				msg, err := b.Peek(1 + l)
+				Expect(err).ToNot(HaveOccurred())
+				msgs = append(msgs, string(msg[1:]))
+				n, err := b.Discard(1 + l)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(1 + l))
+			}
+			Expect(msgs).To(Equal([]string{"foo", "foobar", "", "lorem ipsum"}))
+			Expect(reqDone).To(BeClosed())
+		})
+
+		It("returns io.EOF when peeking past the end of the body", func() {
+			var buf bytes.Buffer
+			buf.Write(getDataFrame([]byte("foo")))
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			b := newBufferedBody(newResponseBody(&stream{Stream: str}, -1, reqDone), 16)
+			data, err := b.Peek(5)
+			Expect(err).To(MatchError(io.EOF))
+			Expect(data).To(Equal([]byte("foo")))
+			// the data wasn't consumed
+			Expect(b.Buffered()).To(Equal(3))
+			all, err := io.ReadAll(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(all).To(Equal([]byte("foo")))
+		})
+
+		It("doesn't peek beyond the Content-Length", func() {
+			var buf bytes.Buffer
+			buf.Write(getDataFrame([]byte("foo")))
+			buf.Write(getDataFrame([]byte("bar")))
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeMessageError))
+			str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeMessageError))
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			b := newBufferedBody(newResponseBody(&stream{Stream: str}, 4, reqDone), 16)
+			data, err := b.Peek(6)
+			Expect(err).To(MatchError(errTooMuchData))
+			Expect(data).To(Equal([]byte("foob")))
+		})
+
+		It("errors when peeking more than the buffer size", func() {
+			var buf bytes.Buffer
+			buf.Write(getDataFrame(bytes.Repeat([]byte{'a'}, 20)))
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			b := newBufferedBody(newResponseBody(&stream{Stream: str}, -1, reqDone), 16)
+			data, err := b.Peek(17)
+			Expect(err).To(MatchError(bufio.ErrBufferFull))
+			Expect(data).To(HaveLen(16))
+		})
+
+		It("exposes the underlying response body", func() {
+			str := mockquic.NewMockStream(mockCtrl)
+			rb := newResponseBody(&stream{Stream: str}, -1, reqDone)
+			rb.info.served0RTT = true
+			rsp := &http.Response{Body: newBufferedBody(rb, 16)}
+			Expect(ServedOver0RTT(rsp)).To(BeTrue())
+			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			Expect(rsp.Body.Close()).To(Succeed())
+			Expect(reqDone).To(BeClosed())
+		})
+	})
 })
@@ -1,21 +1,21 @@
 package http3
 
 import (
+	"bufio"
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptrace"
 	"net/textproto"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/quicvarint"
-
-	"github.com/quic-go/qpack"
 )
 
 const (
@@ -27,6 +27,39 @@ const (
 	MethodHead0RTT = "HEAD_0RTT"
 )
 
+// ServedOver0RTT says if the request was sent in 0-RTT, and the server processed it before
+// the handshake completed, i.e. if the request might have been subject to a replay attack.
+// This is only possible for requests using MethodGet0RTT or MethodHead0RTT.
+// It returns false if the response wasn't received by this package, or if the Body of the
+// response was replaced.
+func ServedOver0RTT(rsp *http.Response) bool {
+	if b := responseBodyOf(rsp); b != nil {
+		return b.info.served0RTT
+	}
+	return false
+}
+
+// RequestStreamWriter returns a writer for the request stream of a CONNECT or Extended CONNECT request sent
+// with RoundTripOpt.DontCloseRequestStream, if the server established the tunnel by responding with a 2xx status code.
+// Data written to it is sent in HTTP/3 DATA frames, and closing it closes the request stream for writing.
+// It returns nil for all other responses, if the response wasn't received by this package,
+// or if the Body of the response was replaced.
+func RequestStreamWriter(rsp *http.Response) io.WriteCloser {
+	if b := responseBodyOf(rsp); b != nil && b.requestStream != nil {
+		return b.requestStream
+	}
+	return nil
+}
+
+// ErrGoAway is returned for requests that were not processed by the server,
+// because the server sent a GOAWAY frame (see section 5.2 of RFC 9114).
+// This happens for requests that were sent on a stream ID greater or equal to the
+// stream ID of the GOAWAY frame, and for new requests after the GOAWAY frame was received.
+// It is safe to retry these requests on a new connection.
+var ErrGoAway = errors.New("http3: request not processed, server sent GOAWAY")
+
+var errClientConnShutdown = errors.New("http3: client connection was shut down")
+
 const (
 	defaultUserAgent              = "quic-go HTTP/3"
 	defaultMaxResponseHeaderBytes = 10 * 1 << 20 // 10 MB
@@ -49,6 +82,9 @@ type ClientConn struct {
 	// It is invalid to specify any settings defined by RFC 9114 (HTTP/3) and RFC 9297 (HTTP Datagrams).
 	additionalSettings map[uint64]uint64
 
+	// returns the frames sent on the control stream after the SETTINGS frame, see Transport.ControlStreamInit
+	controlStreamInit func() []byte
+
 	// maxResponseHeaderBytes specifies a limit on how many response bytes are
 	// allowed in the server's response header.
 	maxResponseHeaderBytes uint64
@@ -60,10 +96,44 @@ type ClientConn struct {
 	// However, if the user explicitly requested gzip it is not automatically uncompressed.
 	disableCompression bool
 
+	// decompressAcceptedEncodings, if true, transparently decodes responses to requests that set
+	// their own Accept-Encoding header field, if the coding is supported.
+	decompressAcceptedEncodings bool
+
+	// preserveRawResponseHeaders, if true, retains the header fields of responses in the order
+	// in which they were received.
+	preserveRawResponseHeaders bool
+
+	// maxDecompressedSize limits the size of transparently decompressed response bodies.
+	// Zero means no limit.
+	maxDecompressedSize int64
+
+	// maxResponseBodySize limits the size of response bodies.
+	// Zero means no limit.
+	maxResponseBodySize int64
+
+	// flushInterval specifies how long request body data is buffered before it is sent.
+	// Zero or negative values mean that data is sent immediately.
+	flushInterval time.Duration
+
+	// modifyRequest is called for every request before the request header is sent.
+	modifyRequest func(*http.Request) error
+	// modifyResponse is called for every final response before it is returned.
+	modifyResponse func(*http.Response) error
+
+	// onStreamOpen is called for every request, after the request stream was opened.
+	onStreamOpen func(quic.StreamID, *http.Request)
+
+	// roundTripFunc sends requests, wrapped by the interceptor (if any).
+	roundTripFunc RoundTripFunc
+
+	clock  clock
 	logger *slog.Logger
 
 	requestWriter *requestWriter
-	decoder       *qpack.Decoder
+
+	controlStrOpened chan struct{} // closed when setupConn returns
+	controlStr       quic.SendStream
 }
 
 var _ http.RoundTripper = &ClientConn{}
@@ -72,29 +142,71 @@ var _ http.RoundTripper = &ClientConn{}
 // It can be obtained by calling NewClientConn on a Transport.
 type SingleDestinationRoundTripper = ClientConn
 
-func newClientConn(
-	conn quic.Connection,
-	enableDatagrams bool,
-	additionalSettings map[uint64]uint64,
-	streamHijacker func(FrameType, quic.ConnectionTracingID, quic.Stream, error) (hijacked bool, err error),
-	uniStreamHijacker func(StreamType, quic.ConnectionTracingID, quic.ReceiveStream, error) (hijacked bool),
-	maxResponseHeaderBytes int64,
-	disableCompression bool,
-	logger *slog.Logger,
-) *ClientConn {
+// clientConnConfig configures a ClientConn.
+// The fields correspond to the fields of the Transport, see Transport.clientConnConfig.
+type clientConnConfig struct {
+	enableDatagrams             bool
+	additionalSettings          map[uint64]uint64
+	controlStreamInit           func() []byte
+	streamHijacker              func(FrameType, quic.ConnectionTracingID, quic.Stream, error) (hijacked bool, err error)
+	uniStreamHijacker           func(StreamType, quic.ConnectionTracingID, quic.ReceiveStream, error) (hijacked bool)
+	maxResponseHeaderBytes      int64
+	maxResponseHeaderFields     int
+	disableCompression          bool
+	decompressAcceptedEncodings bool
+	preserveRawResponseHeaders  bool
+	maxDecompressedSize         int64
+	maxResponseBodySize         int64
+	flushInterval               time.Duration
+	rejectConnectionHeaders     bool
+	userAgent                   string
+	acceptEncoding              string
+	modifyRequest               func(*http.Request) error
+	modifyResponse              func(*http.Response) error
+	onStreamOpen                func(quic.StreamID, *http.Request)
+	interceptor                 func(RoundTripFunc) RoundTripFunc
+	qpackTracer                 func(QPACKEvent)
+	onSettings                  func(*Settings)
+	datagramQueueLen            int
+	dropOldestDatagrams         bool
+	logger                      *slog.Logger
+	clock                       clock // defaults to the real clock
+}
+
+func newClientConn(conn quic.Connection, conf *clientConnConfig) *ClientConn {
 	c := &ClientConn{
-		enableDatagrams:    enableDatagrams,
-		additionalSettings: additionalSettings,
-		disableCompression: disableCompression,
-		logger:             logger,
+		enableDatagrams:             conf.enableDatagrams,
+		additionalSettings:          conf.additionalSettings,
+		controlStreamInit:           conf.controlStreamInit,
+		disableCompression:          conf.disableCompression,
+		decompressAcceptedEncodings: conf.decompressAcceptedEncodings,
+		preserveRawResponseHeaders:  conf.preserveRawResponseHeaders,
+		maxDecompressedSize:         conf.maxDecompressedSize,
+		maxResponseBodySize:         conf.maxResponseBodySize,
+		flushInterval:               conf.flushInterval,
+		modifyRequest:               conf.modifyRequest,
+		modifyResponse:              conf.modifyResponse,
+		onStreamOpen:                conf.onStreamOpen,
+		clock:                       conf.clock,
+		logger:                      conf.logger,
 	}
-	if maxResponseHeaderBytes <= 0 {
+	if c.clock == nil {
+		c.clock = realClock{}
+	}
+	if conf.maxResponseHeaderBytes <= 0 {
 		c.maxResponseHeaderBytes = defaultMaxResponseHeaderBytes
 	} else {
-		c.maxResponseHeaderBytes = uint64(maxResponseHeaderBytes)
+		c.maxResponseHeaderBytes = uint64(conf.maxResponseHeaderBytes)
+	}
+	c.roundTripFunc = c.roundTrip
+	if conf.interceptor != nil {
+		c.roundTripFunc = conf.interceptor(c.roundTripFunc)
 	}
-	c.decoder = qpack.NewDecoder(func(hf qpack.HeaderField) {})
 	c.requestWriter = newRequestWriter()
+	c.requestWriter.rejectConnectionHeaders = conf.rejectConnectionHeaders
+	c.requestWriter.userAgent = conf.userAgent
+	c.requestWriter.acceptEncoding = conf.acceptEncoding
+	c.requestWriter.qpackTracer = conf.qpackTracer
 	c.connection = *newConnection(
 		conn.Context(),
 		conn,
@@ -103,8 +215,15 @@ func newClientConn(
 		c.logger,
 		0,
 	)
+	c.connection.qpackTracer = conf.qpackTracer
+	c.connection.onSettings = conf.onSettings
+	c.connection.datagramQueueLen = conf.datagramQueueLen
+	c.connection.dropOldestDatagrams = conf.dropOldestDatagrams
+	c.connection.maxHeaderFields = conf.maxResponseHeaderFields
+	c.controlStrOpened = make(chan struct{})
 	// send the SETTINGs frame, using 0-RTT data, if possible
 	go func() {
+		defer close(c.controlStrOpened)
 		if err := c.setupConn(); err != nil {
 			if c.logger != nil {
 				c.logger.Debug("Setting up connection failed", "error", err)
@@ -112,16 +231,74 @@ func newClientConn(
 			c.connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeInternalError), "")
 		}
 	}()
-	if streamHijacker != nil {
-		go c.handleBidirectionalStreams(streamHijacker)
+	if conf.streamHijacker != nil {
+		go c.handleBidirectionalStreams(conf.streamHijacker)
 	}
-	go c.connection.handleUnidirectionalStreams(uniStreamHijacker)
+	go c.connection.handleUnidirectionalStreams(conf.uniStreamHijacker)
 	return c
 }
 
 // OpenRequestStream opens a new request stream on the HTTP/3 connection.
 func (c *ClientConn) OpenRequestStream(ctx context.Context) (RequestStream, error) {
-	return c.connection.openRequestStream(ctx, c.requestWriter, nil, c.disableCompression, c.maxResponseHeaderBytes)
+	return c.connection.openRequestStream(ctx, false, c.requestStreamOptions())
+}
+
+// requestStreamOptions returns the options for the request streams opened on this connection.
+// They can be overridden for a single request.
+func (c *ClientConn) requestStreamOptions() requestStreamOptions {
+	return requestStreamOptions{
+		requestWriter:       c.requestWriter,
+		maxHeaderBytes:      c.maxResponseHeaderBytes,
+		disableCompression:  c.disableCompression,
+		decompressAccepted:  c.decompressAcceptedEncodings,
+		preserveRawHeaders:  c.preserveRawResponseHeaders,
+		maxDecompressedSize: c.maxDecompressedSize,
+		maxBodySize:         c.maxResponseBodySize,
+		clock:               c.clock,
+	}
+}
+
+// PrepareHeaders encodes the header fields of a request into a HeaderTemplate.
+// Requests that carry the template in their context (see HeaderTemplateContextKey)
+// are sent without encoding the header fields of the template again.
+// The request's Body, ContentLength and Trailer are ignored.
+func (c *ClientConn) PrepareHeaders(req *http.Request) (*HeaderTemplate, error) {
+	return c.requestWriter.prepareHeaders(req)
+}
+
+// NegotiatedProtocol returns the QUIC version and the ALPN (e.g. "h3") that were negotiated
+// with the server.
+// It is only valid to call this function after the handshake has completed.
+func (c *ClientConn) NegotiatedProtocol() (quic.Version, string) {
+	state := c.connection.ConnectionState()
+	return state.Version, state.TLS.NegotiatedProtocol
+}
+
+// Ping sends a QUIC PING frame and waits for the server to acknowledge it.
+// This can be used to check that the connection is still alive before sending a request.
+// It returns the round-trip time, which includes the server's acknowledgement delay.
+func (c *ClientConn) Ping(ctx context.Context) (time.Duration, error) {
+	rtt, err := c.connection.Ping(ctx)
+	if err != nil {
+		return 0, maybeReplaceError(err)
+	}
+	return rtt, nil
+}
+
+// ConnectionStats returns the RTT estimates and the congestion window of the underlying QUIC connection.
+// Calling it after a request has completed reports the values measured while the request was in flight.
+// It also reports the number of keep-alive PINGs sent and for how long the connection has been idle,
+// which can be used to tune the Transport's KeepAlivePeriod.
+func (c *ClientConn) ConnectionStats() quic.ConnectionStats {
+	return c.connection.ConnectionStats()
+}
+
+// ActiveRequests returns the number of requests that are currently in flight on this connection.
+// This includes requests that are waiting for the server's stream limit to increase.
+// A request is in flight until the response body has been read or closed.
+// It can be used to distribute requests across multiple connections.
+func (c *ClientConn) ActiveRequests() int {
+	return c.connection.numActiveStreams()
 }
 
 func (c *ClientConn) setupConn() error {
@@ -130,14 +307,65 @@ func (c *ClientConn) setupConn() error {
 	if err != nil {
 		return err
 	}
+	c.controlStr = str
 	b := make([]byte, 0, 64)
 	b = quicvarint.Append(b, streamTypeControlStream)
 	// send the SETTINGS frame
 	b = (&settingsFrame{Datagram: c.enableDatagrams, Other: c.additionalSettings}).Append(b)
+	if c.controlStreamInit != nil {
+		frames := c.controlStreamInit()
+		if err := validateControlStreamFrames(frames); err != nil {
+			return err
+		}
+		b = append(b, frames...)
+	}
 	_, err = str.Write(b)
 	return err
 }
 
+// Shutdown gracefully shuts down the connection.
+// It sends a GOAWAY frame to the server, and stops sending new requests on this connection.
+// It then waits for all in-flight requests to complete, i.e. until the response bodies have
+// been read or closed, and closes the connection afterwards.
+// If the context is canceled before all requests have completed, the connection is closed
+// immediately, and the context's error is returned.
+func (c *ClientConn) Shutdown(ctx context.Context) error {
+	drained := c.connection.drain()
+
+	select {
+	case <-c.controlStrOpened:
+	case <-ctx.Done():
+		c.connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "")
+		return ctx.Err()
+	}
+	if c.controlStr != nil {
+		// We don't support server push, so the push ID is always 0.
+		if _, err := c.controlStr.Write((&goAwayFrame{StreamID: 0}).Append(nil)); err != nil {
+			if c.logger != nil {
+				c.logger.Debug("sending GOAWAY failed", "error", err)
+			}
+		}
+	}
+
+	select {
+	case <-drained:
+		return c.connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "")
+	case <-ctx.Done():
+		c.connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "")
+		return ctx.Err()
+	}
+}
+
+// sendPriorityUpdate sends a PRIORITY_UPDATE frame for a request stream on the control stream.
+func (c *ClientConn) sendPriorityUpdate(id quic.StreamID, p Priority) error {
+	<-c.controlStrOpened
+	if c.controlStr == nil {
+		return errors.New("http3: control stream not opened")
+	}
+	_, err := c.controlStr.Write((&priorityUpdateFrame{StreamID: id, Priority: p.String()}).Append(nil))
+	return err
+}
+
 func (c *ClientConn) handleBidirectionalStreams(streamHijacker func(FrameType, quic.ConnectionTracingID, quic.Stream, error) (hijacked bool, err error)) {
 	for {
 		str, err := c.connection.AcceptStream(context.Background())
@@ -169,9 +397,17 @@ func (c *ClientConn) handleBidirectionalStreams(streamHijacker func(FrameType, q
 	}
 }
 
-// RoundTrip executes a request and returns a response
+// RoundTrip executes a request and returns a response.
+//
+// The request body is sent on the request stream, and the stream is closed once the body
+// returns io.EOF. If reading from the body fails, sending of the body is aborted by resetting
+// the send side of the stream, so the server can distinguish an aborted upload from a complete
+// one. By default, the stream is reset with H3_REQUEST_CANCELLED. To use a different error code,
+// the body can return an error wrapping an *Error, e.g. by calling
+// (*io.PipeWriter).CloseWithError(&Error{ErrorCode: ErrCodeRequestIncomplete}).
+// Once the response was received, the upload can also be aborted using ResponseController.Abort.
 func (c *ClientConn) RoundTrip(req *http.Request) (*http.Response, error) {
-	rsp, err := c.roundTrip(req)
+	rsp, err := c.roundTripFunc(req)
 	if err != nil && req.Context().Err() != nil {
 		// if the context was canceled, return the context cancellation error
 		err = req.Context().Err()
@@ -179,19 +415,33 @@ func (c *ClientConn) RoundTrip(req *http.Request) (*http.Response, error) {
 	return rsp, err
 }
 
+// withTimeoutCause is like context.WithTimeoutCause, but uses the clock of the connection.
+func (c *ClientConn) withTimeoutCause(ctx context.Context, d time.Duration, cause error) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	t := c.clock.AfterFunc(d, func() { cancel(cause) })
+	return ctx, func() {
+		t.Stop()
+		cancel(context.Canceled)
+	}
+}
+
 func (c *ClientConn) roundTrip(req *http.Request) (*http.Response, error) {
+	timings := Timings{Start: c.clock.Now()}
 	// Immediately send out this request, if this is a 0-RTT request.
+	var sentIn0RTT bool
 	switch req.Method {
 	case MethodGet0RTT:
 		// don't modify the original request
 		reqCopy := *req
 		req = &reqCopy
 		req.Method = http.MethodGet
+		sentIn0RTT = !c.handshakeCompleted()
 	case MethodHead0RTT:
 		// don't modify the original request
 		reqCopy := *req
 		req = &reqCopy
 		req.Method = http.MethodHead
+		sentIn0RTT = !c.handshakeCompleted()
 	default:
 		// wait for the handshake to complete
 		earlyConn, ok := c.Connection.(quic.EarlyConnection)
@@ -208,28 +458,72 @@ func (c *ClientConn) roundTrip(req *http.Request) (*http.Response, error) {
 	// See section 3 of RFC 8441.
 	if isExtendedConnectRequest(req) {
 		connCtx := c.Connection.Context()
+		// The time spent waiting can be limited for a single request using RoundTripOpt.SettingsTimeout.
+		settingsCtx := req.Context()
+		if timeout, ok := req.Context().Value(settingsTimeoutKey{}).(time.Duration); ok && timeout > 0 {
+			var cancel context.CancelFunc
+			settingsCtx, cancel = c.withTimeoutCause(req.Context(), timeout, ErrSettingsTimeout)
+			defer cancel()
+		}
 		// wait for the server's SETTINGS frame to arrive
 		select {
 		case <-c.connection.ReceivedSettings():
 		case <-connCtx.Done():
 			return nil, context.Cause(connCtx)
+		case <-settingsCtx.Done():
+			return nil, context.Cause(settingsCtx)
 		}
 		if !c.connection.Settings().EnableExtendedConnect {
 			return nil, errors.New("http3: server didn't enable Extended CONNECT")
 		}
 	}
 
+	timings.ConnReady = c.clock.Now()
+
+	opts := c.requestStreamOptions()
+	// compression can be disabled for a single request using RoundTripOpt.DisableCompression
+	if v, ok := req.Context().Value(disableCompressionKey{}).(bool); ok && v {
+		opts.disableCompression = true
+	}
+	// the response header size limit can be overridden for a single request using RoundTripOpt.MaxResponseHeaderBytes
+	if v, ok := req.Context().Value(maxResponseHeaderBytesKey{}).(int64); ok && v > 0 {
+		opts.maxHeaderBytes = uint64(v)
+	}
+	// Opening the stream blocks if the server's stream limit is reached.
+	// The time spent waiting can be limited for a single request using RoundTripOpt.MaxStreamWait.
+	openCtx := req.Context()
+	if wait, ok := req.Context().Value(maxStreamWaitKey{}).(time.Duration); ok && wait > 0 {
+		var cancel context.CancelFunc
+		openCtx, cancel = c.withTimeoutCause(req.Context(), wait, ErrStreamLimitReached)
+		defer cancel()
+	}
+	// RoundTripOpt.NonBlockingStreamOpen fails the request right away if the stream limit is reached
+	nonBlocking, _ := req.Context().Value(nonBlockingStreamOpenKey{}).(bool)
 	reqDone := make(chan struct{})
-	str, err := c.connection.openRequestStream(
-		req.Context(),
-		c.requestWriter,
-		reqDone,
-		c.disableCompression,
-		c.maxResponseHeaderBytes,
-	)
+	opts.reqDone = reqDone
+	str, err := c.connection.openRequestStream(openCtx, nonBlocking, opts)
 	if err != nil {
+		if req.Context().Err() == nil && errors.Is(context.Cause(openCtx), ErrStreamLimitReached) {
+			return nil, ErrStreamLimitReached
+		}
+		var limitErr *quic.StreamLimitReachedError
+		if nonBlocking && errors.As(err, &limitErr) {
+			return nil, ErrStreamLimitReached
+		}
 		return nil, err
 	}
+	if c.onStreamOpen != nil {
+		c.onStreamOpen(str.StreamID(), req)
+	}
+	if o, ok := req.Context().Value(wireTapKey{}).(wireTapOpt); ok {
+		str.wireTap = o.tap
+		str.wireTapData = o.includeData
+	}
+	// Apply the deadline of the request context directly to the stream,
+	// such that blocked reads and writes are aborted as soon as the deadline is reached.
+	if deadline, ok := req.Context().Deadline(); ok {
+		str.SetDeadline(deadline)
+	}
 
 	// Request Cancellation:
 	// This go routine keeps running even after RoundTripOpt() returns.
@@ -245,17 +539,29 @@ func (c *ClientConn) roundTrip(req *http.Request) (*http.Response, error) {
 		}
 	}()
 
-	rsp, err := c.doRequest(req, str)
+	rsp, err := c.doRequest(req, str, sentIn0RTT, timings)
 	if err != nil { // if any error occurred
 		close(reqDone)
 		<-done
+		if c.connection.rejectedByGoAway(str.StreamID()) {
+			return nil, ErrGoAway
+		}
+		// the server reset the request stream
+		var strErr *quic.StreamError
+		if errors.As(err, &strErr) && strErr.Remote {
+			return nil, &StreamError{StreamID: str.StreamID(), ErrorCode: ErrCode(strErr.ErrorCode)}
+		}
 		return nil, maybeReplaceError(err)
 	}
+	if size, ok := req.Context().Value(bufferedBodyKey{}).(int); ok && size > 0 {
+		rsp.Body = newBufferedBody(rsp.Body, size)
+	}
 	return rsp, maybeReplaceError(err)
 }
 
 // cancelingReader reads from the io.Reader.
 // It cancels writing on the stream if any error other than io.EOF occurs.
+// If the error wraps an *Error, its error code is used to cancel the stream.
 type cancelingReader struct {
 	r   io.Reader
 	str Stream
@@ -264,41 +570,181 @@ type cancelingReader struct {
 func (r *cancelingReader) Read(b []byte) (int, error) {
 	n, err := r.r.Read(b)
 	if err != nil && err != io.EOF {
-		r.str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+		errCode := ErrCodeRequestCanceled
+		var h3Err *Error
+		if errors.As(err, &h3Err) {
+			errCode = h3Err.ErrorCode
+		}
+		r.str.CancelWrite(quic.StreamErrorCode(errCode))
 	}
 	return n, err
 }
 
-func (c *ClientConn) sendRequestBody(str Stream, body io.ReadCloser, contentLength int64) error {
+// sendRequestBody copies the request body to the stream.
+// Unless a positive flush interval is configured, every chunk read from the body is written
+// to the QUIC stream as a DATA frame right away, so streamed request bodies (e.g. backed by
+// an io.Pipe) are delivered without delay, even if the request body doesn't have a known length.
+// When ctx is canceled, the body is closed, which unblocks a Read call that is waiting for data.
+func (c *ClientConn) sendRequestBody(ctx context.Context, str Stream, body io.ReadCloser, contentLength int64) error {
 	defer body.Close()
+	stop := context.AfterFunc(ctx, func() {
+		str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+		body.Close()
+	})
+	defer stop()
 	buf := make([]byte, bodyCopyBufferSize)
 	sr := &cancelingReader{str: str, r: body}
+	var w io.Writer = str
+	if c.flushInterval > 0 {
+		mlw := newMaxLatencyWriter(str, c.flushInterval, c.clock)
+		defer mlw.stop()
+		w = mlw
+	}
+	// If w is the stream itself, io.CopyBuffer delegates to its ReadFrom method,
+	// which writes the DATA frame headers together with the payload.
 	if contentLength == -1 {
-		_, err := io.CopyBuffer(str, sr, buf)
-		return err
+		_, err := io.CopyBuffer(w, sr, buf)
+		if err != nil {
+			return err
+		}
+		return flushWriter(w)
 	}
 
 	// make sure we don't send more bytes than the content length
-	n, err := io.CopyBuffer(str, io.LimitReader(sr, contentLength), buf)
+	n, err := io.CopyBuffer(w, io.LimitReader(sr, contentLength), buf)
 	if err != nil {
 		return err
 	}
+	if err := flushWriter(w); err != nil {
+		return err
+	}
 	var extra int64
 	extra, err = io.CopyBuffer(io.Discard, sr, buf)
 	n += extra
 	if n > contentLength {
 		str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
-		return fmt.Errorf("http: ContentLength=%d with Body length %d", contentLength, n)
+		return &BodyTooLongError{ContentLength: contentLength, BodyLength: n}
 	}
 	return err
 }
 
-func (c *ClientConn) doRequest(req *http.Request, str *requestStream) (*http.Response, error) {
+func flushWriter(w io.Writer) error {
+	if f, ok := w.(interface{ flush() error }); ok {
+		return f.flush()
+	}
+	return nil
+}
+
+// maxLatencyWriter buffers writes to the underlying writer,
+// and flushes the buffered data at most latency after it was written.
+// This is similar to the maxLatencyWriter used by httputil.ReverseProxy.
+type maxLatencyWriter struct {
+	latency time.Duration
+	clock   clock
+
+	mx           sync.Mutex
+	w            *bufio.Writer
+	t            timer
+	flushPending bool
+}
+
+func newMaxLatencyWriter(w io.Writer, latency time.Duration, clock clock) *maxLatencyWriter {
+	return &maxLatencyWriter{
+		w:       bufio.NewWriterSize(w, bodyCopyBufferSize),
+		latency: latency,
+		clock:   clock,
+	}
+}
+
+func (m *maxLatencyWriter) Write(p []byte) (int, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	n, err := m.w.Write(p)
+	if m.flushPending || m.w.Buffered() == 0 {
+		return n, err
+	}
+	if m.t == nil {
+		m.t = m.clock.AfterFunc(m.latency, m.delayedFlush)
+	} else {
+		m.t.Reset(m.latency)
+	}
+	m.flushPending = true
+	return n, err
+}
+
+func (m *maxLatencyWriter) delayedFlush() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	// if stop or flush was called in the meantime, there's nothing to do
+	if !m.flushPending {
+		return
+	}
+	m.w.Flush()
+	m.flushPending = false
+}
+
+func (m *maxLatencyWriter) flush() error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.flushPending = false
+	if m.t != nil {
+		m.t.Stop()
+	}
+	return m.w.Flush()
+}
+
+func (m *maxLatencyWriter) stop() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.flushPending = false
+	if m.t != nil {
+		m.t.Stop()
+	}
+}
+
+// handshakeCompleted says if the handshake of the underlying QUIC connection has completed.
+func (c *ClientConn) handshakeCompleted() bool {
+	earlyConn, ok := c.Connection.(quic.EarlyConnection)
+	if !ok {
+		return true
+	}
+	select {
+	case <-earlyConn.HandshakeComplete():
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *ClientConn) doRequest(req *http.Request, str *requestStream, sentIn0RTT bool, timings Timings) (*http.Response, error) {
+	if c.modifyRequest != nil {
+		// don't modify the original request
+		req = req.Clone(req.Context())
+		if err := c.modifyRequest(req); err != nil {
+			str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			str.CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			closeRequestBody(req)
+			return nil, err
+		}
+	}
 	if err := str.SendRequestHeader(req); err != nil {
 		return nil, err
 	}
-	if req.Body == nil {
-		str.Close()
+	// set when the request body is longer than the ContentLength, and the request was aborted
+	var bodyTooLong atomic.Pointer[BodyTooLongError]
+	// For CONNECT requests, the application might want to keep sending data on the request stream.
+	var keepStreamOpen bool
+	// http.NoBody is used by http.NewRequest for bodies that are known to be empty.
+	if req.Body == nil || req.Body == http.NoBody {
+		if v, ok := req.Context().Value(dontCloseRequestStreamKey{}).(bool); ok && v && req.Method == http.MethodConnect {
+			keepStreamOpen = true
+		} else {
+			str.Close()
+		}
 	} else {
 		// send the request body asynchronously
 		go func() {
@@ -308,8 +754,14 @@ func (c *ClientConn) doRequest(req *http.Request, str *requestStream) (*http.Res
 			if req.ContentLength > 0 {
 				contentLength = req.ContentLength
 			}
-			if err := c.sendRequestBody(str, req.Body, contentLength); err != nil {
-				if c.logger != nil {
+			if err := c.sendRequestBody(req.Context(), str, req.Body, contentLength); err != nil {
+				var tooLongErr *BodyTooLongError
+				if errors.As(err, &tooLongErr) {
+					// This is a programming error, not a network error.
+					// Abort reading the response, so the error is returned to the caller.
+					bodyTooLong.Store(tooLongErr)
+					str.CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+				} else if c.logger != nil {
 					c.logger.Debug("error writing request", "error", err)
 				}
 			}
@@ -323,10 +775,14 @@ func (c *ClientConn) doRequest(req *http.Request, str *requestStream) (*http.Res
 	const max1xxResponses = 5 // arbitrary bound on number of informational responses
 
 	var res *http.Response
+	var earlyHintsLinks []string
 	for {
 		var err error
 		res, err = str.ReadResponse()
 		if err != nil {
+			if tooLongErr := bodyTooLong.Load(); tooLongErr != nil {
+				return nil, tooLongErr
+			}
 			return nil, err
 		}
 		resCode := res.StatusCode
@@ -343,12 +799,39 @@ func (c *ClientConn) doRequest(req *http.Request, str *requestStream) (*http.Res
 					return nil, err
 				}
 			}
+			// preserve the preload hints, see RFC 8297
+			if resCode == http.StatusEarlyHints {
+				earlyHintsLinks = res.Header.Values("Link")
+			}
 			continue
 		}
 		break
 	}
-	connState := c.connection.ConnectionState().TLS
-	res.TLS = &connState
+	connState := c.connection.ConnectionState()
+	res.TLS = &connState.TLS
+	if b := responseBodyOf(res); b != nil {
+		b.info.served0RTT = sentIn0RTT && connState.Used0RTT
+		b.info.earlyHintsLinks = earlyHintsLinks
+		b.updatePriority = func(p Priority) error { return c.sendPriorityUpdate(str.StreamID(), p) }
+		timings.FirstResponseByte = str.firstResponseByte
+		timings.Headers = c.clock.Now()
+		b.info.timings = timings
+	}
+	if keepStreamOpen {
+		if b := responseBodyOf(res); b != nil && b.isTunnel {
+			b.requestStream = str.stream
+		} else {
+			// the server didn't establish the tunnel, no need to keep the stream open
+			str.Close()
+		}
+	}
 	res.Request = req
+	if c.modifyResponse != nil {
+		if err := c.modifyResponse(res); err != nil {
+			str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			str.CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			return nil, err
+		}
+	}
 	return res, nil
 }
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptrace"
 	"net/textproto"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -37,6 +41,14 @@ func encodeResponse(status int) []byte {
 	return buf.Bytes()
 }
 
+type readerFunc struct {
+	read  func([]byte) (int, error)
+	close func() error
+}
+
+func (r *readerFunc) Read(b []byte) (int, error) { return r.read(b) }
+func (r *readerFunc) Close() error               { return r.close() }
+
 var _ = Describe("Client", func() {
 	var handshakeChan <-chan struct{} // a closed chan
 
@@ -311,6 +323,79 @@ var _ = Describe("Client", func() {
 		})
 	})
 
+	It("returns the negotiated QUIC version and ALPN", func() {
+		done := make(chan struct{})
+		defer close(done)
+		conn := mockquic.NewMockEarlyConnection(mockCtrl)
+		conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+		conn.EXPECT().OpenUniStream().DoAndReturn(func() (quic.SendStream, error) {
+			<-done
+			return nil, errors.New("test done")
+		}).MaxTimes(1)
+		conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+			<-done
+			return nil, errors.New("test done")
+		}).MaxTimes(1)
+		conn.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(1)
+		conn.EXPECT().ConnectionState().Return(quic.ConnectionState{
+			Version: quic.Version2,
+			TLS:     tls.ConnectionState{NegotiatedProtocol: NextProtoH3},
+		})
+		cc := (&Transport{}).NewClientConn(conn)
+		version, alpn := cc.NegotiatedProtocol()
+		Expect(version).To(Equal(quic.Version2))
+		Expect(alpn).To(Equal(NextProtoH3))
+	})
+
+	Context("pinging", func() {
+		var (
+			conn *mockquic.MockEarlyConnection
+			done chan struct{}
+		)
+
+		BeforeEach(func() {
+			d := make(chan struct{})
+			done = d
+			conn = mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn.EXPECT().OpenUniStream().DoAndReturn(func() (quic.SendStream, error) {
+				<-d
+				return nil, errors.New("test done")
+			}).MaxTimes(1)
+			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-d
+				return nil, errors.New("test done")
+			}).MaxTimes(1)
+			conn.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(1)
+		})
+
+		AfterEach(func() { close(done) })
+
+		It("returns the RTT", func() {
+			conn.EXPECT().Ping(gomock.Any()).Return(42*time.Millisecond, nil)
+			cc := (&Transport{}).NewClientConn(conn)
+			rtt, err := cc.Ping(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rtt).To(Equal(42 * time.Millisecond))
+		})
+
+		It("returns a ConnectionError if the connection was closed", func() {
+			conn.EXPECT().Ping(gomock.Any()).Return(time.Duration(0), &quic.IdleTimeoutError{})
+			cc := (&Transport{}).NewClientConn(conn)
+			_, err := cc.Ping(context.Background())
+			var connErr *ConnectionError
+			Expect(errors.As(err, &connErr)).To(BeTrue())
+			Expect(connErr.Timeout()).To(BeTrue())
+		})
+
+		It("returns the connection stats", func() {
+			stats := quic.ConnectionStats{SmoothedRTT: 42 * time.Millisecond, CongestionWindow: 1337}
+			conn.EXPECT().ConnectionStats().Return(stats)
+			cc := (&Transport{}).NewClientConn(conn)
+			Expect(cc.ConnectionStats()).To(Equal(stats))
+		})
+	})
+
 	Context("SETTINGS handling", func() {
 		sendSettings := func() {
 			settingsFrameWritten := make(chan struct{})
@@ -380,6 +465,418 @@ var _ = Describe("Client", func() {
 			close(done)
 		})
 
+		It("calls the OnSettings callback", func() {
+			done := make(chan struct{})
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().OpenUniStream().DoAndReturn(func() (quic.SendStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			}).MaxTimes(1)
+			conn.EXPECT().Context().Return(context.Background())
+			b := quicvarint.Append(nil, streamTypeControlStream)
+			b = (&settingsFrame{
+				ExtendedConnect: true,
+				Other:           map[uint64]uint64{settingEnableWebTransport: 1, 1337: 42},
+			}).Append(b)
+			r := bytes.NewReader(b)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Read(gomock.Any()).DoAndReturn(r.Read).AnyTimes()
+			conn.EXPECT().AcceptUniStream(gomock.Any()).Return(controlStr, nil)
+			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			})
+
+			settingsChan := make(chan *Settings, 2)
+			tr := &Transport{OnSettings: func(s *Settings) { settingsChan <- s }}
+			cc := tr.NewClientConn(conn)
+			var settings *Settings
+			Eventually(settingsChan).Should(Receive(&settings))
+			Expect(cc.ReceivedSettings()).To(BeClosed())
+			Expect(settings).To(Equal(cc.Settings()))
+			Expect(settings.EnableDatagrams).To(BeFalse())
+			Expect(settings.EnableExtendedConnect).To(BeTrue())
+			Expect(settings.EnableWebTransport).To(BeTrue())
+			Expect(settings.Other).To(HaveKeyWithValue(uint64(1337), uint64(42)))
+			Consistently(settingsChan).ShouldNot(Receive())
+			// test shutdown
+			conn.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(1)
+			close(done)
+		})
+
+		It("rejects sending datagrams if the server didn't enable them", func() {
+			done := make(chan struct{})
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().OpenUniStream().DoAndReturn(func() (quic.SendStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			}).MaxTimes(1)
+			conn.EXPECT().Context().Return(context.Background())
+			b := quicvarint.Append(nil, streamTypeControlStream)
+			b = (&settingsFrame{}).Append(b)
+			r := bytes.NewReader(b)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Read(gomock.Any()).DoAndReturn(r.Read).AnyTimes()
+			conn.EXPECT().AcceptUniStream(gomock.Any()).Return(controlStr, nil)
+			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			})
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().StreamID().AnyTimes()
+			str.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+			// don't EXPECT any calls to conn.SendDatagram
+
+			tr := &Transport{EnableDatagrams: true}
+			cc := tr.NewClientConn(conn)
+			rstr, err := cc.OpenRequestStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(cc.ReceivedSettings()).Should(BeClosed())
+			Expect(rstr.SendDatagram([]byte("foobar"))).To(MatchError("http3: peer didn't enable HTTP datagrams"))
+			Expect(rstr.TrySendDatagram([]byte("foobar"))).To(MatchError("http3: peer didn't enable HTTP datagrams"))
+			_, err = rstr.ReceiveDatagram(context.Background())
+			Expect(err).To(MatchError("http3: peer didn't enable HTTP datagrams"))
+			// test shutdown
+			conn.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(1)
+			close(done)
+		})
+
+		It("sends datagrams before receiving the server's SETTINGS", func() {
+			done := make(chan struct{})
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().OpenUniStream().DoAndReturn(func() (quic.SendStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			}).MaxTimes(1)
+			conn.EXPECT().Context().Return(context.Background())
+			// the server doesn't open its control stream
+			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			}).MaxTimes(1)
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().StreamID().Return(quic.StreamID(4)).AnyTimes()
+			str.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+			conn.EXPECT().SendDatagram(append(quicvarint.Append(nil, 1), []byte("foobar")...))
+
+			tr := &Transport{EnableDatagrams: true}
+			cc := tr.NewClientConn(conn)
+			rstr, err := cc.OpenRequestStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cc.ReceivedSettings()).ToNot(BeClosed())
+			Expect(rstr.SendDatagram([]byte("foobar"))).To(Succeed())
+			// test shutdown
+			conn.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(2)
+			close(done)
+		})
+
+		Context("GOAWAY handling", func() {
+			var (
+				conn       *mockquic.MockEarlyConnection
+				controlStr *io.PipeWriter
+				done       chan struct{}
+			)
+
+			BeforeEach(func() {
+				// use a local variable, so the mock callbacks don't race with the next BeforeEach
+				d := make(chan struct{})
+				done = d
+				conn = mockquic.NewMockEarlyConnection(mockCtrl)
+				conn.EXPECT().OpenUniStream().DoAndReturn(func() (quic.SendStream, error) {
+					<-d
+					return nil, errors.New("test done")
+				}).MaxTimes(1)
+				conn.EXPECT().Context().Return(context.Background())
+				r, w := io.Pipe()
+				controlStr = w
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(r.Read).AnyTimes()
+				conn.EXPECT().AcceptUniStream(gomock.Any()).Return(str, nil)
+				conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-d
+					return nil, errors.New("test done")
+				})
+				b := quicvarint.Append(nil, streamTypeControlStream)
+				b = (&settingsFrame{}).Append(b)
+				go w.Write(b)
+			})
+
+			AfterEach(func() {
+				conn.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(1)
+				controlStr.Close()
+				close(done)
+			})
+
+			openStream := func(cc *ClientConn, id quic.StreamID) *mockquic.MockStream {
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().StreamID().Return(id).AnyTimes()
+				str.EXPECT().Context().Return(context.Background()).AnyTimes()
+				conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				_, err := cc.OpenRequestStream(context.Background())
+				ExpectWithOffset(1, err).ToNot(HaveOccurred())
+				return str
+			}
+
+			It("only cancels requests with stream IDs greater or equal to the GOAWAY stream ID", func() {
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				Eventually(cc.ReceivedSettings()).Should(BeClosed())
+				openStream(cc, 0) // no calls to CancelRead / CancelWrite expected
+				str4 := openStream(cc, 4)
+				str8 := openStream(cc, 8)
+				canceled := make(chan struct{}, 2)
+				for _, str := range []*mockquic.MockStream{str4, str8} {
+					str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+					str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled)).Do(func(quic.StreamErrorCode) { canceled <- struct{}{} })
+				}
+
+				controlStr.Write((&goAwayFrame{StreamID: 4}).Append(nil))
+				Eventually(canceled).Should(Receive())
+				Eventually(canceled).Should(Receive())
+				Expect(cc.connection.rejectedByGoAway(0)).To(BeFalse())
+				Expect(cc.connection.rejectedByGoAway(4)).To(BeTrue())
+				Expect(cc.connection.rejectedByGoAway(8)).To(BeTrue())
+				// no new requests are sent after receiving the GOAWAY frame
+				_, err := cc.OpenRequestStream(context.Background())
+				Expect(err).To(MatchError(ErrGoAway))
+			})
+
+			It("cancels all requests when receiving a GOAWAY frame with stream ID 0", func() {
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				Eventually(cc.ReceivedSettings()).Should(BeClosed())
+				str := openStream(cc, 0)
+				canceled := make(chan struct{})
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled)).Do(func(quic.StreamErrorCode) { close(canceled) })
+				controlStr.Write((&goAwayFrame{StreamID: 0}).Append(nil))
+				Eventually(canceled).Should(BeClosed())
+			})
+
+			It("closes the connection when the GOAWAY stream ID increases", func() {
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				Eventually(cc.ReceivedSettings()).Should(BeClosed())
+				closed := make(chan struct{})
+				conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) error {
+					close(closed)
+					return nil
+				})
+				controlStr.Write((&goAwayFrame{StreamID: 4}).Append(nil))
+				controlStr.Write((&goAwayFrame{StreamID: 8}).Append(nil))
+				Eventually(closed).Should(BeClosed())
+			})
+
+			It("closes the connection when receiving too many GOAWAY frames", func() {
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				Eventually(cc.ReceivedSettings()).Should(BeClosed())
+				closed := make(chan struct{})
+				conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeExcessiveLoad), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) error {
+					close(closed)
+					return nil
+				})
+				// the usual pattern for a graceful shutdown: a large stream ID, followed by the actual stream ID
+				controlStr.Write((&goAwayFrame{StreamID: 1 << 60}).Append(nil))
+				controlStr.Write((&goAwayFrame{StreamID: 8}).Append(nil))
+				Consistently(closed).ShouldNot(BeClosed())
+				var b []byte
+				for i := 0; i < maxGoAwayFrames-1; i++ {
+					b = (&goAwayFrame{StreamID: 8}).Append(b)
+				}
+				controlStr.Write(b)
+				Eventually(closed).Should(BeClosed())
+			})
+		})
+
+		Context("shutting down", func() {
+			var (
+				conn   *mockquic.MockEarlyConnection
+				writes chan []byte
+				done   chan struct{}
+			)
+
+			BeforeEach(func() {
+				d := make(chan struct{})
+				done = d
+				writes = make(chan []byte, 2)
+				controlStr := mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+					writes <- b
+					return len(b), nil
+				}).MaxTimes(2)
+				conn = mockquic.NewMockEarlyConnection(mockCtrl)
+				conn.EXPECT().OpenUniStream().Return(controlStr, nil)
+				conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+				conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-d
+					return nil, errors.New("test done")
+				})
+			})
+
+			AfterEach(func() { close(done) })
+
+			openStream := func(cc *ClientConn) (*mockquic.MockStream, RequestStream) {
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().StreamID().AnyTimes()
+				str.EXPECT().Context().Return(context.Background()).AnyTimes()
+				conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				rstr, err := cc.OpenRequestStream(context.Background())
+				ExpectWithOffset(1, err).ToNot(HaveOccurred())
+				return str, rstr
+			}
+
+			It("sends a GOAWAY frame and waits for in-flight requests to complete", func() {
+				cc := (&Transport{}).NewClientConn(conn)
+				Eventually(writes).Should(Receive()) // SETTINGS frame
+				str, rstr := openStream(cc)
+
+				errChan := make(chan error, 1)
+				go func() { errChan <- cc.Shutdown(context.Background()) }()
+				var b []byte
+				Eventually(writes).Should(Receive(&b))
+				Expect(b).To(Equal((&goAwayFrame{StreamID: 0}).Append(nil)))
+				// no new requests are sent after shutting down
+				_, err := cc.OpenRequestStream(context.Background())
+				Expect(err).To(MatchError(errClientConnShutdown))
+				Consistently(errChan, scaleDuration(50*time.Millisecond)).ShouldNot(Receive())
+
+				// complete the request
+				closed := make(chan struct{})
+				conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "").Do(func(quic.ApplicationErrorCode, string) error {
+					close(closed)
+					return nil
+				})
+				str.EXPECT().Close()
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeNoError))
+				Expect(rstr.Close()).To(Succeed())
+				Consistently(closed, scaleDuration(20*time.Millisecond)).ShouldNot(BeClosed())
+				rstr.CancelRead(quic.StreamErrorCode(ErrCodeNoError))
+				Eventually(errChan).Should(Receive(BeNil()))
+				Expect(closed).To(BeClosed())
+			})
+
+			It("closes the connection when the context is canceled", func() {
+				cc := (&Transport{}).NewClientConn(conn)
+				Eventually(writes).Should(Receive()) // SETTINGS frame
+				openStream(cc)
+
+				ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(50*time.Millisecond))
+				defer cancel()
+				conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "")
+				Expect(cc.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+				Expect(writes).To(Receive(Equal((&goAwayFrame{StreamID: 0}).Append(nil))))
+			})
+		})
+
+		It("sends the frames returned by ControlStreamInit after the SETTINGS frame", func() {
+			done := make(chan struct{})
+			defer close(done)
+			writes := make(chan []byte, 1)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+				writes <- b
+				return len(b), nil
+			})
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().OpenUniStream().Return(controlStr, nil)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			})
+			token := quicvarint.Append(nil, 0x1337) // frame type
+			token = quicvarint.Append(token, 6)     // length
+			token = append(token, "foobar"...)
+			tr := &Transport{ControlStreamInit: func() []byte { return token }}
+			tr.NewClientConn(conn)
+
+			var b []byte
+			Eventually(writes).Should(Receive(&b))
+			r := bytes.NewReader(b)
+			st, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(st).To(BeEquivalentTo(streamTypeControlStream))
+			var frameTypes []FrameType
+			fp := frameParser{
+				r: r,
+				unknownFrameHandler: func(ft FrameType, e error) (bool, error) {
+					if e == nil {
+						frameTypes = append(frameTypes, ft)
+					}
+					return false, nil
+				},
+			}
+			f, err := fp.ParseNext()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f).To(BeAssignableToTypeOf(&settingsFrame{}))
+			Expect(bytes.HasSuffix(b, token)).To(BeTrue())
+			_, err = fp.ParseNext()
+			Expect(err).To(MatchError(io.EOF))
+			Expect(frameTypes).To(Equal([]FrameType{0x1337}))
+		})
+
+		It("closes the connection if ControlStreamInit returns invalid frames", func() {
+			done := make(chan struct{})
+			defer close(done)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().OpenUniStream().Return(controlStr, nil)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			})
+			closed := make(chan struct{})
+			conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeInternalError), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) error {
+				close(closed)
+				return nil
+			})
+			tr := &Transport{ControlStreamInit: func() []byte { return (&dataFrame{Length: 6}).Append(nil) }}
+			tr.NewClientConn(conn)
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("sends PRIORITY_UPDATE frames to reprioritize a request", func() {
+			done := make(chan struct{})
+			defer close(done)
+			writes := make(chan []byte, 2)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+				writes <- b
+				return len(b), nil
+			}).Times(2)
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().OpenUniStream().Return(controlStr, nil)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			})
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			conn.EXPECT().ConnectionState()
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().StreamID().Return(quic.StreamID(8)).AnyTimes()
+			str.EXPECT().Context().Return(context.Background()).AnyTimes()
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(b []byte) (int, error) { return len(b), nil }).AnyTimes()
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(bytes.NewBuffer(encodeResponse(http.StatusOK)).Read).AnyTimes()
+			conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+
+			cc := (&Transport{}).NewClientConn(conn)
+			Eventually(writes).Should(Receive()) // SETTINGS frame
+			req, err := http.NewRequest(http.MethodGet, "https://quic-go.net/large", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := cc.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(NewResponseController(rsp).SetPriority(Priority{Urgency: 6, Incremental: true})).To(Succeed())
+			var b []byte
+			Expect(writes).To(Receive(&b))
+			Expect(b).To(Equal((&priorityUpdateFrame{StreamID: 8, Priority: "u=6, i"}).Append(nil)))
+		})
+
 		It("checks the server's SETTINGS before sending an Extended CONNECT request", func() {
 			sendSettings()
 			done := make(chan struct{})
@@ -462,6 +959,69 @@ var _ = Describe("Client", func() {
 			close(done)
 			wg.Wait()
 		})
+
+		It("stops waiting for the server's SETTINGS after the SettingsTimeout", func() {
+			sendSettings()
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background())
+			conn.EXPECT().OpenUniStream().DoAndReturn(func() (quic.SendStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			})
+			// the server opens the control stream, but delays sending the SETTINGS frame
+			r := bytes.NewReader(quicvarint.Append(nil, streamTypeControlStream))
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Read(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+				if r.Len() > 0 {
+					return r.Read(b)
+				}
+				<-done
+				return 0, errors.New("test done")
+			}).MinTimes(1)
+			conn.EXPECT().AcceptUniStream(gomock.Any()).Return(controlStr, nil)
+			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				wg.Done()
+				return nil, errors.New("test done")
+			})
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			conn.EXPECT().Context().Return(context.Background())
+
+			tr := &Transport{}
+			cc := tr.NewClientConn(conn)
+			clock := newFakeClock()
+			cc.clock = clock
+			req := &http.Request{
+				Method: http.MethodConnect,
+				Proto:  "connect",
+				Host:   "localhost",
+			}
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := cc.RoundTrip(req.WithContext(context.WithValue(context.Background(), settingsTimeoutKey{}, time.Second)))
+				errChan <- err
+			}()
+			Eventually(clock.ActiveTimers).Should(Equal(1))
+			clock.Advance(time.Second - time.Nanosecond)
+			Consistently(errChan, scaleDuration(10*time.Millisecond)).ShouldNot(Receive())
+			clock.Advance(time.Nanosecond)
+			Eventually(errChan).Should(Receive(MatchError(ErrSettingsTimeout)))
+
+			// test shutdown:
+			// Both setting up the connection and reading from the control stream fail, closing the connection.
+			closed := make(chan struct{}, 2)
+			conn.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).DoAndReturn(func(quic.ApplicationErrorCode, string) error {
+				closed <- struct{}{}
+				return nil
+			}).Times(2)
+			close(done)
+			wg.Wait()
+			Eventually(closed).Should(Receive())
+			Eventually(closed).Should(Receive())
+		})
 	})
 
 	Context("Doing requests", func() {
@@ -536,33 +1096,457 @@ var _ = Describe("Client", func() {
 			Expect(err).To(MatchError(testErr))
 		})
 
-		DescribeTable(
-			"performs a 0-RTT request",
-			func(method, serialized string) {
-				testErr := errors.New("stream open error")
-				req.Method = method
-				// don't EXPECT any calls to HandshakeComplete()
-				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
-				buf := &bytes.Buffer{}
-				str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
-				str.EXPECT().Close()
-				str.EXPECT().CancelWrite(gomock.Any())
-				str.EXPECT().CancelRead(gomock.Any())
-				str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
-					return 0, testErr
-				})
-				tr := &Transport{}
-				cc := tr.NewClientConn(conn)
-				_, err := cc.RoundTrip(req)
-				Expect(err).To(MatchError(testErr))
-				Expect(decodeHeader(buf)).To(HaveKeyWithValue(":method", serialized))
-				// make sure the request wasn't modified
-				Expect(req.Method).To(Equal(method))
-			},
-			Entry("GET", MethodGet0RTT, http.MethodGet),
-			Entry("HEAD", MethodHead0RTT, http.MethodHead),
-		)
-
+		It("errors if the stream limit is reached for longer than the maximum wait time", func() {
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			conn.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(ctx context.Context) (quic.Stream, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			})
+			tr := &Transport{}
+			cc := tr.NewClientConn(conn)
+			clock := newFakeClock()
+			cc.clock = clock
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := cc.RoundTrip(req.WithContext(context.WithValue(req.Context(), maxStreamWaitKey{}, time.Second)))
+				errChan <- err
+			}()
+			Eventually(clock.ActiveTimers).Should(Equal(1))
+			clock.Advance(time.Second - time.Nanosecond)
+			Consistently(errChan, scaleDuration(10*time.Millisecond)).ShouldNot(Receive())
+			clock.Advance(time.Nanosecond)
+			Eventually(errChan).Should(Receive(MatchError(ErrStreamLimitReached)))
+		})
+
+		It("stops the timer for the maximum wait time once the stream is opened", func() {
+			rspBuf := bytes.NewBuffer(encodeResponse(200))
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+			conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			tr := &Transport{}
+			cc := tr.NewClientConn(conn)
+			clock := newFakeClock()
+			cc.clock = clock
+			_, err := cc.RoundTrip(req.WithContext(context.WithValue(req.Context(), maxStreamWaitKey{}, time.Second)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clock.ActiveTimers()).To(BeZero())
+		})
+
+		It("doesn't wait for the stream limit, if configured", func() {
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			conn.EXPECT().OpenStream().Return(nil, &quic.StreamLimitReachedError{})
+			tr := &Transport{}
+			cc := tr.NewClientConn(conn)
+			_, err := cc.RoundTrip(req.WithContext(context.WithValue(req.Context(), nonBlockingStreamOpenKey{}, true)))
+			Expect(err).To(MatchError(ErrStreamLimitReached))
+		})
+
+		It("returns the context error if the context is canceled while waiting for the stream limit", func() {
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			conn.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(ctx context.Context) (quic.Stream, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			})
+			tr := &Transport{}
+			cc := tr.NewClientConn(conn)
+			ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(10*time.Millisecond))
+			defer cancel()
+			ctx = context.WithValue(ctx, maxStreamWaitKey{}, time.Hour)
+			_, err := cc.RoundTrip(req.WithContext(ctx))
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("counts requests waiting for the stream limit as active", func() {
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			conn.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(ctx context.Context) (quic.Stream, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			})
+			tr := &Transport{}
+			cc := tr.NewClientConn(conn)
+			Expect(cc.ActiveRequests()).To(BeZero())
+			ctx, cancel := context.WithCancel(context.Background())
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := cc.RoundTrip(req.WithContext(ctx))
+				errChan <- err
+			}()
+			Eventually(cc.ActiveRequests).Should(Equal(1))
+			cancel()
+			Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+			Expect(cc.ActiveRequests()).To(BeZero())
+		})
+
+		Context("modifying requests", func() {
+			It("modifies the request before sending it", func() {
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				buf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
+				str.EXPECT().Close()
+				testErr := errors.New("test done")
+				str.EXPECT().Read(gomock.Any()).Return(0, testErr)
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				tr := &Transport{
+					ModifyRequest: func(r *http.Request) error {
+						r.Header.Set("X-Signature", "signed")
+						r.Host = "example.com"
+						return nil
+					},
+				}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError(testErr))
+				hfs := decodeHeader(buf)
+				Expect(hfs).To(HaveKeyWithValue("x-signature", "signed"))
+				Expect(hfs).To(HaveKeyWithValue(":authority", "example.com"))
+				// the original request is not modified
+				Expect(req.Header).ToNot(HaveKey("X-Signature"))
+				Expect(req.Host).To(Equal("quic.clemente.io:1337"))
+			})
+
+			It("aborts the request if modifying it fails", func() {
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+				body := &mockBody{}
+				req.Body = body
+				tr := &Transport{
+					ModifyRequest: func(*http.Request) error { return errors.New("signing failed") },
+				}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError("signing failed"))
+				Expect(body.closed).To(BeTrue())
+			})
+		})
+
+		Context("modifying responses", func() {
+			BeforeEach(func() {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.WriteField(qpack.HeaderField{Name: "x-internal-route", Value: "backend-1"})).To(Succeed())
+				Expect(enc.WriteField(qpack.HeaderField{Name: "x-public", Value: "foobar"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				rspBuf := bytes.NewBuffer((&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil))
+				rspBuf.Write(headerBuf.Bytes())
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			})
+
+			It("modifies the response before returning it", func() {
+				var called bool
+				tr := &Transport{
+					ModifyResponse: func(rsp *http.Response) error {
+						called = true
+						Expect(rsp.Request).ToNot(BeNil())
+						rsp.Header.Del("X-Internal-Route")
+						return nil
+					},
+				}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(called).To(BeTrue())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(rsp.Header).ToNot(HaveKey("X-Internal-Route"))
+				Expect(rsp.Header.Get("X-Public")).To(Equal("foobar"))
+			})
+
+			It("resets the stream if modifying the response fails", func() {
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+				tr := &Transport{
+					ModifyResponse: func(*http.Response) error { return errors.New("invalid response") },
+				}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError("invalid response"))
+			})
+		})
+
+		Context("wire taps", func() {
+			var rspHeaders, rspData []byte
+
+			type tapped struct {
+				dir WireDirection
+				b   []byte
+			}
+
+			BeforeEach(func() {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.WriteField(qpack.HeaderField{Name: "content-length", Value: "6"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				rspHeaders = (&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil)
+				rspHeaders = append(rspHeaders, headerBuf.Bytes()...)
+				rspData = (&dataFrame{Length: 6}).Append(nil)
+				rspData = append(rspData, "foobar"...)
+				rspBuf := bytes.NewBuffer(append(bytes.Clone(rspHeaders), rspData...))
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			})
+
+			roundTrip := func(includeData bool) []tapped {
+				var frames []tapped
+				tap := WireTap(func(dir WireDirection, b []byte) { frames = append(frames, tapped{dir: dir, b: b}) })
+				r := req.WithContext(context.WithValue(req.Context(), wireTapKey{}, wireTapOpt{tap: tap, includeData: includeData}))
+				rsp, err := (&Transport{}).NewClientConn(conn).RoundTrip(r)
+				Expect(err).ToNot(HaveOccurred())
+				body, err := io.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(Equal([]byte("foobar")))
+				return frames
+			}
+
+			It("captures HEADERS frames", func() {
+				frames := roundTrip(false)
+				Expect(frames).To(HaveLen(2))
+				Expect(frames[0].dir).To(Equal(WireOutbound))
+				hfs := decodeHeader(bytes.NewReader(frames[0].b))
+				Expect(hfs).To(HaveKeyWithValue(":method", "GET"))
+				Expect(hfs).To(HaveKeyWithValue(":authority", "quic.clemente.io:1337"))
+				Expect(hfs).To(HaveKeyWithValue(":path", "/file1.dat"))
+				Expect(frames[1]).To(Equal(tapped{dir: WireInbound, b: rspHeaders}))
+			})
+
+			It("captures DATA frames, if enabled", func() {
+				frames := roundTrip(true)
+				Expect(frames[0].dir).To(Equal(WireOutbound))
+				var inbound []byte
+				for _, f := range frames[1:] {
+					Expect(f.dir).To(Equal(WireInbound))
+					inbound = append(inbound, f.b...)
+				}
+				Expect(inbound).To(Equal(append(rspHeaders, rspData...)))
+			})
+		})
+
+		DescribeTable("responses to HEAD requests",
+			func(method string) {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.WriteField(qpack.HeaderField{Name: "content-length", Value: "1337"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				rspBuf := bytes.NewBuffer((&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil))
+				rspBuf.Write(headerBuf.Bytes())
+				done := make(chan struct{})
+				defer close(done)
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				// the server never closes the stream
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+					if rspBuf.Len() > 0 {
+						return rspBuf.Read(b)
+					}
+					<-done
+					return 0, errors.New("test done")
+				}).AnyTimes()
+				req, err := http.NewRequest(method, "https://quic-go.net", nil)
+				Expect(err).ToNot(HaveOccurred())
+				cl := (&Transport{}).NewClientConn(conn)
+				rsp, err := cl.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.ContentLength).To(BeEquivalentTo(1337))
+				Expect(rsp.Header.Get("Content-Length")).To(Equal("1337"))
+				Expect(cl.ActiveRequests()).To(Equal(1))
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeNoError))
+				body, err := io.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(BeEmpty())
+				// the stream is not tracked any more, even though the body wasn't closed yet
+				Expect(cl.ActiveRequests()).To(BeZero())
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+				Expect(rsp.Body.Close()).To(Succeed())
+			},
+			Entry("HEAD", http.MethodHead),
+			Entry("HEAD_0RTT", MethodHead0RTT),
+		)
+
+		It("calls OnStreamOpen when the request stream was opened", func() {
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().Context().Return(context.Background()).AnyTimes()
+			str.EXPECT().StreamID().Return(quic.StreamID(12)).AnyTimes()
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+			conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+			rspBuf := bytes.NewBuffer(encodeResponse(http.StatusOK))
+			var sent bool
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+				sent = true
+				return len(b), nil
+			}).AnyTimes()
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+
+			var called bool
+			tr := &Transport{
+				OnStreamOpen: func(id quic.StreamID, r *http.Request) {
+					called = true
+					Expect(id).To(Equal(quic.StreamID(12)))
+					Expect(r).To(Equal(req))
+					Expect(sent).To(BeFalse()) // called before the request is sent
+				},
+			}
+			rsp, err := tr.NewClientConn(conn).RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+			Expect(called).To(BeTrue())
+		})
+
+		It("uses the response header size limit set for a single request", func() {
+			headerBuf := &bytes.Buffer{}
+			enc := qpack.NewEncoder(headerBuf)
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+			Expect(enc.WriteField(qpack.HeaderField{Name: "foo", Value: strings.Repeat("a", 100)})).To(Succeed())
+			Expect(enc.Close()).To(Succeed())
+			Expect(headerBuf.Len()).To(BeNumerically(">", 50))
+			rspBuf := bytes.NewBuffer((&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil))
+			rspBuf.Write(headerBuf.Bytes())
+
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().Context().Return(context.Background()).AnyTimes()
+			str.EXPECT().StreamID().AnyTimes()
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+			conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(b []byte) (int, error) { return len(b), nil }).AnyTimes()
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+
+			cc := (&Transport{MaxResponseHeaderBytes: 50}).NewClientConn(conn)
+			req := req.WithContext(context.WithValue(req.Context(), maxResponseHeaderBytesKey{}, int64(1000)))
+			rsp, err := cc.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+			Expect(rsp.Header.Get("foo")).To(HaveLen(100))
+		})
+
+		It("retries a request from an interceptor", func() {
+			str2 := mockquic.NewMockStream(mockCtrl)
+			str2.EXPECT().Context().Return(context.Background()).AnyTimes()
+			str2.EXPECT().StreamID().AnyTimes()
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).Times(2)
+			conn.EXPECT().ConnectionState().Return(quic.ConnectionState{}).Times(2)
+			gomock.InOrder(
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str2, nil),
+			)
+			// the first attempt is rejected with a 401
+			buf1 := &bytes.Buffer{}
+			rspBuf1 := bytes.NewBuffer(encodeResponse(http.StatusUnauthorized))
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(buf1.Write).AnyTimes()
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf1.Read).AnyTimes()
+			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			// the second attempt succeeds
+			buf2 := &bytes.Buffer{}
+			rspBuf2 := bytes.NewBuffer(encodeResponse(http.StatusOK))
+			str2.EXPECT().Write(gomock.Any()).DoAndReturn(buf2.Write).AnyTimes()
+			str2.EXPECT().Close()
+			str2.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf2.Read).AnyTimes()
+
+			token := "expired"
+			var attempts int
+			tr := &Transport{
+				Interceptor: func(next RoundTripFunc) RoundTripFunc {
+					return func(r *http.Request) (*http.Response, error) {
+						for {
+							attempts++
+							r.Header.Set("Authorization", "Bearer "+token)
+							rsp, err := next(r)
+							if err != nil || rsp.StatusCode != http.StatusUnauthorized || attempts > 1 {
+								return rsp, err
+							}
+							rsp.Body.Close()
+							token = "refreshed"
+						}
+					}
+				},
+			}
+			cc := tr.NewClientConn(conn)
+			rsp, err := cc.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+			Expect(attempts).To(Equal(2))
+			Expect(decodeHeader(buf1)).To(HaveKeyWithValue("authorization", "Bearer expired"))
+			Expect(decodeHeader(buf2)).To(HaveKeyWithValue("authorization", "Bearer refreshed"))
+		})
+
+		DescribeTable(
+			"performs a 0-RTT request",
+			func(method, serialized string) {
+				testErr := errors.New("stream open error")
+				req.Method = method
+				// don't wait for the handshake to complete
+				conn.EXPECT().HandshakeComplete().Return(make(chan struct{}))
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				buf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().CancelWrite(gomock.Any())
+				str.EXPECT().CancelRead(gomock.Any())
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
+					return 0, testErr
+				})
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError(testErr))
+				Expect(decodeHeader(buf)).To(HaveKeyWithValue(":method", serialized))
+				// make sure the request wasn't modified
+				Expect(req.Method).To(Equal(method))
+			},
+			Entry("GET", MethodGet0RTT, http.MethodGet),
+			Entry("HEAD", MethodHead0RTT, http.MethodHead),
+		)
+
+		DescribeTable(
+			"reports if a response was served over 0-RTT",
+			func(method string, handshakeCompleted, used0RTT, expected bool) {
+				req.Method = method
+				rspBuf := bytes.NewBuffer(encodeResponse(200))
+				hsChan := make(chan struct{})
+				if handshakeCompleted {
+					close(hsChan)
+				}
+				conn.EXPECT().HandshakeComplete().Return(hsChan).AnyTimes()
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{Used0RTT: used0RTT})
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ServedOver0RTT(rsp)).To(Equal(expected))
+			},
+			Entry("0-RTT accepted", MethodGet0RTT, false, true, true),
+			Entry("0-RTT rejected", MethodGet0RTT, false, false, false),
+			Entry("handshake already completed", MethodGet0RTT, true, true, false),
+			Entry("not a 0-RTT request", http.MethodGet, true, true, false),
+		)
+
 		It("returns a response", func() {
 			rspBuf := bytes.NewBuffer(encodeResponse(418))
 			gomock.InOrder(
@@ -583,6 +1567,205 @@ var _ = Describe("Client", func() {
 			Expect(rsp.Request).ToNot(BeNil())
 		})
 
+		It("records the request timings", func() {
+			clock := newFakeClock()
+			start := clock.Now()
+			rspBuf := bytes.NewBuffer(encodeResponse(200))
+			gomock.InOrder(
+				conn.EXPECT().HandshakeComplete().DoAndReturn(func() <-chan struct{} {
+					clock.Advance(time.Second)
+					return handshakeChan
+				}),
+				conn.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+					clock.Advance(time.Second)
+					return str, nil
+				}),
+				conn.EXPECT().ConnectionState().DoAndReturn(func() quic.ConnectionState {
+					clock.Advance(time.Second)
+					return quic.ConnectionState{}
+				}),
+			)
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+				clock.Advance(time.Second)
+				return rspBuf.Read(b[:1]) // one byte at a time
+			}).Times(1)
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			tr := &Transport{}
+			cc := tr.NewClientConn(conn)
+			cc.clock = clock
+			rsp, err := cc.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			timings, ok := RequestTimings(rsp)
+			Expect(ok).To(BeTrue())
+			Expect(timings.Start).To(Equal(start))
+			Expect(timings.ConnReady).To(Equal(start.Add(time.Second)))
+			// the stream was opened after 2s, and the first byte was received after 3s
+			Expect(timings.FirstResponseByte).To(Equal(start.Add(3 * time.Second)))
+			Expect(timings.Headers).To(Equal(start.Add(4 * time.Second)))
+			Expect(timings.TimeToFirstByte()).To(Equal(3 * time.Second))
+			Expect(timings.TimeToHeaders()).To(Equal(4 * time.Second))
+			Expect(timings.BodyDone).To(BeZero())
+
+			clock.Advance(time.Second)
+			_, err = io.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			timings, ok = RequestTimings(rsp)
+			Expect(ok).To(BeTrue())
+			Expect(timings.BodyDone).To(Equal(start.Add(5 * time.Second)))
+
+			_, ok = RequestTimings(&http.Response{Body: io.NopCloser(&bytes.Buffer{})})
+			Expect(ok).To(BeFalse())
+		})
+
+		It("keeps the request stream of CONNECT requests open, if requested", func() {
+			req.Method = http.MethodConnect
+			req = req.WithContext(context.WithValue(req.Context(), dontCloseRequestStreamKey{}, true))
+			rspBuf := bytes.NewBuffer(encodeResponse(200))
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+			conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+			buf := &bytes.Buffer{}
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			tr := &Transport{}
+			cc := tr.NewClientConn(conn)
+			rsp, err := cc.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			decodeHeader(buf)
+
+			w := RequestStreamWriter(rsp)
+			Expect(w).ToNot(BeNil())
+			capsule := &bytes.Buffer{}
+			Expect(WriteCapsule(capsule, 1337, []byte("foobar"))).To(Succeed())
+			_, err = w.Write(capsule.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			// the capsule is sent in a DATA frame
+			fp := frameParser{r: buf}
+			frame, err := fp.ParseNext()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&dataFrame{Length: uint64(capsule.Len())}))
+			Expect(buf.Bytes()).To(Equal(capsule.Bytes()))
+
+			str.EXPECT().Close()
+			Expect(w.Close()).To(Succeed())
+		})
+
+		DescribeTable(
+			"closes the request stream",
+			func(method string, status int, dontClose bool) {
+				req.Method = method
+				if dontClose {
+					req = req.WithContext(context.WithValue(req.Context(), dontCloseRequestStreamKey{}, true))
+				}
+				rspBuf := bytes.NewBuffer(encodeResponse(status))
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(status))
+				Expect(RequestStreamWriter(rsp)).To(BeNil())
+			},
+			Entry("CONNECT request", http.MethodConnect, 200, false),
+			Entry("unsuccessful CONNECT request", http.MethodConnect, 403, true),
+			Entry("non-CONNECT request", http.MethodGet, 200, true),
+		)
+
+		Context("responses with a :protocol pseudo header field", func() {
+			var rspBuf *bytes.Buffer
+
+			BeforeEach(func() {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":protocol", Value: "webtransport"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				rspBuf = bytes.NewBuffer((&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil))
+				rspBuf.Write(headerBuf.Bytes())
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			})
+
+			It("captures the protocol for CONNECT requests", func() {
+				req.Method = http.MethodConnect
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(ResponseProtocol(rsp)).To(Equal("webtransport"))
+			})
+
+			It("rejects the response for other requests", func() {
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeMessageError))
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeMessageError))
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError("http3: invalid response: invalid response pseudo header: :protocol"))
+			})
+		})
+
+		It("traces QPACK events", func() {
+			rspBuf := bytes.NewBuffer(encodeResponse(418))
+			gomock.InOrder(
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan),
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{}),
+			)
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			var events []QPACKEvent
+			tr := &Transport{QPACKTracer: func(ev QPACKEvent) { events = append(events, ev) }}
+			cc := tr.NewClientConn(conn)
+			req.Header.Set("X-Foo", "bar")
+			rsp, err := cc.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(418))
+			Expect(events).To(HaveLen(2))
+			Expect(events[0].Type).To(Equal(QPACKEventHeadersEncoded))
+			Expect(events[0].HeaderBlockLen).ToNot(BeZero())
+			Expect(events[0].Fields).To(ContainElement(qpack.HeaderField{Name: ":method", Value: http.MethodGet}))
+			Expect(events[0].Fields).To(ContainElement(qpack.HeaderField{Name: "x-foo", Value: "bar"}))
+			Expect(events[1].Type).To(Equal(QPACKEventHeadersDecoded))
+			Expect(events[1].HeaderBlockLen).ToNot(BeZero())
+			Expect(events[1].Fields).To(ContainElement(qpack.HeaderField{Name: ":status", Value: "418"}))
+		})
+
+		It("limits the size of the response body", func() {
+			rspBuf := bytes.NewBuffer(encodeResponse(200))
+			rspBuf.Write(getDataFrame(make([]byte, 1000)))
+			gomock.InOrder(
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan),
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{}),
+			)
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			tr := &Transport{MaxResponseBodySize: 999}
+			cc := tr.NewClientConn(conn)
+			rsp, err := cc.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := io.ReadAll(rsp.Body)
+			Expect(err).To(MatchError(ErrResponseBodyTooLarge))
+			Expect(data).To(HaveLen(999))
+		})
+
 		It("returns a response with trailers", func() {
 			rspBuf := bytes.NewBuffer(encodeResponse(418))
 
@@ -615,6 +1798,53 @@ var _ = Describe("Client", func() {
 			Expect(rsp.Request).ToNot(BeNil())
 		})
 
+		Context("raw response header fields", func() {
+			var rspBuf *bytes.Buffer
+			fields := []qpack.HeaderField{
+				{Name: ":status", Value: "200"},
+				{Name: "x-second", Value: "foo"},
+				{Name: "x-first", Value: "bar"},
+				{Name: "x-second", Value: "baz"},
+			}
+
+			BeforeEach(func() {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				for _, f := range fields {
+					Expect(enc.WriteField(f)).To(Succeed())
+				}
+				Expect(enc.Close()).To(Succeed())
+				rspBuf = bytes.NewBuffer((&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil))
+				rspBuf.Write(headerBuf.Bytes())
+
+				gomock.InOrder(
+					conn.EXPECT().HandshakeComplete().Return(handshakeChan),
+					conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+					conn.EXPECT().ConnectionState().Return(quic.ConnectionState{}),
+				)
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			})
+
+			It("preserves the order of the header fields", func() {
+				tr := &Transport{PreserveRawResponseHeaders: true}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Header).To(HaveKeyWithValue("X-Second", []string{"foo", "baz"}))
+				Expect(RawResponseHeaderFields(rsp)).To(Equal(fields))
+			})
+
+			It("doesn't retain the header fields by default", func() {
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(RawResponseHeaderFields(rsp)).To(BeNil())
+			})
+		})
+
 		It("errors on invalid HEADERS frames", func() {
 			rspBuf := bytes.NewBuffer(encodeResponse(418))
 
@@ -724,6 +1954,188 @@ var _ = Describe("Client", func() {
 			Expect(rsp.Request).ToNot(BeNil())
 		})
 
+		Context("stream resets", func() {
+			BeforeEach(func() {
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+			})
+
+			DescribeTable("returns a StreamError when the server resets the stream",
+				func(code ErrCode) {
+					str.EXPECT().Read(gomock.Any()).Return(0, &quic.StreamError{Remote: true, ErrorCode: quic.StreamErrorCode(code)}).AnyTimes()
+					tr := &Transport{}
+					cc := tr.NewClientConn(conn)
+					_, err := cc.RoundTrip(req)
+					var strErr *StreamError
+					Expect(errors.As(err, &strErr)).To(BeTrue())
+					Expect(strErr.ErrorCode).To(Equal(code))
+					var h3Err *Error
+					Expect(errors.As(err, &h3Err)).To(BeTrue())
+					Expect(h3Err.ErrorCode).To(Equal(code))
+					Expect(h3Err.Remote).To(BeTrue())
+				},
+				Entry("H3_REQUEST_REJECTED", ErrCodeRequestRejected),
+				Entry("H3_REQUEST_CANCELLED", ErrCodeRequestCanceled),
+				Entry("H3_INTERNAL_ERROR", ErrCodeInternalError),
+				Entry("H3_EXCESSIVE_LOAD", ErrCodeExcessiveLoad),
+				Entry("H3_REQUEST_INCOMPLETE", ErrCodeRequestIncomplete),
+				Entry("H3_NO_ERROR", ErrCodeNoError),
+				Entry("unknown error code", ErrCode(0x1337)),
+			)
+
+			It("doesn't return a StreamError when the stream is reset locally", func() {
+				str.EXPECT().Read(gomock.Any()).Return(0, &quic.StreamError{Remote: false, ErrorCode: quic.StreamErrorCode(ErrCodeRequestCanceled)}).AnyTimes()
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				var strErr *StreamError
+				Expect(errors.As(err, &strErr)).To(BeFalse())
+				Expect(err).To(Equal(&Error{ErrorCode: ErrCodeRequestCanceled}))
+			})
+		})
+
+		Context("connection closures", func() {
+			// readUntilError returns a Read function that returns the data, and then fails with the error
+			readUntilError := func(data []byte, err error) func([]byte) (int, error) {
+				r := bytes.NewReader(data)
+				return func(b []byte) (int, error) {
+					if r.Len() == 0 {
+						return 0, err
+					}
+					return r.Read(b)
+				}
+			}
+
+			BeforeEach(func() {
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+			})
+
+			It("returns a ConnectionError when the idle timeout fires while reading the HEADERS frame", func() {
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(readUntilError(nil, &quic.IdleTimeoutError{})).AnyTimes()
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeFrameError))
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeFrameError))
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				var connErr *ConnectionError
+				Expect(errors.As(err, &connErr)).To(BeTrue())
+				Expect(connErr.Timeout()).To(BeTrue())
+				Expect(connErr.Err).To(MatchError(&quic.IdleTimeoutError{}))
+			})
+
+			It("returns a ConnectionError when a stateless reset is received while reading the header block", func() {
+				b := encodeResponse(200)
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(readUntilError(b[:len(b)-1], &quic.StatelessResetError{})).AnyTimes()
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestIncomplete))
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestIncomplete))
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				var connErr *ConnectionError
+				Expect(errors.As(err, &connErr)).To(BeTrue())
+				Expect(connErr.Timeout()).To(BeFalse())
+				Expect(errors.Is(err, net.ErrClosed)).To(BeTrue())
+			})
+
+			It("returns a ConnectionError when a transport error occurs while reading the body", func() {
+				b := encodeResponse(200)
+				b = (&dataFrame{Length: 6}).Append(b)
+				b = append(b, []byte("foo")...)
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(readUntilError(b, &quic.TransportError{ErrorCode: quic.FlowControlError})).AnyTimes()
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				body, err := io.ReadAll(rsp.Body)
+				Expect(body).To(Equal([]byte("foo")))
+				var connErr *ConnectionError
+				Expect(errors.As(err, &connErr)).To(BeTrue())
+				var transportErr *quic.TransportError
+				Expect(errors.As(err, &transportErr)).To(BeTrue())
+				Expect(transportErr.ErrorCode).To(Equal(quic.FlowControlError))
+				Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+			})
+
+			It("returns an Error when the server closes the connection with an HTTP/3 error code", func() {
+				b := encodeResponse(200)
+				b = (&dataFrame{Length: 6}).Append(b)
+				b = append(b, []byte("foo")...)
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(readUntilError(b, &quic.ApplicationError{Remote: true, ErrorCode: quic.ApplicationErrorCode(ErrCodeNoError)})).AnyTimes()
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = io.ReadAll(rsp.Body)
+				var h3Err *Error
+				Expect(errors.As(err, &h3Err)).To(BeTrue())
+				Expect(h3Err).To(Equal(&Error{Remote: true, ErrorCode: ErrCodeNoError}))
+				Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+			})
+
+			It("returns an io.ErrUnexpectedEOF when the server resets the stream while sending the body", func() {
+				b := encodeResponse(200)
+				b = (&dataFrame{Length: 6}).Append(b)
+				b = append(b, []byte("foo")...)
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(readUntilError(b, &quic.StreamError{Remote: true, ErrorCode: quic.StreamErrorCode(ErrCodeInternalError)})).AnyTimes()
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				body, err := io.ReadAll(rsp.Body)
+				Expect(body).To(Equal([]byte("foo")))
+				Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+				var h3Err *Error
+				Expect(errors.As(err, &h3Err)).To(BeTrue())
+				Expect(h3Err.ErrorCode).To(Equal(ErrCodeInternalError))
+			})
+
+			It("returns an io.ErrUnexpectedEOF when the body is shorter than the Content-Length", func() {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.WriteField(qpack.HeaderField{Name: "content-length", Value: "6"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				b := (&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil)
+				b = append(b, headerBuf.Bytes()...)
+				b = (&dataFrame{Length: 3}).Append(b)
+				b = append(b, []byte("foo")...)
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(readUntilError(b, io.EOF)).AnyTimes()
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				body, err := io.ReadAll(rsp.Body)
+				Expect(body).To(Equal([]byte("foo")))
+				Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+			})
+
+			It("returns io.EOF when the body is complete", func() {
+				b := encodeResponse(200)
+				b = (&dataFrame{Length: 3}).Append(b)
+				b = append(b, []byte("foo")...)
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(readUntilError(b, io.EOF)).AnyTimes()
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				body, err := io.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(Equal([]byte("foo")))
+			})
+		})
+
 		Context("requests containing a Body", func() {
 			var strBuf *bytes.Buffer
 
@@ -764,29 +2176,56 @@ var _ = Describe("Client", func() {
 				Expect(hfs).To(HaveKeyWithValue(":path", "/upload"))
 			})
 
+			It("sends a request with an empty body", func() {
+				req.Body = http.NoBody
+				req.ContentLength = 0
+				done := make(chan struct{})
+				gomock.InOrder(
+					str.EXPECT().Close().Do(func() error { close(done); return nil }),
+					// when reading the response errors
+					str.EXPECT().CancelRead(gomock.Any()).MaxTimes(1),
+					str.EXPECT().CancelWrite(gomock.Any()).MaxTimes(1),
+				)
+				testErr := errors.New("test done")
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
+					<-done
+					return 0, testErr
+				})
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError(testErr))
+				hfs := decodeHeader(strBuf)
+				Expect(hfs).To(HaveKeyWithValue("content-length", "0"))
+				// only the HEADERS frame was sent
+				Expect(strBuf.Len()).To(BeZero())
+			})
+
 			It("doesn't send more bytes than allowed by http.Request.ContentLength", func() {
 				req.ContentLength = 7
-				var once sync.Once
-				done := make(chan struct{})
-				str.EXPECT().CancelRead(gomock.Any())
+				canceled := make(chan struct{})
 				gomock.InOrder(
-					str.EXPECT().CancelWrite(gomock.Any()).Do(func(c quic.StreamErrorCode) {
-						once.Do(func() {
-							Expect(c).To(Equal(quic.StreamErrorCode(ErrCodeRequestCanceled)))
-							close(done)
-						})
-					}).AnyTimes(),
+					str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled)),
+					// the request is aborted, so reading the response fails
+					str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled)).Do(func(quic.StreamErrorCode) {
+						close(canceled)
+					}),
 					str.EXPECT().Close().MaxTimes(1),
-					str.EXPECT().CancelWrite(gomock.Any()).AnyTimes(),
 				)
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
 				str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
-					<-done
-					return 0, errors.New("done")
+					<-canceled
+					return 0, &quic.StreamError{ErrorCode: quic.StreamErrorCode(ErrCodeRequestCanceled)}
 				})
 				tr := &Transport{}
 				cc := tr.NewClientConn(conn)
 				_, err := cc.RoundTrip(req)
-				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError("http: ContentLength=7 with Body length 12"))
+				var tooLongErr *BodyTooLongError
+				Expect(errors.As(err, &tooLongErr)).To(BeTrue())
+				Expect(tooLongErr.ContentLength).To(BeEquivalentTo(7))
+				Expect(tooLongErr.BodyLength).To(BeEquivalentTo(12))
 				Expect(strBuf.String()).To(ContainSubstring("request"))
 				Expect(strBuf.String()).ToNot(ContainSubstring("request body"))
 			})
@@ -817,6 +2256,40 @@ var _ = Describe("Client", func() {
 				Eventually(closed).Should(BeClosed())
 			})
 
+			It("aborts sending the body with the error code of the body's error", func() {
+				pr, pw := io.Pipe()
+				req.Body = pr
+				req.ContentLength = -1
+				canceled := make(chan struct{})
+				str.EXPECT().CancelRead(gomock.Any())
+				gomock.InOrder(
+					str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestIncomplete)).Do(func(quic.StreamErrorCode) {
+						close(canceled)
+					}),
+					str.EXPECT().CancelWrite(gomock.Any()),
+				)
+				testErr := errors.New("test done")
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
+					<-canceled
+					return 0, testErr
+				})
+				str.EXPECT().Close()
+				go func() {
+					defer GinkgoRecover()
+					_, err := pw.Write([]byte("foobar"))
+					Expect(err).ToNot(HaveOccurred())
+					pw.CloseWithError(&Error{ErrorCode: ErrCodeRequestIncomplete})
+				}()
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError(testErr))
+				// the body data was sent before aborting
+				hfs := decodeHeader(strBuf)
+				Expect(hfs).To(HaveKeyWithValue(":method", "POST"))
+				Expect(strBuf.Bytes()).To(Equal(append((&dataFrame{Length: 6}).Append(nil), []byte("foobar")...)))
+			})
+
 			It("closes the connection when the first frame is not a HEADERS frame", func() {
 				b := (&dataFrame{Length: 0x42}).Append(nil)
 				conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), gomock.Any())
@@ -852,6 +2325,104 @@ var _ = Describe("Client", func() {
 				Eventually(closed).Should(BeClosed())
 			})
 
+			DescribeTable("cancels the stream when the status is invalid",
+				func(status string) {
+					headerBuf := &bytes.Buffer{}
+					enc := qpack.NewEncoder(headerBuf)
+					Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: status})).To(Succeed())
+					Expect(enc.Close()).To(Succeed())
+					b := (&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil)
+					b = append(b, headerBuf.Bytes()...)
+
+					r := bytes.NewReader(b)
+					str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeMessageError))
+					str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeMessageError))
+					closed := make(chan struct{})
+					str.EXPECT().Close().Do(func() error { close(closed); return nil })
+					str.EXPECT().Read(gomock.Any()).DoAndReturn(r.Read).AnyTimes()
+					tr := &Transport{}
+					cc := tr.NewClientConn(conn)
+					_, err := cc.RoundTrip(req)
+					Expect(err).To(MatchError(ContainSubstring("invalid status code")))
+					Eventually(closed).Should(BeClosed())
+				},
+				Entry("below 100", "099"),
+				Entry("above 599", "600"),
+				Entry("not a number", "abc"),
+			)
+
+			It("cancels the stream when the response has too many header fields", func() {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				for i := 0; i < 5000; i++ {
+					Expect(enc.WriteField(qpack.HeaderField{Name: "x-field", Value: strconv.Itoa(i)})).To(Succeed())
+				}
+				Expect(enc.Close()).To(Succeed())
+				b := (&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil)
+				b = append(b, headerBuf.Bytes()...)
+
+				r := bytes.NewReader(b)
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeExcessiveLoad))
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeExcessiveLoad))
+				closed := make(chan struct{})
+				str.EXPECT().Close().Do(func() error { close(closed); return nil })
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(r.Read).AnyTimes()
+				tr := &Transport{MaxResponseHeaderFields: 1000}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError("http3: too many response header fields (max: 1000)"))
+				Eventually(closed).Should(BeClosed())
+				// the header block is not read completely
+				Expect(r.Len()).ToNot(BeZero())
+			})
+
+			It("cancels the stream when the response has contradicting Content-Length headers", func() {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.WriteField(qpack.HeaderField{Name: "content-length", Value: "42"})).To(Succeed())
+				Expect(enc.WriteField(qpack.HeaderField{Name: "content-length", Value: "1337"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				b := (&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil)
+				b = append(b, headerBuf.Bytes()...)
+
+				r := bytes.NewReader(b)
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeMessageError))
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeMessageError))
+				closed := make(chan struct{})
+				str.EXPECT().Close().Do(func() error { close(closed); return nil })
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(r.Read).AnyTimes()
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError(ContainSubstring("contradicting content lengths (42 and 1337)")))
+				Eventually(closed).Should(BeClosed())
+			})
+
+			It("cancels the stream when the response has a Transfer-Encoding header", func() {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.WriteField(qpack.HeaderField{Name: "content-length", Value: "42"})).To(Succeed())
+				Expect(enc.WriteField(qpack.HeaderField{Name: "transfer-encoding", Value: "chunked"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				b := (&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil)
+				b = append(b, headerBuf.Bytes()...)
+
+				r := bytes.NewReader(b)
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeMessageError))
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeMessageError))
+				closed := make(chan struct{})
+				str.EXPECT().Close().Do(func() error { close(closed); return nil })
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(r.Read).AnyTimes()
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError(`http3: invalid response: invalid header field name: "transfer-encoding"`))
+				Eventually(closed).Should(BeClosed())
+			})
+
 			It("cancels the stream when the HEADERS frame is too large", func() {
 				tr := &Transport{MaxResponseHeaderBytes: 1337}
 				cc := tr.NewClientConn(conn)
@@ -882,6 +2453,82 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		Context("flushing request bodies", func() {
+			var (
+				writes chan []byte
+				bodyW  *io.PipeWriter
+			)
+
+			BeforeEach(func() {
+				writes = make(chan []byte, 100)
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+					writes <- append([]byte{}, b...)
+					return len(b), nil
+				}).AnyTimes()
+				str.EXPECT().Close().AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				testErr := errors.New("test done")
+				str.EXPECT().Read(gomock.Any()).Return(0, testErr).AnyTimes()
+				var body *io.PipeReader
+				body, bodyW = io.Pipe()
+				var err error
+				req, err = http.NewRequest(http.MethodPost, "https://quic.clemente.io:1337/upload", body)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			// receiveData returns the payload of the next DATA frame written to the stream.
+			// The frame header might be written in the same Write call as the payload.
+			receiveData := func() []byte {
+				var hdr []byte
+				EventuallyWithOffset(1, writes).Should(Receive(&hdr))
+				r := bytes.NewReader(hdr)
+				frame, err := (&frameParser{r: r}).ParseNext()
+				ExpectWithOffset(1, err).ToNot(HaveOccurred())
+				ExpectWithOffset(1, frame).To(BeAssignableToTypeOf(&dataFrame{}))
+				data := hdr[len(hdr)-r.Len():]
+				if len(data) == 0 {
+					EventuallyWithOffset(1, writes).Should(Receive(&data))
+				}
+				ExpectWithOffset(1, data).To(HaveLen(int(frame.(*dataFrame).Length)))
+				return data
+			}
+
+			It("sends every chunk immediately by default", func() {
+				cc := (&Transport{}).NewClientConn(conn)
+				go cc.RoundTrip(req)
+				Eventually(writes).Should(Receive()) // HEADERS frame
+				bodyW.Write([]byte("foo"))
+				Expect(receiveData()).To(Equal([]byte("foo")))
+				bodyW.Write([]byte("bar"))
+				Expect(receiveData()).To(Equal([]byte("bar")))
+				bodyW.Close()
+			})
+
+			It("buffers data for the flush interval", func() {
+				const interval = time.Second
+				clock := newFakeClock()
+				cc := (&Transport{FlushInterval: interval}).NewClientConn(conn)
+				cc.clock = clock
+				go cc.RoundTrip(req)
+				Eventually(writes).Should(Receive()) // HEADERS frame
+				bodyW.Write([]byte("foobar"))
+				// the timer is started once the data was written to the buffer
+				Eventually(clock.ActiveTimers).Should(Equal(1))
+				clock.Advance(interval - time.Nanosecond)
+				Expect(writes).ToNot(Receive())
+				clock.Advance(time.Nanosecond)
+				Expect(receiveData()).To(Equal([]byte("foobar")))
+				// data buffered when the body ends is sent right away
+				bodyW.Write([]byte("baz"))
+				bodyW.Close()
+				Expect(receiveData()).To(Equal([]byte("baz")))
+				Expect(clock.ActiveTimers()).To(BeZero())
+			})
+		})
+
 		Context("request cancellations", func() {
 			It("cancels a request while waiting for the handshake to complete", func() {
 				ctx, cancel := context.WithCancel(context.Background())
@@ -929,6 +2576,67 @@ var _ = Describe("Client", func() {
 				Eventually(done).Should(BeClosed())
 			})
 
+			It("closes a blocked request body when the request is canceled", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(ctx).Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close().AnyTimes()
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled)).MinTimes(1)
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
+					<-ctx.Done()
+					return 0, errors.New("test done")
+				}).AnyTimes()
+
+				// the body never returns any data, and only unblocks when it is closed
+				body, bodyW := io.Pipe()
+				defer bodyW.Close()
+				bodyReturned := make(chan error, 1)
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://quic.clemente.io:1337/upload", &readerFunc{
+					read: func(b []byte) (int, error) {
+						n, err := body.Read(b)
+						if err != nil {
+							bodyReturned <- err
+						}
+						return n, err
+					},
+					close: body.Close,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				cc := (&Transport{}).NewClientConn(conn)
+				errChan := make(chan error, 1)
+				go func() {
+					_, err := cc.RoundTrip(req)
+					errChan <- err
+				}()
+				Consistently(bodyReturned).ShouldNot(Receive())
+				cancel()
+				Eventually(bodyReturned).Should(Receive(MatchError(io.ErrClosedPipe)))
+				Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+			})
+
+			It("applies the deadline of the request context to the stream", func() {
+				deadline := time.Now().Add(time.Hour)
+				ctx, cancel := context.WithDeadline(context.Background(), deadline)
+				defer cancel()
+				req := req.WithContext(ctx)
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().OpenStreamSync(ctx).Return(str, nil)
+				str.EXPECT().SetDeadline(deadline)
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().CancelRead(gomock.Any()).MaxTimes(1)
+				str.EXPECT().CancelWrite(gomock.Any()).MaxTimes(1)
+				str.EXPECT().Read(gomock.Any()).Return(0, errors.New("test done"))
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError(ContainSubstring("test done")))
+			})
+
 			It("cancels a request after the response arrived", func() {
 				rspBuf := bytes.NewBuffer(encodeResponse(404))
 
@@ -999,6 +2707,27 @@ var _ = Describe("Client", func() {
 				Expect(hfs).ToNot(HaveKey("accept-encoding"))
 			})
 
+			It("doesn't add gzip if compression is disabled for the request", func() {
+				conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				buf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write)
+				gomock.InOrder(
+					str.EXPECT().Close(),
+					// when the Read errors
+					str.EXPECT().CancelRead(gomock.Any()).MaxTimes(1),
+					str.EXPECT().CancelWrite(gomock.Any()).MaxTimes(1),
+				)
+				testErr := errors.New("test done")
+				str.EXPECT().Read(gomock.Any()).Return(0, testErr)
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				req = req.WithContext(context.WithValue(req.Context(), disableCompressionKey{}, true))
+				_, err := cc.RoundTrip(req)
+				Expect(err).To(MatchError(testErr))
+				hfs := decodeHeader(buf)
+				Expect(hfs).ToNot(HaveKey("accept-encoding"))
+			})
+
 			It("decompresses the response", func() {
 				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
 				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
@@ -1028,6 +2757,37 @@ var _ = Describe("Client", func() {
 				Expect(rsp.Uncompressed).To(BeTrue())
 			})
 
+			It("limits the size of the decompressed response", func() {
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				buf := &bytes.Buffer{}
+				rstr := mockquic.NewMockStream(mockCtrl)
+				rstr.EXPECT().StreamID().AnyTimes()
+				rstr.EXPECT().Write(gomock.Any()).Do(buf.Write).AnyTimes()
+				rw := newResponseWriter(newStream(rstr, nil, nil, func(r io.Reader, u uint64) error { return nil }), nil, false, nil)
+				rw.Header().Set("Content-Encoding", "gzip")
+				gz := gzip.NewWriter(rw)
+				gz.Write(make([]byte, 1<<20)) // compresses to about 1 KB
+				gz.Close()
+				rw.Flush()
+				Expect(buf.Len()).To(BeNumerically("<", 10000))
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+
+				tr := &Transport{MaxDecompressedSize: 100000}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				data, err := io.ReadAll(rsp.Body)
+				Expect(err).To(MatchError(ErrDecompressedSizeExceeded))
+				Expect(data).To(HaveLen(100000))
+				// the error is sticky
+				_, err = rsp.Body.Read([]byte{0})
+				Expect(err).To(MatchError(ErrDecompressedSizeExceeded))
+			})
+
 			It("only decompresses the response if the response contains the right content-encoding header", func() {
 				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
 				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
@@ -1051,6 +2811,86 @@ var _ = Describe("Client", func() {
 				Expect(string(data)).To(Equal("not gzipped"))
 				Expect(rsp.Header.Get("Content-Encoding")).To(BeEmpty())
 			})
+
+			It("sends the configured Accept-Encoding, and doesn't decompress the response", func() {
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				buf := &bytes.Buffer{}
+				rstr := mockquic.NewMockStream(mockCtrl)
+				rstr.EXPECT().StreamID().AnyTimes()
+				rstr.EXPECT().Write(gomock.Any()).Do(buf.Write).AnyTimes()
+				rw := newResponseWriter(newStream(rstr, nil, nil, func(r io.Reader, u uint64) error { return nil }), nil, false, nil)
+				rw.Header().Set("Content-Encoding", "gzip")
+				gz := gzip.NewWriter(rw)
+				gz.Write([]byte("gzipped response"))
+				gz.Close()
+				rw.Flush()
+				reqBuf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(reqBuf.Write).AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().Close()
+
+				tr := &Transport{AcceptEncoding: "gzip"}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(decodeHeader(reqBuf)).To(HaveKeyWithValue("accept-encoding", "gzip"))
+				Expect(rsp.Header.Get("Content-Encoding")).To(Equal("gzip"))
+				Expect(rsp.Uncompressed).To(BeFalse())
+				zr, err := gzip.NewReader(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				data, err := io.ReadAll(zr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(data)).To(Equal("gzipped response"))
+			})
+
+			DescribeTable("decompressing responses to requests with a user-supplied Accept-Encoding",
+				func(enabled bool, acceptEncoding, contentEncoding string, expectDecoded bool) {
+					conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+					conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+					buf := &bytes.Buffer{}
+					rstr := mockquic.NewMockStream(mockCtrl)
+					rstr.EXPECT().StreamID().AnyTimes()
+					rstr.EXPECT().Write(gomock.Any()).Do(buf.Write).AnyTimes()
+					rw := newResponseWriter(newStream(rstr, nil, nil, func(r io.Reader, u uint64) error { return nil }), nil, false, nil)
+					rw.Header().Set("Content-Encoding", contentEncoding)
+					// For simplicity, the body is always gzipped, no matter what the Content-Encoding says.
+					gz := gzip.NewWriter(rw)
+					gz.Write([]byte("compressed response"))
+					gz.Close()
+					rw.Flush()
+					str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+					str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+					str.EXPECT().Close()
+
+					tr := &Transport{DecompressAcceptedEncodings: enabled}
+					cc := tr.NewClientConn(conn)
+					req.Header.Set("Accept-Encoding", acceptEncoding)
+					rsp, err := cc.RoundTrip(req)
+					Expect(err).ToNot(HaveOccurred())
+					data, err := io.ReadAll(rsp.Body)
+					Expect(err).ToNot(HaveOccurred())
+					if expectDecoded {
+						Expect(string(data)).To(Equal("compressed response"))
+						Expect(rsp.Header.Get("Content-Encoding")).To(BeEmpty())
+						Expect(rsp.Uncompressed).To(BeTrue())
+						Expect(rsp.ContentLength).To(BeEquivalentTo(-1))
+					} else {
+						Expect(string(data)).ToNot(Equal("compressed response"))
+						Expect(rsp.Header.Get("Content-Encoding")).To(Equal(contentEncoding))
+						Expect(rsp.Uncompressed).To(BeFalse())
+					}
+				},
+				Entry("gzip chosen from a list", true, "zstd, br, gzip", "gzip", true),
+				Entry("gzip with a weight", true, "br;q=1.0, gzip;q=0.5", "gzip", true),
+				Entry("case-insensitive codings", true, "GZIP", "Gzip", true),
+				Entry("unsupported coding chosen", true, "zstd, br, gzip", "br", false),
+				Entry("unsupported coding chosen", true, "zstd, br, gzip", "zstd", false),
+				Entry("coding not listed in Accept-Encoding", true, "zstd, br", "gzip", false),
+				Entry("coding not acceptable", true, "br, gzip;q=0", "gzip", false),
+				Entry("multiple codings applied", true, "br, gzip", "gzip, br", false),
+				Entry("disabled", false, "zstd, br, gzip", "gzip", false),
+			)
 		})
 
 		Context("1xx status code", func() {
@@ -1094,6 +2934,59 @@ var _ = Describe("Client", func() {
 				Expect(rsp.Request).ToNot(BeNil())
 			})
 
+			It("preserves the Link header fields of the last Early Hints response", func() {
+				buf := &bytes.Buffer{}
+				rstr := mockquic.NewMockStream(mockCtrl)
+				rstr.EXPECT().Write(gomock.Any()).Do(buf.Write).AnyTimes()
+				rw := newResponseWriter(newStream(rstr, nil, nil, func(r io.Reader, u uint64) error { return nil }), nil, false, nil)
+				rw.header.Add("Link", "</old.css>; rel=preload; as=style")
+				rw.WriteHeader(http.StatusEarlyHints)
+				rw.header.Del("Link")
+				rw.header.Add("Link", "</style.css>; rel=preload; as=style")
+				rw.header.Add("Link", "</script.js>; rel=preload; as=script")
+				rw.WriteHeader(http.StatusEarlyHints)
+				rw.header.Del("Link")
+				rw.WriteHeader(http.StatusOK)
+				rw.Flush()
+
+				gomock.InOrder(
+					conn.EXPECT().HandshakeComplete().Return(handshakeChan),
+					conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil),
+					conn.EXPECT().ConnectionState().Return(quic.ConnectionState{}),
+				)
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(rsp.Header).ToNot(HaveKey("Link"))
+				Expect(EarlyHintsLinks(rsp)).To(Equal([]string{
+					"</style.css>; rel=preload; as=style",
+					"</script.js>; rel=preload; as=script",
+				}))
+			})
+
+			It("doesn't return Early Hints if none were received", func() {
+				rspBuf := bytes.NewBuffer(encodeResponse(200))
+				gomock.InOrder(
+					conn.EXPECT().HandshakeComplete().Return(handshakeChan),
+					conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil),
+					conn.EXPECT().ConnectionState().Return(quic.ConnectionState{}),
+				)
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				tr := &Transport{}
+				cc := tr.NewClientConn(conn)
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(EarlyHintsLinks(rsp)).To(BeNil())
+				Expect(EarlyHintsLinks(&http.Response{Body: io.NopCloser(&bytes.Buffer{})})).To(BeNil())
+			})
+
 			It("doesn't continue to read next header if code is a terminal status", func() {
 				cnt := 0
 				status := 0
@@ -0,0 +1,26 @@
+package http3
+
+import "time"
+
+// A clock returns the current time and creates timers.
+// It allows tests to control time-dependent logic without relying on the wall clock.
+type clock interface {
+	Now() time.Time
+	AfterFunc(time.Duration, func()) timer
+}
+
+// A timer is created by a clock.
+// It has the same semantics as a time.Timer created by time.AfterFunc.
+type timer interface {
+	Reset(time.Duration) bool
+	Stop() bool
+}
+
+// realClock implements the clock interface using the Go stdlib clock.
+type realClock struct{}
+
+var _ clock = realClock{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) timer { return time.AfterFunc(d, f) }
@@ -0,0 +1,130 @@
+package http3
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeClock is a clock that only advances when Advance is called.
+// Timers fire synchronously, on the goroutine calling Advance.
+type fakeClock struct {
+	mx     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+var _ clock = &fakeClock{}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) timer {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	t := &fakeTimer{clock: c, f: f, deadline: c.now.Add(d), active: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance advances the clock, and runs the callbacks of all timers that expired.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mx.Lock()
+	c.now = c.now.Add(d)
+	var expired []func()
+	for _, t := range c.timers {
+		if t.active && !t.deadline.After(c.now) {
+			t.active = false
+			expired = append(expired, t.f)
+		}
+	}
+	c.mx.Unlock()
+
+	for _, f := range expired {
+		f()
+	}
+}
+
+// ActiveTimers returns the number of timers that haven't fired or been stopped yet.
+func (c *fakeClock) ActiveTimers() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	var n int
+	for _, t := range c.timers {
+		if t.active {
+			n++
+		}
+	}
+	return n
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	f        func()
+	deadline time.Time
+	active   bool
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mx.Lock()
+	defer t.clock.mx.Unlock()
+	wasActive := t.active
+	t.deadline = t.clock.now.Add(d)
+	t.active = true
+	return wasActive
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mx.Lock()
+	defer t.clock.mx.Unlock()
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+var _ = Describe("Clock", func() {
+	It("fires timers when advancing the fake clock", func() {
+		c := newFakeClock()
+		start := c.Now()
+		var fired int
+		t := c.AfterFunc(time.Second, func() { fired++ })
+		c.Advance(time.Second - time.Nanosecond)
+		Expect(fired).To(BeZero())
+		c.Advance(time.Nanosecond)
+		Expect(fired).To(Equal(1))
+		Expect(c.Now()).To(Equal(start.Add(time.Second)))
+		// the timer only fires once
+		c.Advance(time.Hour)
+		Expect(fired).To(Equal(1))
+		// timers can be reset
+		Expect(t.Reset(time.Second)).To(BeFalse())
+		Expect(c.ActiveTimers()).To(Equal(1))
+		c.Advance(time.Second)
+		Expect(fired).To(Equal(2))
+	})
+
+	It("doesn't fire stopped timers", func() {
+		c := newFakeClock()
+		t := c.AfterFunc(time.Second, func() { Fail("timer fired") })
+		Expect(t.Stop()).To(BeTrue())
+		Expect(t.Stop()).To(BeFalse())
+		Expect(c.ActiveTimers()).To(BeZero())
+		c.Advance(time.Hour)
+	})
+
+	It("uses the real clock", func() {
+		fired := make(chan struct{})
+		realClock{}.AfterFunc(scaleDuration(5*time.Millisecond), func() { close(fired) })
+		Eventually(fired).Should(BeClosed())
+		Expect(realClock{}.Now()).To(BeTemporally("~", time.Now(), time.Second))
+	})
+})
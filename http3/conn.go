@@ -2,6 +2,7 @@ package http3
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -14,13 +15,11 @@ import (
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/quicvarint"
-
-	"github.com/quic-go/qpack"
 )
 
 // Connection is an HTTP/3 connection.
 // It has all methods from the quic.Connection expect for AcceptStream, AcceptUniStream,
-// SendDatagram and ReceiveDatagram.
+// SendDatagram, TrySendDatagram and ReceiveDatagram.
 type Connection interface {
 	OpenStream() (quic.Stream, error)
 	OpenStreamSync(context.Context) (quic.Stream, error)
@@ -31,6 +30,12 @@ type Connection interface {
 	CloseWithError(quic.ApplicationErrorCode, string) error
 	Context() context.Context
 	ConnectionState() quic.ConnectionState
+	// DatagramQueueLen returns the number of datagrams queued for sending,
+	// for all streams of the connection.
+	DatagramQueueLen() int
+	// DroppedDatagrams returns the number of received HTTP datagrams that were dropped
+	// because the receive queue of their stream was full, for all streams of the connection.
+	DroppedDatagrams() uint64
 
 	// ReceivedSettings returns a channel that is closed once the client's SETTINGS frame was received.
 	ReceivedSettings() <-chan struct{}
@@ -46,11 +51,25 @@ type connection struct {
 	logger      *slog.Logger
 
 	enableDatagrams bool
+	// the size of the per-stream queue of received HTTP datagrams, and the policy when it is full
+	datagramQueueLen    int
+	dropOldestDatagrams bool
+	droppedDatagrams    atomic.Uint64
 
-	decoder *qpack.Decoder
+	qpackTracer     func(QPACKEvent) // only used by the client
+	maxHeaderFields int              // only used by the client, 0 means no limit
+	onSettings      func(*Settings)  // only used by the client
 
 	streamMx sync.Mutex
-	streams  map[protocol.StreamID]*datagrammer
+	streams  map[protocol.StreamID]*trackedStream
+	// the number of request streams currently being opened, protected by streamMx
+	// Opening a stream blocks if the peer's stream limit is reached.
+	openingStreams int
+
+	// only used by the client
+	receivedGoAway chan struct{} // closed when the first GOAWAY frame is received
+	goAwayID       quic.StreamID // the stream ID of the last GOAWAY frame received, protected by streamMx
+	drained        chan struct{} // non-nil when draining, closed when all streams were cleared, protected by streamMx
 
 	settings         *Settings
 	receivedSettings chan struct{}
@@ -59,6 +78,11 @@ type connection struct {
 	idleTimer   *time.Timer
 }
 
+type trackedStream struct {
+	str       quic.Stream
+	datagrams *datagrammer
+}
+
 func newConnection(
 	ctx context.Context,
 	quicConn quic.Connection,
@@ -74,9 +98,9 @@ func newConnection(
 		logger:           logger,
 		idleTimeout:      idleTimeout,
 		enableDatagrams:  enableDatagrams,
-		decoder:          qpack.NewDecoder(func(hf qpack.HeaderField) {}),
 		receivedSettings: make(chan struct{}),
-		streams:          make(map[protocol.StreamID]*datagrammer),
+		receivedGoAway:   make(chan struct{}),
+		streams:          make(map[protocol.StreamID]*trackedStream),
 	}
 	if idleTimeout > 0 {
 		c.idleTimer = time.AfterFunc(idleTimeout, c.onIdleTimer)
@@ -96,37 +120,100 @@ func (c *connection) clearStream(id quic.StreamID) {
 	if c.idleTimeout > 0 && len(c.streams) == 0 {
 		c.idleTimer.Reset(c.idleTimeout)
 	}
+	if c.drained != nil && len(c.streams) == 0 {
+		closeOnce(c.drained)
+	}
 }
 
-func (c *connection) openRequestStream(
-	ctx context.Context,
-	requestWriter *requestWriter,
-	reqDone chan<- struct{},
-	disableCompression bool,
-	maxHeaderBytes uint64,
-) (*requestStream, error) {
-	str, err := c.Connection.OpenStreamSync(ctx)
+// numActiveStreams returns the number of streams that are currently open,
+// including request streams that are waiting for the peer's stream limit to increase.
+func (c *connection) numActiveStreams() int {
+	c.streamMx.Lock()
+	defer c.streamMx.Unlock()
+
+	return len(c.streams) + c.openingStreams
+}
+
+// drain stops opening new request streams.
+// It returns a channel that is closed once all streams have been cleared.
+func (c *connection) drain() <-chan struct{} {
+	c.streamMx.Lock()
+	defer c.streamMx.Unlock()
+
+	if c.drained == nil {
+		c.drained = make(chan struct{})
+		if len(c.streams) == 0 {
+			close(c.drained)
+		}
+	}
+	return c.drained
+}
+
+func closeOnce(ch chan struct{}) {
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// openRequestStream opens a new request stream.
+// By default, it blocks until the peer's stream limit allows opening the stream.
+// If nonBlocking is set, a quic.StreamLimitReachedError is returned instead.
+func (c *connection) openRequestStream(ctx context.Context, nonBlocking bool, opts requestStreamOptions) (*requestStream, error) {
+	if c.hasReceivedGoAway() {
+		return nil, ErrGoAway
+	}
+	if c.isDraining() {
+		return nil, errClientConnShutdown
+	}
+	c.streamMx.Lock()
+	c.openingStreams++
+	c.streamMx.Unlock()
+	var str quic.Stream
+	var err error
+	if nonBlocking {
+		str, err = c.Connection.OpenStream()
+	} else {
+		str, err = c.Connection.OpenStreamSync(ctx)
+	}
 	if err != nil {
+		c.streamMx.Lock()
+		c.openingStreams--
+		c.streamMx.Unlock()
 		return nil, err
 	}
-	datagrams := newDatagrammer(func(b []byte) error { return c.sendDatagram(str.StreamID(), b) })
+	datagrams := c.newStreamDatagrammer(str)
 	c.streamMx.Lock()
-	c.streams[str.StreamID()] = datagrams
+	c.openingStreams--
+	// The GOAWAY frame might have been received, or the connection might have been shut down,
+	// while opening the stream.
+	if (c.hasReceivedGoAway() && str.StreamID() >= c.goAwayID) || c.drained != nil {
+		err := ErrGoAway
+		if c.drained != nil {
+			err = errClientConnShutdown
+		}
+		c.streamMx.Unlock()
+		str.CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+		str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+		return nil, err
+	}
+	c.streams[str.StreamID()] = &trackedStream{str: str, datagrams: datagrams}
 	c.streamMx.Unlock()
 	qstr := newStateTrackingStream(str, c, datagrams)
 	rsp := &http.Response{}
 	hstr := newStream(qstr, c, datagrams, func(r io.Reader, l uint64) error {
-		hdr, err := c.decodeTrailers(r, l, maxHeaderBytes)
+		hdr, err := c.decodeTrailers(str.StreamID(), r, l, opts.maxHeaderBytes)
 		if err != nil {
 			return err
 		}
 		rsp.Trailer = hdr
 		return nil
 	})
-	return newRequestStream(hstr, requestWriter, reqDone, c.decoder, disableCompression, maxHeaderBytes, rsp), nil
+	return newRequestStream(hstr, rsp, opts), nil
 }
 
-func (c *connection) decodeTrailers(r io.Reader, l, maxHeaderBytes uint64) (http.Header, error) {
+func (c *connection) decodeTrailers(id quic.StreamID, r io.Reader, l, maxHeaderBytes uint64) (http.Header, error) {
 	if l > maxHeaderBytes {
 		return nil, fmt.Errorf("HEADERS frame too large: %d bytes (max: %d)", l, maxHeaderBytes)
 	}
@@ -135,10 +222,13 @@ func (c *connection) decodeTrailers(r io.Reader, l, maxHeaderBytes uint64) (http
 	if _, err := io.ReadFull(r, b); err != nil {
 		return nil, err
 	}
-	fields, err := c.decoder.DecodeFull(b)
+	fields, err := decodeHeaderBlock(b)
 	if err != nil {
 		return nil, err
 	}
+	if c.tracingQPACK() {
+		c.qpackTracer(QPACKEvent{Type: QPACKEventHeadersDecoded, StreamID: id, HeaderBlockLen: len(b), Fields: fields})
+	}
 	return parseTrailers(fields)
 }
 
@@ -147,11 +237,11 @@ func (c *connection) acceptStream(ctx context.Context) (quic.Stream, *datagramme
 	if err != nil {
 		return nil, nil, err
 	}
-	datagrams := newDatagrammer(func(b []byte) error { return c.sendDatagram(str.StreamID(), b) })
+	datagrams := c.newStreamDatagrammer(str)
 	if c.perspective == protocol.PerspectiveServer {
 		strID := str.StreamID()
 		c.streamMx.Lock()
-		c.streams[strID] = datagrams
+		c.streams[strID] = &trackedStream{str: str, datagrams: datagrams}
 		if c.idleTimeout > 0 {
 			if len(c.streams) == 1 {
 				c.idleTimer.Stop()
@@ -163,6 +253,24 @@ func (c *connection) acceptStream(ctx context.Context) (quic.Stream, *datagramme
 	return str, datagrams, nil
 }
 
+// newStreamDatagrammer creates the datagrammer that queues the HTTP datagrams received for a stream.
+func (c *connection) newStreamDatagrammer(str quic.Stream) *datagrammer {
+	d := newDatagrammer(
+		func(b []byte) error { return c.sendDatagram(str.StreamID(), b) },
+		func(b []byte) error { return c.trySendDatagram(str.StreamID(), b) },
+	)
+	if c.datagramQueueLen > 0 {
+		d.maxQueueLen = c.datagramQueueLen
+	}
+	d.dropOldest = c.dropOldestDatagrams
+	d.onDrop = func() { c.droppedDatagrams.Add(1) }
+	return d
+}
+
+// DroppedDatagrams returns the number of received HTTP datagrams that were dropped
+// because the receive queue of their stream was full.
+func (c *connection) DroppedDatagrams() uint64 { return c.droppedDatagrams.Load() }
+
 func (c *connection) CloseWithError(code quic.ApplicationErrorCode, msg string) error {
 	if c.idleTimer != nil {
 		c.idleTimer.Stop()
@@ -205,12 +313,18 @@ func (c *connection) handleUnidirectionalStreams(hijack func(StreamType, quic.Co
 				if isFirst := rcvdQPACKEncoderStr.CompareAndSwap(false, true); !isFirst {
 					c.Connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeStreamCreationError), "duplicate QPACK encoder stream")
 				}
+				if c.tracingQPACK() {
+					c.qpackTracer(QPACKEvent{Type: QPACKEventEncoderStreamOpened, StreamID: str.StreamID()})
+				}
 				// Our QPACK implementation doesn't use the dynamic table yet.
 				return
 			case streamTypeQPACKDecoderStream:
 				if isFirst := rcvdQPACKDecoderStr.CompareAndSwap(false, true); !isFirst {
 					c.Connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeStreamCreationError), "duplicate QPACK decoder stream")
 				}
+				if c.tracingQPACK() {
+					c.qpackTracer(QPACKEvent{Type: QPACKEventDecoderStreamOpened, StreamID: str.StreamID()})
+				}
 				// Our QPACK implementation doesn't use the dynamic table yet.
 				return
 			case streamTypePushStream:
@@ -256,36 +370,155 @@ func (c *connection) handleUnidirectionalStreams(hijack func(StreamType, quic.Co
 			c.settings = &Settings{
 				EnableDatagrams:       sf.Datagram,
 				EnableExtendedConnect: sf.ExtendedConnect,
+				EnableWebTransport:    sf.Other[settingEnableWebTransport] == 1,
 				Other:                 sf.Other,
 			}
 			close(c.receivedSettings)
-			if !sf.Datagram {
-				return
+			if c.onSettings != nil {
+				c.onSettings(c.settings)
 			}
-			// If datagram support was enabled on our side as well as on the server side,
-			// we can expect it to have been negotiated both on the transport and on the HTTP/3 layer.
-			// Note: ConnectionState() will block until the handshake is complete (relevant when using 0-RTT).
-			if c.enableDatagrams && !c.Connection.ConnectionState().SupportsDatagrams {
-				c.Connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeSettingsError), "missing QUIC Datagram support")
+			if sf.Datagram {
+				// If datagram support was enabled on our side as well as on the server side,
+				// we can expect it to have been negotiated both on the transport and on the HTTP/3 layer.
+				// Note: ConnectionState() will block until the handshake is complete (relevant when using 0-RTT).
+				if c.enableDatagrams && !c.Connection.ConnectionState().SupportsDatagrams {
+					c.Connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeSettingsError), "missing QUIC Datagram support")
+					return
+				}
+				go func() {
+					if err := c.receiveDatagrams(); err != nil {
+						if c.logger != nil {
+							c.logger.Debug("receiving datagrams failed", "error", err)
+						}
+					}
+				}()
+			}
+			c.readControlStream(fp)
+		}(str)
+	}
+}
+
+// maxGoAwayFrames is the maximum number of GOAWAY frames accepted on the control stream.
+// A graceful shutdown usually uses two GOAWAY frames (first with a large ID, then with the actual ID),
+// there's no reason for the peer to send more than a handful.
+const maxGoAwayFrames = 16
+
+// readControlStream reads the frames sent on the control stream after the SETTINGS frame.
+func (c *connection) readControlStream(fp *frameParser) {
+	var numGoAways int
+	for {
+		f, err := fp.ParseNext()
+		if err != nil {
+			if c.logger != nil {
+				c.logger.Debug("reading from the control stream failed", "error", err)
+			}
+			return
+		}
+		switch f := f.(type) {
+		case *goAwayFrame:
+			numGoAways++
+			if numGoAways > maxGoAwayFrames {
+				c.Connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeExcessiveLoad), "too many GOAWAY frames")
 				return
 			}
-			go func() {
-				if err := c.receiveDatagrams(); err != nil {
-					if c.logger != nil {
-						c.logger.Debug("receiving datagrams failed", "error", err)
-					}
+			// Clients send a push ID in the GOAWAY frame. We don't support server push, so we can ignore it.
+			if c.perspective == protocol.PerspectiveClient {
+				if err := c.handleGoAway(f.StreamID); err != nil {
+					c.Connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), err.Error())
+					return
 				}
-			}()
-		}(str)
+			}
+		case *settingsFrame, *dataFrame, *headersFrame:
+			c.Connection.CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), "")
+			return
+		}
+	}
+}
+
+// handleGoAway handles a GOAWAY frame received from the server.
+// Requests on streams with a stream ID greater or equal to the stream ID of the GOAWAY frame
+// were not processed by the server, and are canceled. Requests on lower stream IDs might
+// still be processed, and are allowed to complete. No new requests are sent on the connection.
+// See section 5.2 of RFC 9114.
+func (c *connection) handleGoAway(id quic.StreamID) error {
+	if id.Type() != protocol.StreamTypeBidi || id.InitiatedBy() != protocol.PerspectiveClient {
+		return fmt.Errorf("invalid stream ID in GOAWAY frame: %d", id)
+	}
+
+	c.streamMx.Lock()
+	defer c.streamMx.Unlock()
+
+	if c.hasReceivedGoAway() {
+		if id > c.goAwayID {
+			return fmt.Errorf("stream ID in GOAWAY frame increased: %d (previous: %d)", id, c.goAwayID)
+		}
+	} else {
+		close(c.receivedGoAway)
+	}
+	c.goAwayID = id
+	for strID, ts := range c.streams {
+		if strID >= id {
+			ts.str.CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			ts.str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+		}
+	}
+	return nil
+}
+
+func (c *connection) isDraining() bool {
+	c.streamMx.Lock()
+	defer c.streamMx.Unlock()
+	return c.drained != nil
+}
+
+func (c *connection) hasReceivedGoAway() bool {
+	select {
+	case <-c.receivedGoAway:
+		return true
+	default:
+		return false
 	}
 }
 
+// rejectedByGoAway says if the request on the stream wasn't processed by the server,
+// because it was sent on a stream ID larger or equal to the stream ID of a GOAWAY frame.
+func (c *connection) rejectedByGoAway(id quic.StreamID) bool {
+	if !c.hasReceivedGoAway() {
+		return false
+	}
+	c.streamMx.Lock()
+	defer c.streamMx.Unlock()
+	return id >= c.goAwayID
+}
+
+// checkDatagramsEnabled returns an error if the peer's SETTINGS frame didn't enable HTTP datagrams.
+// See section 2.1.1 of RFC 9297.
+// If the SETTINGS frame wasn't received yet, it doesn't return an error.
+func (c *connection) checkDatagramsEnabled() error {
+	select {
+	case <-c.receivedSettings:
+		if !c.settings.EnableDatagrams {
+			return errors.New("http3: peer didn't enable HTTP datagrams")
+		}
+	default:
+	}
+	return nil
+}
+
 func (c *connection) sendDatagram(streamID protocol.StreamID, b []byte) error {
+	return c.Connection.SendDatagram(encodeDatagram(streamID, b))
+}
+
+func (c *connection) trySendDatagram(streamID protocol.StreamID, b []byte) error {
+	return c.Connection.TrySendDatagram(encodeDatagram(streamID, b))
+}
+
+// encodeDatagram prepends the quarter stream ID to the payload of an HTTP Datagram.
+func encodeDatagram(streamID protocol.StreamID, b []byte) []byte {
 	// TODO: this creates a lot of garbage and an additional copy
 	data := make([]byte, 0, len(b)+8)
 	data = quicvarint.Append(data, uint64(streamID/4))
-	data = append(data, b...)
-	return c.Connection.SendDatagram(data)
+	return append(data, b...)
 }
 
 func (c *connection) receiveDatagrams() error {
@@ -305,13 +538,13 @@ func (c *connection) receiveDatagrams() error {
 		}
 		streamID := protocol.StreamID(4 * quarterStreamID)
 		c.streamMx.Lock()
-		dg, ok := c.streams[streamID]
+		ts, ok := c.streams[streamID]
 		if !ok {
 			c.streamMx.Unlock()
 			return nil
 		}
 		c.streamMx.Unlock()
-		dg.enqueue(b[n:])
+		ts.datagrams.enqueue(b[n:])
 	}
 }
 
@@ -128,6 +128,43 @@ var _ = Describe("Connection", func() {
 				Eventually(done).Should(BeClosed())
 			})
 
+			It(fmt.Sprintf("traces the opening of the QPACK %s stream", name), func() {
+				qconn := mockquic.NewMockEarlyConnection(mockCtrl)
+				conn := newConnection(
+					context.Background(),
+					qconn,
+					false,
+					protocol.PerspectiveClient,
+					nil,
+					0,
+				)
+				events := make(chan QPACKEvent, 1)
+				conn.qpackTracer = func(ev QPACKEvent) { events <- ev }
+				buf := bytes.NewBuffer(quicvarint.Append(nil, streamType))
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().StreamID().Return(quic.StreamID(3)).AnyTimes()
+				qconn.EXPECT().AcceptUniStream(gomock.Any()).Return(str, nil)
+				testDone := make(chan struct{})
+				qconn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-testDone
+					return nil, errors.New("test done")
+				})
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					conn.handleUnidirectionalStreams(nil)
+				}()
+				expectedType := QPACKEventEncoderStreamOpened
+				if streamType == streamTypeQPACKDecoderStream {
+					expectedType = QPACKEventDecoderStreamOpened
+				}
+				Eventually(events).Should(Receive(Equal(QPACKEvent{Type: expectedType, StreamID: 3})))
+				close(testDone)
+				Eventually(done).Should(BeClosed())
+			})
+
 			It(fmt.Sprintf("rejects duplicate QPACK %s streams", name), func() {
 				qconn := mockquic.NewMockEarlyConnection(mockCtrl)
 				conn := newConnection(
@@ -404,7 +441,7 @@ var _ = Describe("Connection", func() {
 			qstr.EXPECT().StreamID().Return(strID).MinTimes(1)
 			qstr.EXPECT().Context().Return(context.Background()).AnyTimes()
 			qconn.EXPECT().OpenStreamSync(gomock.Any()).Return(qstr, nil)
-			str, err := conn.openRequestStream(context.Background(), nil, nil, true, 1000)
+			str, err := conn.openRequestStream(context.Background(), false, requestStreamOptions{disableCompression: true, maxHeaderBytes: 1000, clock: realClock{}})
 			Expect(err).ToNot(HaveOccurred())
 			ctx, cancel := context.WithCancel(context.Background())
 			cancel()
@@ -420,7 +457,7 @@ var _ = Describe("Connection", func() {
 			qstr.EXPECT().StreamID().Return(strID).MinTimes(1)
 			qstr.EXPECT().Context().Return(context.Background()).AnyTimes()
 			qconn.EXPECT().OpenStreamSync(gomock.Any()).Return(qstr, nil)
-			str, err := conn.openRequestStream(context.Background(), nil, nil, true, 1000)
+			str, err := conn.openRequestStream(context.Background(), false, requestStreamOptions{disableCompression: true, maxHeaderBytes: 1000, clock: realClock{}})
 			Expect(err).ToNot(HaveOccurred())
 
 			// ... then deliver the datagram
@@ -438,6 +475,55 @@ var _ = Describe("Connection", func() {
 			Expect(data).To(Equal([]byte("foobar")))
 		})
 
+		It("routes datagrams to concurrent streams", func() {
+			conn.datagramQueueLen = 2
+			conn.dropOldestDatagrams = true
+			openStream := func(id quic.StreamID) RequestStream {
+				qstr := mockquic.NewMockStream(mockCtrl)
+				qstr.EXPECT().StreamID().Return(id).MinTimes(1)
+				qstr.EXPECT().Context().Return(context.Background()).AnyTimes()
+				qconn.EXPECT().OpenStreamSync(gomock.Any()).Return(qstr, nil)
+				str, err := conn.openRequestStream(context.Background(), false, requestStreamOptions{disableCompression: true, maxHeaderBytes: 1000, clock: realClock{}})
+				Expect(err).ToNot(HaveOccurred())
+				return str
+			}
+			str1 := openStream(0)
+			str2 := openStream(4)
+
+			datagram := func(id quic.StreamID, data string) []byte {
+				return append(quicvarint.Append(nil, uint64(id/4)), data...)
+			}
+			delivered := make(chan struct{})
+			gomock.InOrder(
+				qconn.EXPECT().ReceiveDatagram(gomock.Any()).Return(datagram(0, "foo"), nil),
+				qconn.EXPECT().ReceiveDatagram(gomock.Any()).Return(datagram(4, "lorem"), nil),
+				qconn.EXPECT().ReceiveDatagram(gomock.Any()).Return(datagram(0, "bar"), nil),
+				qconn.EXPECT().ReceiveDatagram(gomock.Any()).Return(datagram(0, "baz"), nil),
+				qconn.EXPECT().ReceiveDatagram(gomock.Any()).Return(datagram(4, "ipsum"), nil),
+				qconn.EXPECT().ReceiveDatagram(gomock.Any()).DoAndReturn(func(context.Context) ([]byte, error) {
+					close(delivered)
+					return nil, errors.New("test done")
+				}),
+			)
+			go func() {
+				defer GinkgoRecover()
+				conn.handleUnidirectionalStreams(nil)
+			}()
+			Eventually(delivered).Should(BeClosed())
+
+			receive := func(str RequestStream) string {
+				data, err := str.ReceiveDatagram(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				return string(data)
+			}
+			// the queue of the first stream is full, so the oldest datagram was dropped
+			Expect(conn.DroppedDatagrams()).To(BeEquivalentTo(1))
+			Expect(receive(str1)).To(Equal("bar"))
+			Expect(receive(str1)).To(Equal("baz"))
+			Expect(receive(str2)).To(Equal("lorem"))
+			Expect(receive(str2)).To(Equal("ipsum"))
+		})
+
 		It("sends datagrams", func() {
 			const strID = 404
 			expected := quicvarint.Append([]byte{}, strID/4)
@@ -447,5 +533,14 @@ var _ = Describe("Connection", func() {
 
 			Expect(conn.sendDatagram(strID, []byte("foobar"))).To(MatchError(testErr))
 		})
+
+		It("drops datagrams if the send queue is full", func() {
+			const strID = 404
+			expected := quicvarint.Append([]byte{}, strID/4)
+			expected = append(expected, []byte("foobar")...)
+			qconn.EXPECT().TrySendDatagram(expected).Return(quic.ErrDatagramQueueFull)
+
+			Expect(conn.trySendDatagram(strID, []byte("foobar"))).To(MatchError(quic.ErrDatagramQueueFull))
+		})
 	})
 })
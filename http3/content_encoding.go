@@ -0,0 +1,36 @@
+package http3
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// contentDecoders are the content codings that response bodies can be transparently decoded from.
+var contentDecoders = map[string]func(body io.ReadCloser, maxSize int64) io.ReadCloser{
+	"gzip": newGzipReader,
+}
+
+// decodableEncodings returns the content codings listed in the Accept-Encoding header field
+// that response bodies can be transparently decoded from.
+// Codings with a weight of 0 are not acceptable (see section 12.5.3 of RFC 9110), and are skipped.
+func decodableEncodings(h http.Header) []string {
+	var codings []string
+	for _, v := range h.Values("Accept-Encoding") {
+		for _, item := range strings.Split(v, ",") {
+			coding, params, _ := strings.Cut(item, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if _, ok := contentDecoders[coding]; !ok {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if w, err := strconv.ParseFloat(q, 64); err == nil && w == 0 {
+					continue
+				}
+			}
+			codings = append(codings, coding)
+		}
+	}
+	return codings
+}
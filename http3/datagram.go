@@ -3,6 +3,8 @@ package http3
 import (
 	"context"
 	"sync"
+
+	"github.com/quic-go/quic-go/internal/utils/ringbuffer"
 )
 
 const maxQuarterStreamID = 1<<60 - 1
@@ -10,20 +12,29 @@ const maxQuarterStreamID = 1<<60 - 1
 const streamDatagramQueueLen = 32
 
 type datagrammer struct {
-	sendDatagram func([]byte) error
-
-	hasData chan struct{}
-	queue   [][]byte // TODO: use a ring buffer
+	sendDatagram    func([]byte) error
+	trySendDatagram func([]byte) error
+
+	hasData     chan struct{}
+	queue       ringbuffer.RingBuffer[[]byte]
+	maxQueueLen int
+	// dropOldest says if the oldest datagram is dropped when the queue is full.
+	// By default, newly received datagrams are dropped.
+	dropOldest bool
+	// onDrop, if set, is called for every received datagram that is dropped because the queue is full
+	onDrop func()
 
 	mx         sync.Mutex
 	sendErr    error
 	receiveErr error
 }
 
-func newDatagrammer(sendDatagram func([]byte) error) *datagrammer {
+func newDatagrammer(sendDatagram, trySendDatagram func([]byte) error) *datagrammer {
 	return &datagrammer{
-		sendDatagram: sendDatagram,
-		hasData:      make(chan struct{}, 1),
+		sendDatagram:    sendDatagram,
+		trySendDatagram: trySendDatagram,
+		hasData:         make(chan struct{}, 1),
+		maxQueueLen:     streamDatagramQueueLen,
 	}
 }
 
@@ -43,16 +54,26 @@ func (d *datagrammer) SetSendError(err error) {
 }
 
 func (d *datagrammer) Send(b []byte) error {
-	d.mx.Lock()
-	sendErr := d.sendErr
-	d.mx.Unlock()
-	if sendErr != nil {
-		return sendErr
+	if err := d.getSendError(); err != nil {
+		return err
 	}
-
 	return d.sendDatagram(b)
 }
 
+// TrySend sends a datagram, unless the send queue is full.
+func (d *datagrammer) TrySend(b []byte) error {
+	if err := d.getSendError(); err != nil {
+		return err
+	}
+	return d.trySendDatagram(b)
+}
+
+func (d *datagrammer) getSendError() error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.sendErr
+}
+
 func (d *datagrammer) signalHasData() {
 	select {
 	case d.hasData <- struct{}{}:
@@ -67,19 +88,24 @@ func (d *datagrammer) enqueue(data []byte) {
 	if d.receiveErr != nil {
 		return
 	}
-	if len(d.queue) >= streamDatagramQueueLen {
-		return
+	if d.queue.Len() >= d.maxQueueLen {
+		if d.onDrop != nil {
+			d.onDrop()
+		}
+		if !d.dropOldest {
+			return
+		}
+		d.queue.PopFront()
 	}
-	d.queue = append(d.queue, data)
+	d.queue.PushBack(data)
 	d.signalHasData()
 }
 
 func (d *datagrammer) Receive(ctx context.Context) ([]byte, error) {
 start:
 	d.mx.Lock()
-	if len(d.queue) >= 1 {
-		data := d.queue[0]
-		d.queue = d.queue[1:]
+	if !d.queue.Empty() {
+		data := d.queue.PopFront()
 		d.mx.Unlock()
 		return data, nil
 	}
@@ -5,13 +5,15 @@ import (
 	"errors"
 	"time"
 
+	"github.com/quic-go/quic-go"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Datagrams", func() {
 	It("receives a datagram", func() {
-		dg := newDatagrammer(nil)
+		dg := newDatagrammer(nil, nil)
 		dg.enqueue([]byte("foobar"))
 		data, err := dg.Receive(context.Background())
 		Expect(err).ToNot(HaveOccurred())
@@ -19,7 +21,7 @@ var _ = Describe("Datagrams", func() {
 	})
 
 	It("queues up to 32 datagrams", func() {
-		dg := newDatagrammer(nil)
+		dg := newDatagrammer(nil, nil)
 		for i := 0; i < streamDatagramQueueLen+1; i++ {
 			dg.enqueue([]byte{uint8(i)})
 		}
@@ -34,8 +36,48 @@ var _ = Describe("Datagrams", func() {
 		Expect(err).To(MatchError(context.Canceled))
 	})
 
+	It("drops the oldest datagrams, if configured", func() {
+		dg := newDatagrammer(nil, nil)
+		dg.maxQueueLen = 3
+		dg.dropOldest = true
+		for i := 0; i < 5; i++ {
+			dg.enqueue([]byte{uint8(i)})
+		}
+		for i := 2; i < 5; i++ {
+			data, err := dg.Receive(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data[0]).To(BeEquivalentTo(i))
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := dg.Receive(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	It("counts dropped datagrams", func() {
+		for _, dropOldest := range []bool{false, true} {
+			var dropped int
+			dg := newDatagrammer(nil, nil)
+			dg.maxQueueLen = 3
+			dg.dropOldest = dropOldest
+			dg.onDrop = func() { dropped++ }
+			for i := 0; i < 3; i++ {
+				dg.enqueue([]byte{uint8(i)})
+			}
+			Expect(dropped).To(BeZero())
+			dg.enqueue([]byte{3})
+			dg.enqueue([]byte{4})
+			Expect(dropped).To(Equal(2))
+			// the queue has space again after a datagram was read
+			_, err := dg.Receive(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			dg.enqueue([]byte{5})
+			Expect(dropped).To(Equal(2))
+		}
+	})
+
 	It("blocks until a new datagram is received", func() {
-		dg := newDatagrammer(nil)
+		dg := newDatagrammer(nil, nil)
 		done := make(chan struct{})
 		go func() {
 			defer GinkgoRecover()
@@ -51,7 +93,7 @@ var _ = Describe("Datagrams", func() {
 	})
 
 	It("drops datagrams when the stream's receive side is closed", func() {
-		dg := newDatagrammer(nil)
+		dg := newDatagrammer(nil, nil)
 		dg.enqueue([]byte("foo"))
 		testErr := errors.New("test error")
 		dg.SetReceiveError(testErr)
@@ -69,8 +111,22 @@ var _ = Describe("Datagrams", func() {
 		dg := newDatagrammer(func(b []byte) error {
 			sent = b
 			return testErr
-		})
+		}, nil)
 		Expect(dg.Send([]byte("foobar"))).To(MatchError(testErr))
 		Expect(sent).To(Equal([]byte("foobar")))
 	})
+
+	It("tries to send datagrams", func() {
+		var sent []byte
+		dg := newDatagrammer(nil, func(b []byte) error {
+			sent = b
+			return quic.ErrDatagramQueueFull
+		})
+		Expect(dg.TrySend([]byte("foobar"))).To(MatchError(quic.ErrDatagramQueueFull))
+		Expect(sent).To(Equal([]byte("foobar")))
+
+		testErr := errors.New("test error")
+		dg.SetSendError(testErr)
+		Expect(dg.TrySend([]byte("foobar"))).To(MatchError(testErr))
+	})
 })
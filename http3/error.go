@@ -3,6 +3,9 @@ package http3
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"syscall"
 
 	"github.com/quic-go/quic-go"
 )
@@ -33,19 +36,122 @@ func (e *Error) Error() string {
 	return s
 }
 
+// StreamError is returned from the round tripper if the server reset the request stream
+// before the response was received.
+// The error code allows the application to decide if the request can be retried:
+// ErrCodeRequestRejected means that the server didn't process the request.
+type StreamError struct {
+	StreamID  quic.StreamID
+	ErrorCode ErrCode
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("http3: stream %d reset by peer: %s", e.StreamID, (&Error{Remote: true, ErrorCode: e.ErrorCode}).Error())
+}
+
+// Unwrap returns an Error carrying the same error code.
+func (e *StreamError) Unwrap() error { return &Error{Remote: true, ErrorCode: e.ErrorCode} }
+
+// BodyTooLongError is returned from the round tripper if the request body is longer
+// than the request's ContentLength. The request is aborted: Only ContentLength bytes of
+// the body are sent, and the request stream is reset afterwards.
+type BodyTooLongError struct {
+	// ContentLength is the length declared by the request's ContentLength.
+	ContentLength int64
+	// BodyLength is the number of bytes read from the body.
+	BodyLength int64
+}
+
+func (e *BodyTooLongError) Error() string {
+	return fmt.Sprintf("http: ContentLength=%d with Body length %d", e.ContentLength, e.BodyLength)
+}
+
+// ConnectionError is returned from the round tripper if a request failed because the
+// underlying QUIC connection was closed, e.g. due to an idle timeout, a stateless reset
+// or a QUIC transport error.
+// Connections closed by the peer with an HTTP/3 error code (e.g. after sending a GOAWAY frame)
+// result in an Error instead.
+type ConnectionError struct {
+	// Err is the error returned by the QUIC layer.
+	Err error
+}
+
+var _ net.Error = &ConnectionError{}
+
+func (e *ConnectionError) Error() string { return "http3: connection closed: " + e.Err.Error() }
+func (e *ConnectionError) Unwrap() error { return e.Err }
+
+// Timeout reports whether the connection was closed due to a timeout.
+func (e *ConnectionError) Timeout() bool {
+	var nerr net.Error
+	return errors.As(e.Err, &nerr) && nerr.Timeout()
+}
+
+// Temporary always returns false.
+// It is only implemented to satisfy the net.Error interface.
+func (e *ConnectionError) Temporary() bool { return false }
+
+// errorResponse synthesizes a response for errors caused by an unreachable or unresponsive server,
+// see RoundTripOpt.SynthesizeErrorResponse.
+// It returns nil for all other errors.
+func errorResponse(req *http.Request, err error) *http.Response {
+	// the request was canceled, or its deadline expired
+	if req.Context().Err() != nil {
+		return nil
+	}
+	var (
+		transportErr *quic.TransportError
+		nerr         net.Error
+		status       int
+	)
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED),
+		errors.As(err, &transportErr) && transportErr.Remote && transportErr.ErrorCode == quic.ConnectionRefused:
+		status = http.StatusBadGateway
+	case errors.As(err, &nerr) && nerr.Timeout():
+		status = http.StatusGatewayTimeout
+	default:
+		return nil
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/3.0",
+		ProtoMajor: 3,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
 func maybeReplaceError(err error) error {
 	if err == nil {
 		return nil
 	}
 
 	var (
-		e      Error
-		strErr *quic.StreamError
-		appErr *quic.ApplicationError
+		e                   Error
+		strErr              *quic.StreamError
+		appErr              *quic.ApplicationError
+		transportErr        *quic.TransportError
+		idleTimeoutErr      *quic.IdleTimeoutError
+		handshakeTimeoutErr *quic.HandshakeTimeoutError
+		statelessResetErr   *quic.StatelessResetError
+		versionErr          *quic.VersionNegotiationError
 	)
 	switch {
 	default:
 		return err
+	case errors.As(err, &idleTimeoutErr):
+		return &ConnectionError{Err: idleTimeoutErr}
+	case errors.As(err, &handshakeTimeoutErr):
+		return &ConnectionError{Err: handshakeTimeoutErr}
+	case errors.As(err, &statelessResetErr):
+		return &ConnectionError{Err: statelessResetErr}
+	case errors.As(err, &transportErr):
+		return &ConnectionError{Err: transportErr}
+	case errors.As(err, &versionErr):
+		return &ConnectionError{Err: versionErr}
 	case errors.As(err, &strErr):
 		e.Remote = strErr.Remote
 		e.ErrorCode = ErrCode(strErr.ErrorCode)
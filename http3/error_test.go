@@ -1,7 +1,14 @@
 package http3
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
 
 	"github.com/quic-go/quic-go"
 
@@ -31,6 +38,83 @@ var _ = Describe("HTTP/3 errors", func() {
 		}))
 	})
 
+	It("converts errors that close the QUIC connection", func() {
+		for _, qerr := range []error{
+			&quic.IdleTimeoutError{},
+			&quic.HandshakeTimeoutError{},
+			&quic.StatelessResetError{},
+			&quic.TransportError{ErrorCode: quic.ProtocolViolation},
+			&quic.VersionNegotiationError{},
+		} {
+			err := maybeReplaceError(fmt.Errorf("wrapped: %w", qerr))
+			Expect(err).To(Equal(&ConnectionError{Err: qerr}))
+			Expect(errors.Is(err, net.ErrClosed)).To(BeTrue())
+		}
+		Expect(maybeReplaceError(&quic.IdleTimeoutError{}).(net.Error).Timeout()).To(BeTrue())
+		Expect(maybeReplaceError(&quic.StatelessResetError{}).(net.Error).Timeout()).To(BeFalse())
+	})
+
+	It("synthesizes responses for errors caused by the server being unreachable", func() {
+		req := httptest.NewRequest(http.MethodGet, "https://quic-go.net", nil)
+		for _, tc := range []struct {
+			err    error
+			status int
+		}{
+			{err: &ConnectionError{Err: &quic.IdleTimeoutError{}}, status: http.StatusGatewayTimeout},
+			{err: &quic.HandshakeTimeoutError{}, status: http.StatusGatewayTimeout},
+			{err: &net.OpError{Op: "read", Err: syscall.ECONNREFUSED}, status: http.StatusBadGateway},
+			{err: &quic.TransportError{ErrorCode: quic.ConnectionRefused, Remote: true}, status: http.StatusBadGateway},
+		} {
+			rsp := errorResponse(req, tc.err)
+			Expect(rsp).ToNot(BeNil())
+			Expect(rsp.StatusCode).To(Equal(tc.status))
+			Expect(rsp.Status).To(Equal(fmt.Sprintf("%d %s", tc.status, http.StatusText(tc.status))))
+			Expect(rsp.ProtoMajor).To(Equal(3))
+			Expect(rsp.Request).To(Equal(req))
+			body, err := io.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(BeEmpty())
+		}
+	})
+
+	It("doesn't synthesize responses for protocol errors", func() {
+		req := httptest.NewRequest(http.MethodGet, "https://quic-go.net", nil)
+		for _, err := range []error{
+			errors.New("foobar"),
+			&ConnectionError{Err: &quic.TransportError{ErrorCode: quic.ProtocolViolation, Remote: true}},
+			&quic.TransportError{ErrorCode: quic.ConnectionRefused, Remote: false},
+			&ConnectionError{Err: &quic.StatelessResetError{}},
+			&Error{ErrorCode: ErrCodeFrameError, Remote: true},
+			&StreamError{ErrorCode: ErrCodeRequestRejected},
+			ErrStreamLimitReached,
+		} {
+			Expect(errorResponse(req, err)).To(BeNil())
+		}
+	})
+
+	It("doesn't synthesize responses when the request context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest(http.MethodGet, "https://quic-go.net", nil).WithContext(ctx)
+		Expect(errorResponse(req, &quic.IdleTimeoutError{})).To(BeNil())
+		Expect(errorResponse(req, context.DeadlineExceeded)).To(BeNil())
+	})
+
+	It("has a string representation for stream errors", func() {
+		Expect((&StreamError{StreamID: 4, ErrorCode: ErrCodeRequestRejected}).Error()).To(Equal("http3: stream 4 reset by peer: H3_REQUEST_REJECTED"))
+		Expect((&StreamError{StreamID: 8, ErrorCode: 0x1337}).Error()).To(Equal("http3: stream 8 reset by peer: H3 error (0x1337)"))
+	})
+
+	It("unwraps stream errors", func() {
+		var h3Err *Error
+		Expect(errors.As(&StreamError{StreamID: 4, ErrorCode: ErrCodeInternalError}, &h3Err)).To(BeTrue())
+		Expect(h3Err).To(Equal(&Error{Remote: true, ErrorCode: ErrCodeInternalError}))
+	})
+
+	It("has a string representation for connection errors", func() {
+		Expect((&ConnectionError{Err: &quic.IdleTimeoutError{}}).Error()).To(Equal("http3: connection closed: timeout: no recent network activity"))
+	})
+
 	It("has a string representation", func() {
 		Expect((&Error{ErrorCode: 0x10c, Remote: true}).Error()).To(Equal("H3_REQUEST_CANCELLED"))
 		Expect((&Error{ErrorCode: 0x10c, Remote: true, ErrorMessage: "foobar"}).Error()).To(Equal("H3_REQUEST_CANCELLED: foobar"))
@@ -23,10 +23,15 @@ type frameParser struct {
 	r                   io.Reader
 	conn                quic.Connection
 	unknownFrameHandler unknownFrameHandlerFunc
+
+	qr quicvarint.Reader // wraps r, created on the first call to ParseNext
 }
 
 func (p *frameParser) ParseNext() (frame, error) {
-	qr := quicvarint.NewReader(p.r)
+	if p.qr == nil {
+		p.qr = quicvarint.NewReader(p.r)
+	}
+	qr := p.qr
 	for {
 		t, err := quicvarint.Read(qr)
 		if err != nil {
@@ -80,6 +85,34 @@ func (p *frameParser) ParseNext() (frame, error) {
 	}
 }
 
+// validateControlStreamFrames checks that b consists of complete frames that may be sent
+// on the control stream after the SETTINGS frame, see section 7.2 of RFC 9114.
+func validateControlStreamFrames(b []byte) error {
+	for len(b) > 0 {
+		t, n, err := quicvarint.Parse(b)
+		if err != nil {
+			return fmt.Errorf("http3: invalid control stream frame: %w", err)
+		}
+		b = b[n:]
+		l, n, err := quicvarint.Parse(b)
+		if err != nil {
+			return fmt.Errorf("http3: invalid control stream frame: %w", err)
+		}
+		b = b[n:]
+		if uint64(len(b)) < l {
+			return fmt.Errorf("http3: incomplete control stream frame of type %#x: %d bytes (expected %d)", t, len(b), l)
+		}
+		b = b[l:]
+		switch t {
+		case 0x0, 0x1, 0x4, 0x5: // DATA, HEADERS, SETTINGS, PUSH_PROMISE
+			return fmt.Errorf("http3: frame of type %#x not allowed on the control stream", t)
+		case 0x2, 0x6, 0x8, 0x9:
+			return fmt.Errorf("http3: reserved frame type: %#x", t)
+		}
+	}
+	return nil
+}
+
 type dataFrame struct {
 	Length uint64
 }
@@ -103,6 +136,9 @@ const (
 	settingExtendedConnect = 0x8
 	// HTTP Datagrams, RFC 9297
 	settingDatagram = 0x33
+	// WebTransport over HTTP/3, as used by webtransport-go.
+	// This setting is not parsed, it is contained in the Other settings.
+	settingEnableWebTransport = 0x2b603742
 )
 
 type settingsFrame struct {
@@ -219,3 +255,17 @@ func (f *goAwayFrame) Append(b []byte) []byte {
 	b = quicvarint.Append(b, uint64(quicvarint.Len(uint64(f.StreamID))))
 	return quicvarint.Append(b, uint64(f.StreamID))
 }
+
+// priorityUpdateFrame is a PRIORITY_UPDATE frame for a request stream, see section 7.2 of RFC 9218.
+// It is sent on the control stream.
+type priorityUpdateFrame struct {
+	StreamID quic.StreamID
+	Priority string // the Priority Field Value
+}
+
+func (f *priorityUpdateFrame) Append(b []byte) []byte {
+	b = quicvarint.Append(b, 0xf0700)
+	b = quicvarint.Append(b, uint64(quicvarint.Len(uint64(f.StreamID))+len(f.Priority)))
+	b = quicvarint.Append(b, uint64(f.StreamID))
+	return append(b, f.Priority...)
+}
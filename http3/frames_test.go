@@ -252,6 +252,57 @@ var _ = Describe("Frames", func() {
 		})
 	})
 
+	Context("PRIORITY_UPDATE frames", func() {
+		It("writes", func() {
+			data := (&priorityUpdateFrame{StreamID: 4, Priority: "u=5, i"}).Append(nil)
+			expected := []byte{0x80, 0x0f, 0x07, 0x00} // frame type, as a 4 byte varint
+			expected = append(expected, 7, 4)          // length, stream ID
+			expected = append(expected, "u=5, i"...)
+			Expect(data).To(Equal(expected))
+		})
+
+		It("is skipped by the frame parser", func() {
+			data := (&priorityUpdateFrame{StreamID: 4}).Append(nil)
+			data = (&goAwayFrame{StreamID: 8}).Append(data)
+			fp := frameParser{r: bytes.NewReader(data)}
+			frame, err := fp.ParseNext()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&goAwayFrame{StreamID: 8}))
+		})
+	})
+
+	Context("validating control stream frames", func() {
+		It("accepts complete frames that are allowed on the control stream", func() {
+			b := quicvarint.Append(nil, 0x1337)
+			b = quicvarint.Append(b, 3)
+			b = append(b, "foo"...)
+			b = (&goAwayFrame{StreamID: 4}).Append(b)
+			b = (&priorityUpdateFrame{StreamID: 4, Priority: "u=1"}).Append(b)
+			Expect(validateControlStreamFrames(b)).To(Succeed())
+			Expect(validateControlStreamFrames(nil)).To(Succeed())
+		})
+
+		It("rejects incomplete frames", func() {
+			b := quicvarint.Append(nil, 0x1337)
+			b = quicvarint.Append(b, 3)
+			b = append(b, "foo"...)
+			Expect(validateControlStreamFrames(b[:len(b)-1])).To(MatchError("http3: incomplete control stream frame of type 0x1337: 2 bytes (expected 3)"))
+			Expect(validateControlStreamFrames(b[:1])).To(MatchError(ContainSubstring("http3: invalid control stream frame")))
+		})
+
+		It("rejects frames that are not allowed on the control stream", func() {
+			Expect(validateControlStreamFrames((&dataFrame{}).Append(nil))).To(MatchError("http3: frame of type 0x0 not allowed on the control stream"))
+			Expect(validateControlStreamFrames((&headersFrame{}).Append(nil))).To(MatchError("http3: frame of type 0x1 not allowed on the control stream"))
+			Expect(validateControlStreamFrames((&settingsFrame{}).Append(nil))).To(MatchError("http3: frame of type 0x4 not allowed on the control stream"))
+		})
+
+		It("rejects reserved frame types", func() {
+			b := quicvarint.Append(nil, 0x2)
+			b = quicvarint.Append(b, 0)
+			Expect(validateControlStreamFrames(b)).To(MatchError("http3: reserved frame type: 0x2"))
+		})
+	})
+
 	Context("GOAWAY frames", func() {
 		It("parses", func() {
 			data := quicvarint.Append(nil, 0x7) // type byte
@@ -5,35 +5,123 @@ package http3
 // gzipReader wraps a response body so it can lazily
 // call gzip.NewReader on the first call to Read
 import (
+	"bufio"
 	"compress/gzip"
+	"errors"
 	"io"
+	"sync"
+	"time"
 )
 
+// gzipReaderBufferSize is the size of the buffer used to read the compressed body.
+const gzipReaderBufferSize = 16 << 10
+
+var errReadOnClosedBody = errors.New("http3: read on closed response body")
+
+// pooledGzipReader is a gzip.Reader, together with the buffer it reads from.
+// Both are reused for multiple responses.
+type pooledGzipReader struct {
+	br *bufio.Reader
+	zr gzip.Reader
+}
+
+var gzipReaderPool sync.Pool
+
+func getGzipReader(r io.Reader) (*pooledGzipReader, error) {
+	gr, ok := gzipReaderPool.Get().(*pooledGzipReader)
+	if !ok {
+		gr = &pooledGzipReader{br: bufio.NewReaderSize(r, gzipReaderBufferSize)}
+	} else {
+		gr.br.Reset(r)
+	}
+	// gzip.Reader only allocates a new bufio.Reader if the reader doesn't implement io.ByteReader
+	if err := gr.zr.Reset(gr.br); err != nil {
+		putGzipReader(gr)
+		return nil, err
+	}
+	return gr, nil
+}
+
+func putGzipReader(gr *pooledGzipReader) {
+	// don't keep a reference to the response body
+	gr.br.Reset(nil)
+	gzipReaderPool.Put(gr)
+}
+
 // call gzip.NewReader on the first call to Read
 type gzipReader struct {
 	body io.ReadCloser // underlying Response.Body
-	zr   *gzip.Reader  // lazily-initialized gzip reader
-	zerr error         // sticky error
+
+	mx   sync.Mutex        // prevents Close from returning zr to the pool while Read is using it
+	zr   *pooledGzipReader // lazily-initialized gzip reader, returned to the pool on Close
+	zerr error             // sticky error
+
+	maxSize int64 // maximum size of the decompressed body, 0 means no limit
+	read    int64 // number of decompressed bytes read so far
 }
 
-func newGzipReader(body io.ReadCloser) io.ReadCloser {
-	return &gzipReader{body: body}
+func newGzipReader(body io.ReadCloser, maxSize int64) io.ReadCloser {
+	return &gzipReader{body: body, maxSize: maxSize}
 }
 
 func (gz *gzipReader) Read(p []byte) (n int, err error) {
+	gz.mx.Lock()
+	defer gz.mx.Unlock()
+
 	if gz.zerr != nil {
 		return 0, gz.zerr
 	}
 	if gz.zr == nil {
-		gz.zr, err = gzip.NewReader(gz.body)
+		gz.zr, err = getGzipReader(gz.body)
 		if err != nil {
 			gz.zerr = err
 			return 0, err
 		}
 	}
-	return gz.zr.Read(p)
+	if gz.maxSize <= 0 {
+		return gz.zr.zr.Read(p)
+	}
+	// Read at most one byte more than allowed, so we can detect when the limit is exceeded.
+	if remaining := gz.maxSize - gz.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err = gz.zr.zr.Read(p)
+	gz.read += int64(n)
+	if gz.read > gz.maxSize {
+		gz.zerr = ErrDecompressedSizeExceeded
+		gz.body.Close()
+		return n - int(gz.read-gz.maxSize), gz.zerr
+	}
+	return n, err
 }
 
 func (gz *gzipReader) Close() error {
-	return gz.body.Close()
+	// closing the body first unblocks a concurrent call to Read
+	err := gz.body.Close()
+
+	gz.mx.Lock()
+	defer gz.mx.Unlock()
+	// Subsequent calls to Read must not use the gzip.Reader,
+	// since it might already be in use for a different response.
+	if gz.zerr == nil {
+		gz.zerr = errReadOnClosedBody
+	}
+	if gz.zr != nil {
+		putGzipReader(gz.zr)
+		gz.zr = nil
+	}
+	return err
+}
+
+// SetReadDeadline sets the read deadline on the underlying response body.
+func (gz *gzipReader) SetReadDeadline(t time.Time) error {
+	if b, ok := gz.body.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return b.SetReadDeadline(t)
+	}
+	return errors.New("http3: response body doesn't support read deadlines")
+}
+
+func (gz *gzipReader) responseBody() *hijackableBody {
+	b, _ := gz.body.(*hijackableBody)
+	return b
 }
@@ -0,0 +1,83 @@
+package http3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func gzipData(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+var _ = Describe("gzip reader", func() {
+	It("decompresses the body", func() {
+		gz := newGzipReader(io.NopCloser(bytes.NewReader(gzipData([]byte("foobar")))), 0)
+		data, err := io.ReadAll(gz)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+		Expect(gz.Close()).To(Succeed())
+	})
+
+	It("returns errors for invalid gzip data", func() {
+		gz := newGzipReader(io.NopCloser(bytes.NewReader([]byte("not gzipped"))), 0)
+		_, err := io.ReadAll(gz)
+		Expect(err).To(MatchError(gzip.ErrHeader))
+		Expect(gz.Close()).To(Succeed())
+	})
+
+	It("reuses gzip readers for multiple bodies", func() {
+		for i := 0; i < 10; i++ {
+			// close the body before reading all the data
+			gz := newGzipReader(io.NopCloser(bytes.NewReader(gzipData(bytes.Repeat([]byte("foo"), 1000)))), 0)
+			_, err := gz.Read(make([]byte, 10))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gz.Close()).To(Succeed())
+
+			gz = newGzipReader(io.NopCloser(bytes.NewReader(gzipData([]byte("lorem ipsum")))), 0)
+			data, err := io.ReadAll(gz)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("lorem ipsum")))
+			Expect(gz.Close()).To(Succeed())
+		}
+	})
+
+	It("doesn't allow reading after Close", func() {
+		gz := newGzipReader(io.NopCloser(bytes.NewReader(gzipData([]byte("foobar")))), 0)
+		b := make([]byte, 3)
+		n, err := gz.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foo")))
+		Expect(gz.Close()).To(Succeed())
+		Expect(gz.(*gzipReader).zr).To(BeNil())
+		_, err = gz.Read(b)
+		Expect(err).To(MatchError(errReadOnClosedBody))
+	})
+})
+
+func BenchmarkGzipReader(b *testing.B) {
+	data := gzipData(bytes.Repeat([]byte("foobar"), 1000))
+	buf := make([]byte, 4096)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gz := newGzipReader(io.NopCloser(bytes.NewReader(data)), 0)
+		for {
+			if _, err := gz.Read(buf); err != nil {
+				if err != io.EOF {
+					b.Fatal(err)
+				}
+				break
+			}
+		}
+		gz.Close()
+	}
+}
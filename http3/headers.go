@@ -3,17 +3,84 @@ package http3
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/textproto"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"golang.org/x/net/http/httpguts"
 
 	"github.com/quic-go/qpack"
 )
 
+// decoderPool pools QPACK decoders.
+// Since the dynamic table is not used (yet), decoders don't carry any per-connection state,
+// and header blocks received on different streams can be decoded in parallel.
+var decoderPool = sync.Pool{
+	New: func() any { return qpack.NewDecoder(nil) },
+}
+
+// decodeHeaderBlock decodes a complete QPACK-encoded header block,
+// using a decoder from the decoderPool.
+func decodeHeaderBlock(b []byte) ([]qpack.HeaderField, error) {
+	decoder := decoderPool.Get().(*qpack.Decoder)
+	hfs, err := decoder.DecodeFull(b)
+	if err != nil {
+		// The decoder is not reset if decoding fails, so it must not be reused.
+		return nil, err
+	}
+	decoderPool.Put(decoder)
+	return hfs, nil
+}
+
+// headerBlockChunkSize is the size of the chunks in which header blocks are read from the stream.
+const headerBlockChunkSize = 4 << 10
+
+// A headerDecodingError is returned by readHeaderBlock if the header block can't be decoded.
+// It allows distinguishing decoding errors from errors reading from the stream.
+type headerDecodingError struct{ err error }
+
+func (e *headerDecodingError) Error() string { return e.err.Error() }
+func (e *headerDecodingError) Unwrap() error { return e.err }
+
+// errTooManyHeaderFields is returned by readHeaderBlock if the header block contains
+// more than the maximum number of header fields.
+var errTooManyHeaderFields = errors.New("too many header fields")
+
+// readHeaderBlock reads a header block of the given length from r and decodes it.
+// The header block is passed to the QPACK decoder as it is read, in chunks of headerBlockChunkSize,
+// so it doesn't need to be buffered: Only a partially received header field is buffered by the decoder.
+// The caller is responsible for limiting the length of the header block.
+// If maxFields is positive, decoding is aborted as soon as more than maxFields header fields were decoded.
+func readHeaderBlock(r io.Reader, length uint64, maxFields int) ([]qpack.HeaderField, error) {
+	var hfs []qpack.HeaderField
+	decoder := qpack.NewDecoder(func(hf qpack.HeaderField) { hfs = append(hfs, hf) })
+	buf := make([]byte, min(length, headerBlockChunkSize))
+	for remaining := length; remaining > 0; {
+		n, err := io.ReadFull(r, buf[:min(remaining, uint64(len(buf)))])
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		remaining -= uint64(n)
+		if _, err := decoder.Write(buf[:n]); err != nil {
+			return nil, &headerDecodingError{err: err}
+		}
+		if maxFields > 0 && len(hfs) > maxFields {
+			return nil, errTooManyHeaderFields
+		}
+	}
+	if err := decoder.Close(); err != nil {
+		return nil, &headerDecodingError{err: err}
+	}
+	return hfs, nil
+}
+
 type header struct {
 	// Pseudo header fields defined in RFC 9114
 	Path      string
@@ -38,7 +105,10 @@ var invalidHeaderFields = [...]string{
 	"upgrade",
 }
 
-func parseHeaders(headers []qpack.HeaderField, isRequest bool) (header, error) {
+// parseHeaders parses the header fields of a request or a response.
+// For responses to CONNECT requests, the :protocol pseudo header field is accepted,
+// since the server might echo the protocol of an Extended CONNECT request (RFC 9220).
+func parseHeaders(headers []qpack.HeaderField, isRequest, isConnectResponse bool) (header, error) {
 	hdr := header{Headers: make(http.Header, len(headers))}
 	var readFirstRegularHeader, readContentLength bool
 	var contentLengthStr string
@@ -65,6 +135,7 @@ func parseHeaders(headers []qpack.HeaderField, isRequest bool) (header, error) {
 				hdr.Authority = h.Value
 			case ":protocol":
 				hdr.Protocol = h.Value
+				isResponsePseudoHeader = isConnectResponse
 			case ":scheme":
 				hdr.Scheme = h.Value
 			case ":status":
@@ -94,13 +165,17 @@ func parseHeaders(headers []qpack.HeaderField, isRequest bool) (header, error) {
 			readFirstRegularHeader = true
 			switch h.Name {
 			case "content-length":
-				// Ignore duplicate Content-Length headers.
-				// Fail if the duplicates differ.
-				if !readContentLength {
-					readContentLength = true
-					contentLengthStr = h.Value
-				} else if contentLengthStr != h.Value {
-					return header{}, fmt.Errorf("contradicting content lengths (%s and %s)", contentLengthStr, h.Value)
+				// Ignore duplicate Content-Length values, both in separate header fields
+				// and in a comma-separated list (see section 8.6 of RFC 9110).
+				// Fail if the duplicates differ, since this might be an attempt at request smuggling.
+				for _, v := range strings.Split(h.Value, ",") {
+					v = textproto.TrimString(v)
+					if !readContentLength {
+						readContentLength = true
+						contentLengthStr = v
+					} else if contentLengthStr != v {
+						return header{}, fmt.Errorf("contradicting content lengths (%s and %s)", contentLengthStr, v)
+					}
 				}
 			default:
 				hdr.Headers.Add(h.Name, h.Value)
@@ -132,7 +207,7 @@ func parseTrailers(headers []qpack.HeaderField) (http.Header, error) {
 }
 
 func requestFromHeaders(headerFields []qpack.HeaderField) (*http.Request, error) {
-	hdr, err := parseHeaders(headerFields, true)
+	hdr, err := parseHeaders(headerFields, true, false)
 	if err != nil {
 		return nil, err
 	}
@@ -208,17 +283,53 @@ func hostnameFromURL(url *url.URL) string {
 	return ""
 }
 
+// RawResponseHeaderFields returns the header fields of an HTTP/3 response, including the
+// pseudo-header fields, in the order in which they were received from the server.
+// The header fields are only retained if Transport.PreserveRawResponseHeaders is set.
+// It returns nil if the response wasn't received by this package, or if the Body of the
+// response was replaced.
+func RawResponseHeaderFields(rsp *http.Response) []qpack.HeaderField {
+	if b := responseBodyOf(rsp); b != nil {
+		return b.info.rawHeaderFields
+	}
+	return nil
+}
+
+// EarlyHintsLinks returns the values of the Link header fields of the last 103 (Early Hints)
+// response received before the final response, see RFC 8297.
+// It returns nil if no Early Hints were received, if the response wasn't received by this
+// package, or if the Body of the response was replaced.
+func EarlyHintsLinks(rsp *http.Response) []string {
+	if b := responseBodyOf(rsp); b != nil {
+		return b.info.earlyHintsLinks
+	}
+	return nil
+}
+
+// ResponseProtocol returns the value of the :protocol pseudo-header field of a successful (2xx) response
+// to an Extended CONNECT request (RFC 9220), if the server sent one.
+// Servers might use it to echo the protocol of the request.
+// It returns an empty string for all other responses, including unsuccessful responses to Extended CONNECT requests,
+// if the response wasn't received by this package, or if the Body of the response was replaced.
+func ResponseProtocol(rsp *http.Response) string {
+	if b := responseBodyOf(rsp); b != nil {
+		return b.info.protocol
+	}
+	return ""
+}
+
 // updateResponseFromHeaders sets up http.Response as an HTTP/3 response,
 // using the decoded qpack header filed.
 // It is only called for the HTTP header (and not the HTTP trailer).
 // It takes an http.Response as an argument to allow the caller to set the trailer later on.
-func updateResponseFromHeaders(rsp *http.Response, headerFields []qpack.HeaderField) error {
-	hdr, err := parseHeaders(headerFields, false)
+// For responses to CONNECT requests, it returns the value of the :protocol pseudo header field.
+func updateResponseFromHeaders(rsp *http.Response, headerFields []qpack.HeaderField, isConnect bool) (protocol string, _ error) {
+	hdr, err := parseHeaders(headerFields, false, isConnect)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if hdr.Status == "" {
-		return errors.New("missing status field")
+		return "", errors.New("missing status field")
 	}
 	rsp.Proto = "HTTP/3.0"
 	rsp.ProtoMajor = 3
@@ -226,13 +337,31 @@ func updateResponseFromHeaders(rsp *http.Response, headerFields []qpack.HeaderFi
 	processTrailers(rsp)
 	rsp.ContentLength = hdr.ContentLength
 
-	status, err := strconv.Atoi(hdr.Status)
+	status, err := parseStatus(hdr.Status)
 	if err != nil {
-		return fmt.Errorf("invalid status code: %w", err)
+		return "", err
 	}
 	rsp.StatusCode = status
 	rsp.Status = hdr.Status + " " + http.StatusText(status)
-	return nil
+	return hdr.Protocol, nil
+}
+
+// parseStatus parses the value of the :status pseudo header field.
+// The status code must be a three-digit integer in the range 100 to 599, see section 15 of RFC 9110.
+func parseStatus(s string) (int, error) {
+	if len(s) != 3 {
+		return 0, fmt.Errorf("invalid status code: %q", s)
+	}
+	for _, c := range []byte(s) {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid status code: %q", s)
+		}
+	}
+	status, _ := strconv.Atoi(s)
+	if status < 100 || status > 599 {
+		return 0, fmt.Errorf("invalid status code: %d", status)
+	}
+	return status, nil
 }
 
 // processTrailers initializes the rsp.Trailer map, and adds keys for every announced header value.
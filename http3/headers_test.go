@@ -1,9 +1,18 @@
 package http3
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/quic-go/quic-go/integrationtests/tools/israce"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -138,6 +147,31 @@ var _ = Describe("Request", func() {
 		Expect(req.Header.Get("Content-Length")).To(Equal("42"))
 	})
 
+	It("deduplicates Content-Length values in a comma-separated list, if they're the same", func() {
+		headers := []qpack.HeaderField{
+			{Name: ":path", Value: "/foo"},
+			{Name: ":authority", Value: "quic.clemente.io"},
+			{Name: ":method", Value: "GET"},
+			{Name: "content-length", Value: "42, 42,42"},
+			{Name: "content-length", Value: "42"},
+		}
+		req, err := requestFromHeaders(headers)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(req.ContentLength).To(Equal(int64(42)))
+		Expect(req.Header.Values("Content-Length")).To(Equal([]string{"42"}))
+	})
+
+	It("rejects Content-Length values in a comma-separated list, if they differ", func() {
+		headers := []qpack.HeaderField{
+			{Name: ":path", Value: "/foo"},
+			{Name: ":authority", Value: "quic.clemente.io"},
+			{Name: ":method", Value: "GET"},
+			{Name: "content-length", Value: "42, 1337"},
+		}
+		_, err := requestFromHeaders(headers)
+		Expect(err).To(MatchError("contradicting content lengths (42 and 1337)"))
+	})
+
 	It("rejects pseudo header fields defined for responses", func() {
 		headers := []qpack.HeaderField{
 			{Name: ":path", Value: "/foo"},
@@ -322,7 +356,7 @@ var _ = Describe("Response", func() {
 			{Name: "content-length", Value: "42"},
 		}
 		rsp := &http.Response{}
-		err := updateResponseFromHeaders(rsp, headers)
+		_, err := updateResponseFromHeaders(rsp, headers, false)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(rsp.Proto).To(Equal("HTTP/3.0"))
 		Expect(rsp.ProtoMajor).To(Equal(3))
@@ -335,6 +369,29 @@ var _ = Describe("Response", func() {
 		Expect(rsp.Status).To(Equal("200 OK"))
 	})
 
+	It("deduplicates multiple Content-Length headers, if they're the same", func() {
+		headers := []qpack.HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: "content-length", Value: "42"},
+			{Name: "content-length", Value: "42"},
+		}
+		rsp := &http.Response{}
+		_, err := updateResponseFromHeaders(rsp, headers, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.ContentLength).To(Equal(int64(42)))
+		Expect(rsp.Header.Values("Content-Length")).To(Equal([]string{"42"}))
+	})
+
+	It("rejects multiple Content-Length headers, if they differ", func() {
+		headers := []qpack.HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: "content-length", Value: "42"},
+			{Name: "content-length", Value: "1337"},
+		}
+		_, err := updateResponseFromHeaders(&http.Response{}, headers, false)
+		Expect(err).To(MatchError("contradicting content lengths (42 and 1337)"))
+	})
+
 	It("parses trailer", func() {
 		headers := []qpack.HeaderField{
 			{Name: ":status", Value: "200"},
@@ -342,7 +399,7 @@ var _ = Describe("Response", func() {
 			{Name: "trailer", Value: "TRAILER3"},
 		}
 		rsp := &http.Response{}
-		err := updateResponseFromHeaders(rsp, headers)
+		_, err := updateResponseFromHeaders(rsp, headers, false)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(rsp.Header).To(HaveLen(0))
 		Expect(rsp.Trailer).To(Equal(http.Header(map[string][]string{
@@ -357,7 +414,7 @@ var _ = Describe("Response", func() {
 			{Name: "content-length", Value: "42"},
 			{Name: ":status", Value: "200"},
 		}
-		err := updateResponseFromHeaders(&http.Response{}, headers)
+		_, err := updateResponseFromHeaders(&http.Response{}, headers, false)
 		Expect(err).To(MatchError("received pseudo header :status after a regular header field"))
 	})
 
@@ -365,17 +422,35 @@ var _ = Describe("Response", func() {
 		headers := []qpack.HeaderField{
 			{Name: "content-length", Value: "42"},
 		}
-		err := updateResponseFromHeaders(&http.Response{}, headers)
+		_, err := updateResponseFromHeaders(&http.Response{}, headers, false)
 		Expect(err).To(MatchError("missing status field"))
 	})
 
-	It("rejects invalid status codes", func() {
-		headers := []qpack.HeaderField{
-			{Name: ":status", Value: "foobar"},
+	DescribeTable("rejects invalid status codes",
+		func(status string) {
+			headers := []qpack.HeaderField{
+				{Name: ":status", Value: status},
+			}
+			_, err := updateResponseFromHeaders(&http.Response{}, headers, false)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid status code"))
+		},
+		Entry("not a number", "foobar"),
+		Entry("non-numeric, three characters", "abc"),
+		Entry("below 100", "099"),
+		Entry("above 599", "600"),
+		Entry("too short", "99"),
+		Entry("too long", "0200"),
+		Entry("with a sign", "+20"),
+	)
+
+	It("accepts status codes between 100 and 599", func() {
+		for _, status := range []int{100, 200, 404, 599} {
+			rsp := &http.Response{}
+			_, err := updateResponseFromHeaders(rsp, []qpack.HeaderField{{Name: ":status", Value: strconv.Itoa(status)}}, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(status))
 		}
-		err := updateResponseFromHeaders(&http.Response{}, headers)
-		Expect(err).To(HaveOccurred())
-		Expect(err.Error()).To(ContainSubstring("invalid status code"))
 	})
 
 	It("rejects pseudo header fields defined for requests", func() {
@@ -383,17 +458,46 @@ var _ = Describe("Response", func() {
 			{Name: ":status", Value: "404"},
 			{Name: ":method", Value: "GET"},
 		}
-		err := updateResponseFromHeaders(&http.Response{}, headers)
+		_, err := updateResponseFromHeaders(&http.Response{}, headers, false)
 		Expect(err).To(MatchError("invalid response pseudo header: :method"))
 	})
 
+	It("accepts the :protocol pseudo header field on responses to CONNECT requests", func() {
+		headers := []qpack.HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: ":protocol", Value: "webtransport"},
+		}
+		rsp := &http.Response{}
+		protocol, err := updateResponseFromHeaders(rsp, headers, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(protocol).To(Equal("webtransport"))
+		Expect(rsp.StatusCode).To(Equal(200))
+		Expect(rsp.Header).To(BeEmpty())
+		// other request pseudo header fields are still rejected
+		headers = []qpack.HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: ":path", Value: "/foo"},
+		}
+		_, err = updateResponseFromHeaders(&http.Response{}, headers, true)
+		Expect(err).To(MatchError("invalid response pseudo header: :path"))
+	})
+
+	It("rejects the :protocol pseudo header field on responses to other requests", func() {
+		headers := []qpack.HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: ":protocol", Value: "webtransport"},
+		}
+		_, err := updateResponseFromHeaders(&http.Response{}, headers, false)
+		Expect(err).To(MatchError("invalid response pseudo header: :protocol"))
+	})
+
 	DescribeTable("rejecting invalid header fields",
 		func(invalidField string) {
 			headers := []qpack.HeaderField{
 				{Name: ":status", Value: "404"},
 				{Name: invalidField, Value: "some-value"},
 			}
-			err := updateResponseFromHeaders(&http.Response{}, headers)
+			_, err := updateResponseFromHeaders(&http.Response{}, headers, false)
 			Expect(err).To(MatchError(fmt.Sprintf("invalid header field name: %q", invalidField)))
 		},
 		Entry("connection", "connection"),
@@ -408,12 +512,14 @@ var _ = Describe("Response", func() {
 			{Name: ":status", Value: "404"},
 			{Name: "te", Value: "trailers"},
 		}
-		Expect(updateResponseFromHeaders(&http.Response{}, headers)).To(Succeed())
+		_, err := updateResponseFromHeaders(&http.Response{}, headers, false)
+		Expect(err).ToNot(HaveOccurred())
 		headers = []qpack.HeaderField{
 			{Name: ":status", Value: "404"},
 			{Name: "te", Value: "not-trailers"},
 		}
-		Expect(updateResponseFromHeaders(&http.Response{}, headers)).To(MatchError("invalid TE header field value: \"not-trailers\""))
+		_, err = updateResponseFromHeaders(&http.Response{}, headers, false)
+		Expect(err).To(MatchError("invalid TE header field value: \"not-trailers\""))
 	})
 
 	It("parses trailers", func() {
@@ -433,3 +539,128 @@ var _ = Describe("Response", func() {
 		Expect(err).To(MatchError("http3: received pseudo header in trailer: :status"))
 	})
 })
+
+var _ = Describe("Decoding header blocks", func() {
+	encode := func(hfs ...qpack.HeaderField) []byte {
+		var buf bytes.Buffer
+		enc := qpack.NewEncoder(&buf)
+		for _, hf := range hfs {
+			Expect(enc.WriteField(hf)).To(Succeed())
+		}
+		Expect(enc.Close()).To(Succeed())
+		return buf.Bytes()
+	}
+
+	It("decodes header blocks concurrently", func() {
+		const num = 50
+		var wg sync.WaitGroup
+		wg.Add(num)
+		for i := 0; i < num; i++ {
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				val := strconv.Itoa(i)
+				hfs, err := decodeHeaderBlock(encode(
+					qpack.HeaderField{Name: ":status", Value: "200"},
+					qpack.HeaderField{Name: "index", Value: val},
+				))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hfs).To(Equal([]qpack.HeaderField{
+					{Name: ":status", Value: "200"},
+					{Name: "index", Value: val},
+				}))
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	It("doesn't reuse decoders after a decoding error", func() {
+		for i := 0; i < 10; i++ {
+			// truncated header block
+			b := encode(qpack.HeaderField{Name: "foo", Value: "bar"})
+			_, err := decodeHeaderBlock(b[:len(b)-1])
+			Expect(err).To(HaveOccurred())
+			hfs, err := decodeHeaderBlock(encode(qpack.HeaderField{Name: "foo", Value: "bar"}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hfs).To(Equal([]qpack.HeaderField{{Name: "foo", Value: "bar"}}))
+		}
+	})
+
+	Context("reading header blocks from a stream", func() {
+		It("decodes header blocks larger than the chunk size", func() {
+			var fields []qpack.HeaderField
+			for i := 0; i < 200; i++ {
+				fields = append(fields, qpack.HeaderField{Name: fmt.Sprintf("header-%d", i), Value: strings.Repeat("0123456789", 10)})
+			}
+			b := encode(fields...)
+			Expect(len(b)).To(BeNumerically(">", 2*headerBlockChunkSize))
+			hfs, err := readHeaderBlock(bytes.NewReader(b), uint64(len(b)), 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hfs).To(Equal(fields))
+		})
+
+		It("only reads the header block", func() {
+			b := encode(qpack.HeaderField{Name: "foo", Value: "bar"})
+			r := bytes.NewReader(append(b, []byte("DATA")...))
+			hfs, err := readHeaderBlock(r, uint64(len(b)), 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hfs).To(Equal([]qpack.HeaderField{{Name: "foo", Value: "bar"}}))
+			Expect(r.Len()).To(Equal(4))
+		})
+
+		It("errors when the stream ends before the header block was read", func() {
+			b := encode(qpack.HeaderField{Name: "foo", Value: "bar"})
+			_, err := readHeaderBlock(bytes.NewReader(b), uint64(len(b))+1, 0)
+			Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+			var decodingErr *headerDecodingError
+			Expect(errors.As(err, &decodingErr)).To(BeFalse())
+		})
+
+		It("limits the number of header fields", func() {
+			var fields []qpack.HeaderField
+			for i := 0; i < 10; i++ {
+				fields = append(fields, qpack.HeaderField{Name: fmt.Sprintf("header-%d", i), Value: "foo"})
+			}
+			b := encode(fields...)
+			hfs, err := readHeaderBlock(bytes.NewReader(b), uint64(len(b)), 10)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hfs).To(HaveLen(10))
+			_, err = readHeaderBlock(bytes.NewReader(b), uint64(len(b)), 9)
+			Expect(err).To(MatchError(errTooManyHeaderFields))
+		})
+
+		It("returns a headerDecodingError for invalid header blocks", func() {
+			// truncated header block
+			b := encode(qpack.HeaderField{Name: "foo", Value: "bar"})
+			_, err := readHeaderBlock(bytes.NewReader(b[:len(b)-1]), uint64(len(b)-1), 0)
+			var decodingErr *headerDecodingError
+			Expect(errors.As(err, &decodingErr)).To(BeTrue())
+		})
+
+		It("doesn't buffer the whole header block", func() {
+			if israce.Enabled {
+				Skip("the race detector changes the allocation behavior")
+			}
+			const num = 1000
+			var fields []qpack.HeaderField
+			var fieldsLen int
+			for i := 0; i < num; i++ {
+				hf := qpack.HeaderField{Name: fmt.Sprintf("header-%d", i), Value: strings.Repeat("a", 1000)}
+				fields = append(fields, hf)
+				fieldsLen += len(hf.Name) + len(hf.Value)
+			}
+			b := encode(fields...)
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			hfs, err := readHeaderBlock(bytes.NewReader(b), uint64(len(b)), 0)
+			runtime.ReadMemStats(&after)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hfs).To(HaveLen(num))
+			// Allocating the decoded header fields can't be avoided.
+			// Buffering the header block would add another len(b) bytes.
+			allocated := after.TotalAlloc - before.TotalAlloc
+			Expect(allocated).To(BeNumerically("<", uint64(fieldsLen+len(b)/2)))
+		})
+	})
+})
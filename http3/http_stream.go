@@ -1,16 +1,17 @@
 package http3
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/internal/protocol"
-
-	"github.com/quic-go/qpack"
 )
 
 // A Stream is an HTTP/3 request stream.
@@ -18,7 +19,18 @@ import (
 type Stream interface {
 	quic.Stream
 
+	// SendDatagram sends an HTTP Datagram associated with the stream.
+	// It blocks if the datagram send queue of the QUIC connection is full.
+	// It returns an error if the peer's SETTINGS frame didn't enable HTTP datagrams.
+	// Before the SETTINGS frame is received, datagrams are sent optimistically,
+	// since the peer is expected to enable HTTP datagrams. If it doesn't, it drops these datagrams.
 	SendDatagram([]byte) error
+	// TrySendDatagram is like SendDatagram, but it doesn't block if the send queue is full.
+	// Instead, the datagram is dropped and quic.ErrDatagramQueueFull is returned.
+	TrySendDatagram([]byte) error
+	// ReceiveDatagram receives an HTTP Datagram associated with the stream.
+	// Like SendDatagram, it returns an error if the peer's SETTINGS frame didn't enable HTTP datagrams,
+	// and it doesn't wait for the SETTINGS frame to be received.
 	ReceiveDatagram(context.Context) ([]byte, error)
 }
 
@@ -45,15 +57,25 @@ type stream struct {
 
 	buf []byte // used as a temporary buffer when writing the HTTP/3 frame headers
 
+	// used to parse the frames on the stream, reused across calls to Read
+	frameParser *frameParser
+
 	bytesRemainingInFrame uint64
 
 	datagrams *datagrammer
 
 	parseTrailer  func(io.Reader, uint64) error
 	parsedTrailer bool
+
+	// only set if a WireTap is used for the request
+	wireTap     WireTap
+	wireTapData bool // if set, DATA frames are passed to the wireTap as well
 }
 
-var _ Stream = &stream{}
+var (
+	_ Stream        = &stream{}
+	_ io.ReaderFrom = &stream{}
+)
 
 func newStream(str quic.Stream, conn *connection, datagrams *datagrammer, parseTrailer func(io.Reader, uint64) error) *stream {
 	return &stream{
@@ -66,14 +88,13 @@ func newStream(str quic.Stream, conn *connection, datagrams *datagrammer, parseT
 }
 
 func (s *stream) Read(b []byte) (int, error) {
-	fp := &frameParser{
-		r:    s.Stream,
-		conn: s.conn,
+	if s.frameParser == nil {
+		s.frameParser = &frameParser{r: s.Stream, conn: s.conn}
 	}
 	if s.bytesRemainingInFrame == 0 {
 	parseLoop:
 		for {
-			frame, err := fp.ParseNext()
+			frame, err := s.frameParser.ParseNext()
 			if err != nil {
 				return 0, err
 			}
@@ -82,6 +103,14 @@ func (s *stream) Read(b []byte) (int, error) {
 				if s.parsedTrailer {
 					return 0, errors.New("DATA frame received after trailers")
 				}
+				if s.tapDataEnabled() {
+					s.wireTap(WireInbound, f.Append(nil))
+				}
+				// Empty DATA frames are valid, but don't carry any data.
+				// Skip them, instead of returning 0 bytes without an error.
+				if f.Length == 0 {
+					continue
+				}
 				s.bytesRemainingInFrame = f.Length
 				break parseLoop
 			case *headersFrame:
@@ -92,7 +121,10 @@ func (s *stream) Read(b []byte) (int, error) {
 					return 0, errors.New("additional HEADERS frame received after trailers")
 				}
 				s.parsedTrailer = true
-				return 0, s.parseTrailer(s.Stream, f.Length)
+				r, tap := s.tapHeadersFrame(s.Stream, f.Length)
+				err := s.parseTrailer(r, f.Length)
+				tap()
+				return 0, err
 			default:
 				s.conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), "")
 				// parseNextFrame skips over unknown frame types
@@ -110,6 +142,9 @@ func (s *stream) Read(b []byte) (int, error) {
 		n, err = s.Stream.Read(b)
 	}
 	s.bytesRemainingInFrame -= uint64(n)
+	if n > 0 && s.tapDataEnabled() {
+		s.tapFrame(WireInbound, b[:n])
+	}
 	return n, err
 }
 
@@ -120,12 +155,52 @@ func (s *stream) hasMoreData() bool {
 func (s *stream) Write(b []byte) (int, error) {
 	s.buf = s.buf[:0]
 	s.buf = (&dataFrame{Length: uint64(len(b))}).Append(s.buf)
+	if s.tapDataEnabled() {
+		s.wireTap(WireOutbound, append(bytes.Clone(s.buf), b...))
+	}
 	if _, err := s.Stream.Write(s.buf); err != nil {
 		return 0, err
 	}
 	return s.Stream.Write(b)
 }
 
+// ReadFrom reads data from r until EOF and writes it to the stream.
+// Every chunk read from r is sent in its own DATA frame. The frame header is written
+// together with the payload, using a single Write call on the QUIC stream.
+// If r is an *io.LimitedReader, the buffer is sized to not exceed the limit.
+// It stops as soon as writing to the stream fails, e.g. because the stream was canceled.
+func (s *stream) ReadFrom(r io.Reader) (int64, error) {
+	size := int64(bodyCopyBufferSize)
+	if lr, ok := r.(*io.LimitedReader); ok && lr.N < size {
+		size = max(lr.N, 1)
+	}
+	// reserve space for the DATA frame header (type and length) in front of the payload
+	const hdrLen = 1 + 8
+	buf := make([]byte, hdrLen+int(size))
+	var written int64
+	for {
+		n, rerr := r.Read(buf[hdrLen:])
+		if n > 0 {
+			s.buf = (&dataFrame{Length: uint64(n)}).Append(s.buf[:0])
+			start := hdrLen - len(s.buf)
+			copy(buf[start:], s.buf)
+			if s.tapDataEnabled() {
+				s.tapFrame(WireOutbound, buf[start:hdrLen+n])
+			}
+			if _, err := s.Stream.Write(buf[start : hdrLen+n]); err != nil {
+				return written, err
+			}
+			written += int64(n)
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
 func (s *stream) writeUnframed(b []byte) (int, error) {
 	return s.Stream.Write(b)
 }
@@ -141,37 +216,40 @@ type requestStream struct {
 
 	responseBody io.ReadCloser // set by ReadResponse
 
-	decoder            *qpack.Decoder
-	requestWriter      *requestWriter
-	maxHeaderBytes     uint64
-	reqDone            chan<- struct{}
-	disableCompression bool
-	response           *http.Response
+	requestStreamOptions
+	response *http.Response
 
 	sentRequest   bool
 	requestedGzip bool
-	isConnect     bool
+	// the content codings listed in the Accept-Encoding header field set by the application,
+	// that will be decoded transparently, only used if decompressAccepted is set
+	decodableEncodings []string
+	isConnect          bool
+	isHead             bool
+	// the time when the first frame of the response was received, see Timings.FirstResponseByte
+	firstResponseByte time.Time
 }
 
 var _ RequestStream = &requestStream{}
 
-func newRequestStream(
-	str *stream,
-	requestWriter *requestWriter,
-	reqDone chan<- struct{},
-	decoder *qpack.Decoder,
-	disableCompression bool,
-	maxHeaderBytes uint64,
-	rsp *http.Response,
-) *requestStream {
+// requestStreamOptions configures a request stream.
+type requestStreamOptions struct {
+	requestWriter       *requestWriter
+	reqDone             chan<- struct{} // closed when the request is done, may be nil
+	maxHeaderBytes      uint64
+	disableCompression  bool
+	decompressAccepted  bool // see Transport.DecompressAcceptedEncodings
+	preserveRawHeaders  bool
+	maxDecompressedSize int64
+	maxBodySize         int64
+	clock               clock
+}
+
+func newRequestStream(str *stream, rsp *http.Response, opts requestStreamOptions) *requestStream {
 	return &requestStream{
-		stream:             str,
-		requestWriter:      requestWriter,
-		reqDone:            reqDone,
-		decoder:            decoder,
-		disableCompression: disableCompression,
-		maxHeaderBytes:     maxHeaderBytes,
-		response:           rsp,
+		stream:               str,
+		requestStreamOptions: opts,
+		response:             rsp,
 	}
 }
 
@@ -186,13 +264,25 @@ func (s *requestStream) SendRequestHeader(req *http.Request) error {
 	if s.sentRequest {
 		return errors.New("http3: invalid duplicate use of SendRequestHeader")
 	}
-	if !s.disableCompression && req.Method != http.MethodHead &&
+	if !s.disableCompression && s.requestWriter.acceptEncoding == "" && req.Method != http.MethodHead &&
 		req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
 		s.requestedGzip = true
 	}
+	if s.decompressAccepted && !s.requestedGzip && req.Method != http.MethodHead {
+		h := req.Header
+		if ae := s.requestWriter.addedAcceptEncoding(req, false); ae != "" {
+			h = http.Header{"Accept-Encoding": {ae}}
+		}
+		s.decodableEncodings = decodableEncodings(h)
+	}
 	s.isConnect = req.Method == http.MethodConnect
+	s.isHead = req.Method == http.MethodHead
 	s.sentRequest = true
-	return s.requestWriter.WriteRequestHeader(s.Stream, req, s.requestedGzip)
+	var str quic.Stream = s.Stream
+	if s.tapEnabled() {
+		str = &wireTapWriter{stream: s.stream}
+	}
+	return s.requestWriter.WriteRequestHeader(str, req, s.requestedGzip)
 }
 
 func (s *requestStream) ReadResponse() (*http.Response, error) {
@@ -206,6 +296,9 @@ func (s *requestStream) ReadResponse() (*http.Response, error) {
 		s.Stream.CancelWrite(quic.StreamErrorCode(ErrCodeFrameError))
 		return nil, fmt.Errorf("http3: parsing frame failed: %w", err)
 	}
+	if s.firstResponseByte.IsZero() {
+		s.firstResponseByte = s.clock.Now()
+	}
 	hf, ok := frame.(*headersFrame)
 	if !ok {
 		s.conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), "expected first frame to be a HEADERS frame")
@@ -216,41 +309,66 @@ func (s *requestStream) ReadResponse() (*http.Response, error) {
 		s.Stream.CancelWrite(quic.StreamErrorCode(ErrCodeFrameError))
 		return nil, fmt.Errorf("http3: HEADERS frame too large: %d bytes (max: %d)", hf.Length, s.maxHeaderBytes)
 	}
-	headerBlock := make([]byte, hf.Length)
-	if _, err := io.ReadFull(s.Stream, headerBlock); err != nil {
+	r, tap := s.tapHeadersFrame(s.Stream, hf.Length)
+	hfs, err := readHeaderBlock(r, hf.Length, s.conn.maxHeaderFields)
+	tap()
+	if err != nil {
+		if err == errTooManyHeaderFields {
+			s.Stream.CancelRead(quic.StreamErrorCode(ErrCodeExcessiveLoad))
+			s.Stream.CancelWrite(quic.StreamErrorCode(ErrCodeExcessiveLoad))
+			return nil, fmt.Errorf("http3: too many response header fields (max: %d)", s.conn.maxHeaderFields)
+		}
+		var decodingErr *headerDecodingError
+		if errors.As(err, &decodingErr) {
+			// TODO: use the right error code
+			s.conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeGeneralProtocolError), "")
+			return nil, fmt.Errorf("http3: failed to decode response headers: %w", decodingErr.err)
+		}
 		s.Stream.CancelRead(quic.StreamErrorCode(ErrCodeRequestIncomplete))
 		s.Stream.CancelWrite(quic.StreamErrorCode(ErrCodeRequestIncomplete))
 		return nil, fmt.Errorf("http3: failed to read response headers: %w", err)
 	}
-	hfs, err := s.decoder.DecodeFull(headerBlock)
-	if err != nil {
-		// TODO: use the right error code
-		s.conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeGeneralProtocolError), "")
-		return nil, fmt.Errorf("http3: failed to decode response headers: %w", err)
+	if s.conn.tracingQPACK() {
+		s.conn.qpackTracer(QPACKEvent{Type: QPACKEventHeadersDecoded, StreamID: s.StreamID(), HeaderBlockLen: int(hf.Length), Fields: hfs})
 	}
 	res := s.response
-	if err := updateResponseFromHeaders(res, hfs); err != nil {
+	protocol, err := updateResponseFromHeaders(res, hfs, s.isConnect)
+	if err != nil {
 		s.Stream.CancelRead(quic.StreamErrorCode(ErrCodeMessageError))
 		s.Stream.CancelWrite(quic.StreamErrorCode(ErrCodeMessageError))
 		return nil, fmt.Errorf("http3: invalid response: %w", err)
 	}
 
+	// A 2xx response to a CONNECT request, including an Extended CONNECT request (RFC 9220),
+	// turns the request stream into a tunnel. Any other response is a regular response,
+	// and the request stream is not used as a tunnel.
+	isTunnel := s.isConnect && res.StatusCode >= 200 && res.StatusCode < 300
+
 	// Check that the server doesn't send more data in DATA frames than indicated by the Content-Length header (if set).
 	// See section 4.1.2 of RFC 9114.
 	respBody := newResponseBody(s.stream, res.ContentLength, s.reqDone)
+	respBody.maxSize = s.maxBodySize
+	respBody.isTunnel = isTunnel
+	if isTunnel {
+		respBody.info.protocol = protocol
+	}
+	respBody.isHead = s.isHead
+	respBody.clock = s.clock
+	if s.preserveRawHeaders {
+		respBody.info.rawHeaderFields = hfs
+	}
 
 	// Rules for when to set Content-Length are defined in https://tools.ietf.org/html/rfc7230#section-3.3.2.
 	isInformational := res.StatusCode >= 100 && res.StatusCode < 200
 	isNoContent := res.StatusCode == http.StatusNoContent
-	isSuccessfulConnect := s.isConnect && res.StatusCode >= 200 && res.StatusCode < 300
-	if (isInformational || isNoContent || isSuccessfulConnect) && res.ContentLength == -1 {
+	if (isInformational || isNoContent || isTunnel) && res.ContentLength == -1 {
 		res.ContentLength = 0
 	}
-	if s.requestedGzip && res.Header.Get("Content-Encoding") == "gzip" {
+	if newDecoder := s.contentDecoder(res.Header.Get("Content-Encoding")); newDecoder != nil {
 		res.Header.Del("Content-Encoding")
 		res.Header.Del("Content-Length")
 		res.ContentLength = -1
-		s.responseBody = newGzipReader(respBody)
+		s.responseBody = newDecoder(respBody, s.maxDecompressedSize)
 		res.Uncompressed = true
 	} else {
 		s.responseBody = respBody
@@ -259,12 +377,38 @@ func (s *requestStream) ReadResponse() (*http.Response, error) {
 	return res, nil
 }
 
+// contentDecoder returns the decoder for the Content-Encoding of the response,
+// if the response is transparently decoded.
+func (s *requestStream) contentDecoder(contentEncoding string) func(io.ReadCloser, int64) io.ReadCloser {
+	if s.requestedGzip && contentEncoding == "gzip" {
+		return newGzipReader
+	}
+	contentEncoding = strings.ToLower(strings.TrimSpace(contentEncoding))
+	for _, coding := range s.decodableEncodings {
+		if coding == contentEncoding {
+			return contentDecoders[coding]
+		}
+	}
+	return nil
+}
+
 func (s *stream) SendDatagram(b []byte) error {
-	// TODO: reject if datagrams are not negotiated (yet)
+	if err := s.conn.checkDatagramsEnabled(); err != nil {
+		return err
+	}
 	return s.datagrams.Send(b)
 }
 
+func (s *stream) TrySendDatagram(b []byte) error {
+	if err := s.conn.checkDatagramsEnabled(); err != nil {
+		return err
+	}
+	return s.datagrams.TrySend(b)
+}
+
 func (s *stream) ReceiveDatagram(ctx context.Context) ([]byte, error) {
-	// TODO: reject if datagrams are not negotiated (yet)
+	if err := s.conn.checkDatagramsEnabled(); err != nil {
+		return nil, err
+	}
 	return s.datagrams.Receive(ctx)
 }
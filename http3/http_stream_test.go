@@ -3,10 +3,17 @@ package http3
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"errors"
 	"io"
 	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
 
+	"github.com/quic-go/quic-go"
 	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/internal/qerr"
@@ -104,6 +111,36 @@ var _ = Describe("Stream", func() {
 			Expect(b[:n]).To(Equal([]byte("bar")))
 		})
 
+		It("skips empty DATA frames", func() {
+			buf.Write(getDataFrame(nil))
+			buf.Write(getDataFrame(nil))
+			buf.Write(getDataFrame([]byte("foo")))
+			buf.Write(getDataFrame(nil))
+			buf.Write(getDataFrame([]byte("bar")))
+			buf.Write(getDataFrame(nil))
+			b := make([]byte, 6)
+			n, err := str.Read(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("foo")))
+			n, err = str.Read(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("bar")))
+			n, err = str.Read(b)
+			Expect(err).To(MatchError(io.EOF))
+			Expect(n).To(BeZero())
+		})
+
+		It("reads an empty body consisting of empty DATA frames", func() {
+			buf.Write(getDataFrame(nil))
+			buf.Write(getDataFrame(nil))
+			data, err := io.ReadAll(str)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(BeEmpty())
+			n, err := str.Read(make([]byte, 6))
+			Expect(err).To(MatchError(io.EOF))
+			Expect(n).To(BeZero())
+		})
+
 		It("errors when it can't parse the frame", func() {
 			buf.Write([]byte("invalid"))
 			_, err := str.Read([]byte{0})
@@ -146,9 +183,159 @@ var _ = Describe("Stream", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(b).To(Equal([]byte("foobar")))
 		})
+
+		It("reads from an io.Reader", func() {
+			buf := &bytes.Buffer{}
+			qstr := mockquic.NewMockStream(mockCtrl)
+			var numWrites int
+			qstr.EXPECT().Write(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+				numWrites++
+				return buf.Write(b)
+			}).AnyTimes()
+			str := newStream(qstr, nil, nil, func(r io.Reader, u uint64) error { return nil })
+			data := make([]byte, 5*bodyCopyBufferSize+123)
+			rand.Read(data)
+			// hide the WriteTo method of the bytes.Reader, so that io.Copy uses ReadFrom
+			n, err := io.Copy(str, struct{ io.Reader }{bytes.NewReader(data)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(BeEquivalentTo(len(data)))
+			// the frame header is written together with the payload
+			Expect(numWrites).To(Equal(6))
+
+			var received []byte
+			for buf.Len() > 0 {
+				fp := frameParser{r: buf}
+				f, err := fp.ParseNext()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(f).To(BeAssignableToTypeOf(&dataFrame{}))
+				Expect(f.(*dataFrame).Length).To(BeNumerically("<=", bodyCopyBufferSize))
+				b := make([]byte, f.(*dataFrame).Length)
+				_, err = io.ReadFull(buf, b)
+				Expect(err).ToNot(HaveOccurred())
+				received = append(received, b...)
+			}
+			Expect(received).To(Equal(data))
+		})
+
+		It("doesn't read beyond the limit of an io.LimitedReader", func() {
+			buf := &bytes.Buffer{}
+			qstr := mockquic.NewMockStream(mockCtrl)
+			qstr.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
+			str := newStream(qstr, nil, nil, func(r io.Reader, u uint64) error { return nil })
+			src := bytes.NewReader([]byte("foobar"))
+			n, err := str.ReadFrom(io.LimitReader(src, 3))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(BeEquivalentTo(3))
+			Expect(src.Len()).To(Equal(3))
+			Expect(buf.Bytes()).To(Equal(getDataFrame([]byte("foo"))))
+		})
+
+		It("stops reading when writing to the stream fails", func() {
+			qstr := mockquic.NewMockStream(mockCtrl)
+			testErr := errors.New("stream canceled")
+			qstr.EXPECT().Write(gomock.Any()).Return(0, testErr)
+			str := newStream(qstr, nil, nil, func(r io.Reader, u uint64) error { return nil })
+			src := bytes.NewReader(make([]byte, 3*bodyCopyBufferSize))
+			n, err := str.ReadFrom(src)
+			Expect(err).To(MatchError(testErr))
+			Expect(n).To(BeZero())
+			Expect(src.Len()).To(Equal(2 * bodyCopyBufferSize))
+		})
+
+		It("returns read errors", func() {
+			buf := &bytes.Buffer{}
+			qstr := mockquic.NewMockStream(mockCtrl)
+			qstr.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
+			str := newStream(qstr, nil, nil, func(r io.Reader, u uint64) error { return nil })
+			testErr := errors.New("read error")
+			n, err := str.ReadFrom(io.MultiReader(strings.NewReader("foo"), iotest.ErrReader(testErr)))
+			Expect(err).To(MatchError(testErr))
+			Expect(n).To(BeEquivalentTo(3))
+			Expect(buf.Bytes()).To(Equal(getDataFrame([]byte("foo"))))
+		})
 	})
 })
 
+// discardingQUICStream counts the number of Write calls.
+// For a QUIC stream, every Write call involves locking and signaling the connection.
+type discardingQUICStream struct {
+	quic.Stream
+	writes int
+}
+
+func (s *discardingQUICStream) Write(b []byte) (int, error) {
+	s.writes++
+	return len(b), nil
+}
+
+func BenchmarkStreamCopy(b *testing.B) {
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+
+	b.Run("ReadFrom", func(b *testing.B) {
+		qstr := &discardingQUICStream{}
+		str := newStream(qstr, nil, nil, nil)
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := str.ReadFrom(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(qstr.writes)/float64(b.N), "writes/op")
+	})
+
+	b.Run("Write", func(b *testing.B) {
+		qstr := &discardingQUICStream{}
+		str := newStream(qstr, nil, nil, nil)
+		// hide the ReadFrom method of the stream
+		w := struct{ io.Writer }{str}
+		buf := make([]byte, bodyCopyBufferSize)
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := io.CopyBuffer(w, struct{ io.Reader }{bytes.NewReader(data)}, buf); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(qstr.writes)/float64(b.N), "writes/op")
+	})
+}
+
+// readerQUICStream is a quic.Stream that reads from a bytes.Reader.
+type readerQUICStream struct {
+	quic.Stream
+	r *bytes.Reader
+}
+
+func (s *readerQUICStream) Read(b []byte) (int, error) { return s.r.Read(b) }
+
+func BenchmarkStreamRead(b *testing.B) {
+	// a 1 MB body, sent in DATA frames of 16 KB
+	const frameSize = 16 << 10
+	var data []byte
+	for i := 0; i < 64; i++ {
+		data = (&dataFrame{Length: frameSize}).Append(data)
+		data = append(data, make([]byte, frameSize)...)
+	}
+	buf := make([]byte, 32<<10)
+	qstr := &readerQUICStream{r: bytes.NewReader(nil)}
+	str := newStream(qstr, nil, nil, nil)
+	b.SetBytes(64 * frameSize)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		qstr.r.Reset(data)
+		for {
+			if _, err := str.Read(buf); err != nil {
+				if err != io.EOF {
+					b.Fatal(err)
+				}
+				break
+			}
+		}
+	}
+}
+
 var _ = Describe("Request Stream", func() {
 	var str *requestStream
 	var qstr *mockquic.MockStream
@@ -159,12 +346,14 @@ var _ = Describe("Request Stream", func() {
 		conn := mockquic.NewMockEarlyConnection(mockCtrl)
 		str = newRequestStream(
 			newStream(qstr, newConnection(context.Background(), conn, false, protocol.PerspectiveClient, nil, 0), nil, func(r io.Reader, u uint64) error { return nil }),
-			requestWriter,
-			make(chan struct{}),
-			qpack.NewDecoder(func(qpack.HeaderField) {}),
-			true,
-			math.MaxUint64,
 			&http.Response{},
+			requestStreamOptions{
+				requestWriter:      requestWriter,
+				reqDone:            make(chan struct{}),
+				disableCompression: true,
+				maxHeaderBytes:     math.MaxUint64,
+				clock:              realClock{},
+			},
 		)
 	})
 
@@ -200,4 +389,61 @@ var _ = Describe("Request Stream", func() {
 		Expect(n).To(Equal(6))
 		Expect(b[:n]).To(Equal([]byte("foobar")))
 	})
+
+	Context("responses to Extended CONNECT requests", func() {
+		encodeConnectResponse := func(status int, contentLength int) []byte {
+			headerBuf := &bytes.Buffer{}
+			enc := qpack.NewEncoder(headerBuf)
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: strconv.Itoa(status)})).To(Succeed())
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":protocol", Value: "webtransport"})).To(Succeed())
+			if contentLength >= 0 {
+				Expect(enc.WriteField(qpack.HeaderField{Name: "content-length", Value: strconv.Itoa(contentLength)})).To(Succeed())
+			}
+			Expect(enc.Close()).To(Succeed())
+			b := (&headersFrame{Length: uint64(headerBuf.Len())}).Append(nil)
+			return append(b, headerBuf.Bytes()...)
+		}
+
+		BeforeEach(func() {
+			req, err := http.NewRequest(http.MethodConnect, "https://quic-go.net", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Proto = "webtransport"
+			qstr.EXPECT().Write(gomock.Any()).AnyTimes()
+			Expect(str.SendRequestHeader(req)).To(Succeed())
+		})
+
+		It("establishes the tunnel for 2xx responses", func() {
+			buf := bytes.NewBuffer(encodeConnectResponse(200, -1))
+			buf.Write((&dataFrame{Length: 6}).Append(nil))
+			buf.Write([]byte("foobar"))
+			qstr.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			rsp, err := str.ReadResponse()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(ResponseProtocol(rsp)).To(Equal("webtransport"))
+			Expect(responseBodyOf(rsp).isTunnel).To(BeTrue())
+			// data is exchanged on the tunnel
+			b := make([]byte, 10)
+			n, err := str.Read(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("foobar")))
+		})
+
+		It("doesn't establish the tunnel for other responses", func() {
+			buf := bytes.NewBuffer(encodeConnectResponse(404, 9))
+			buf.Write((&dataFrame{Length: 9}).Append(nil))
+			buf.Write([]byte("not found"))
+			qstr.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			rsp, err := str.ReadResponse()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(404))
+			Expect(rsp.ContentLength).To(BeEquivalentTo(9))
+			Expect(ResponseProtocol(rsp)).To(BeEmpty())
+			Expect(responseBodyOf(rsp).isTunnel).To(BeFalse())
+			// the response body is read like the body of any other response
+			body, err := io.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("not found"))
+		})
+	})
 })
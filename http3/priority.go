@@ -0,0 +1,99 @@
+package http3
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultUrgency is the urgency of a request that doesn't carry a Priority header field,
+// see section 4.1 of RFC 9218.
+const DefaultUrgency = 3
+
+// maxUrgency is the lowest possible urgency.
+const maxUrgency = 7
+
+// Priority is the priority of a request, as defined by the Extensible Prioritization Scheme (RFC 9218).
+// The zero value is not the default priority, use DefaultPriority instead.
+type Priority struct {
+	// Urgency is the urgency of the request, ranging from 0 (highest) to 7 (lowest).
+	// Values larger than 7 are treated as 7.
+	Urgency uint8
+	// Incremental says if the response can be processed incrementally,
+	// i.e. if the server may interleave it with other responses of the same urgency.
+	Incremental bool
+}
+
+// DefaultPriority is the priority that applies to requests without a Priority header field.
+var DefaultPriority = Priority{Urgency: DefaultUrgency}
+
+// String serializes the priority as a Structured Fields Dictionary (RFC 8941),
+// as it is sent in the Priority header field.
+// Parameters that have their default value are omitted.
+// The default priority is therefore serialized as an empty string.
+func (p Priority) String() string {
+	var b []byte
+	if u := min(p.Urgency, maxUrgency); u != DefaultUrgency {
+		b = append(b, "u="...)
+		b = strconv.AppendUint(b, uint64(u), 10)
+	}
+	if p.Incremental {
+		if len(b) > 0 {
+			b = append(b, ", "...)
+		}
+		b = append(b, 'i')
+	}
+	return string(b)
+}
+
+// SetPriority sets the Priority header field of the request.
+// Since the default priority doesn't need to be signaled, the header field is removed
+// if p is the default priority.
+func SetPriority(req *http.Request, p Priority) {
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	if v := p.String(); v != "" {
+		req.Header.Set("Priority", v)
+	} else {
+		req.Header.Del("Priority")
+	}
+}
+
+// urgencyForDeadline maps the time remaining until the deadline of a request to an urgency,
+// see RoundTripOpt.DeadlineBasedPriority.
+// Requests with a deadline far in the future are sent with the default urgency,
+// they are never deprioritized.
+func urgencyForDeadline(remaining time.Duration) uint8 {
+	switch {
+	case remaining <= 100*time.Millisecond:
+		return 0
+	case remaining <= 500*time.Millisecond:
+		return 1
+	case remaining <= 2*time.Second:
+		return 2
+	default:
+		return DefaultUrgency
+	}
+}
+
+// withDeadlineBasedPriority returns a copy of the request with a Priority header field
+// derived from the deadline of the request context.
+// The request is returned unmodified if it already has a Priority header field,
+// or if the context doesn't have a deadline.
+func withDeadlineBasedPriority(req *http.Request) *http.Request {
+	if _, ok := req.Header["Priority"]; ok {
+		return req
+	}
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return req
+	}
+	u := urgencyForDeadline(time.Until(deadline))
+	if u == DefaultUrgency {
+		return req
+	}
+	req = req.Clone(req.Context())
+	SetPriority(req, Priority{Urgency: u})
+	return req
+}
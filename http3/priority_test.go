@@ -0,0 +1,64 @@
+package http3
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deadline-based priorities", func() {
+	It("increases the urgency as the deadline nears", func() {
+		Expect(urgencyForDeadline(time.Hour)).To(BeEquivalentTo(DefaultUrgency))
+		Expect(urgencyForDeadline(3 * time.Second)).To(BeEquivalentTo(DefaultUrgency))
+		Expect(urgencyForDeadline(2 * time.Second)).To(BeEquivalentTo(2))
+		Expect(urgencyForDeadline(time.Second)).To(BeEquivalentTo(2))
+		Expect(urgencyForDeadline(500 * time.Millisecond)).To(BeEquivalentTo(1))
+		Expect(urgencyForDeadline(200 * time.Millisecond)).To(BeEquivalentTo(1))
+		Expect(urgencyForDeadline(100 * time.Millisecond)).To(BeEquivalentTo(0))
+		Expect(urgencyForDeadline(0)).To(BeEquivalentTo(0))
+		Expect(urgencyForDeadline(-time.Second)).To(BeEquivalentTo(0))
+	})
+
+	newRequest := func(timeout time.Duration) *http.Request {
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			DeferCleanup(cancel)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://quic-go.net", nil)
+		Expect(err).ToNot(HaveOccurred())
+		return req
+	}
+
+	It("sets the Priority header field", func() {
+		req := newRequest(50 * time.Millisecond)
+		r := withDeadlineBasedPriority(req)
+		Expect(r.Header.Get("Priority")).To(Equal("u=0"))
+		// the original request is not modified
+		Expect(req.Header).ToNot(HaveKey("Priority"))
+
+		r = withDeadlineBasedPriority(newRequest(time.Second))
+		Expect(r.Header.Get("Priority")).To(Equal("u=2"))
+	})
+
+	It("uses the default priority for requests without a deadline", func() {
+		req := newRequest(0)
+		Expect(withDeadlineBasedPriority(req)).To(BeIdenticalTo(req))
+	})
+
+	It("uses the default priority for requests with a deadline far in the future", func() {
+		req := newRequest(time.Minute)
+		Expect(withDeadlineBasedPriority(req)).To(BeIdenticalTo(req))
+	})
+
+	It("doesn't override an explicit priority", func() {
+		req := newRequest(50 * time.Millisecond)
+		SetPriority(req, Priority{Urgency: 5})
+		Expect(withDeadlineBasedPriority(req)).To(BeIdenticalTo(req))
+		Expect(req.Header.Get("Priority")).To(Equal("u=5"))
+	})
+})
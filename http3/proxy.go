@@ -0,0 +1,291 @@
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/internal/protocol"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// defaultConnectUDPTemplate is the default URI template for CONNECT-UDP, see section 3 of RFC 9298.
+const defaultConnectUDPTemplate = "/.well-known/masque/udp/{target_host}/{target_port}/"
+
+// datagramQueuePollInterval is the interval at which proxiedConn.WriteTo retries sending a datagram
+// while the datagram send queue is full and a write deadline is set.
+const datagramQueuePollInterval = time.Millisecond
+
+// connectUDPRequest creates a CONNECT-UDP request (RFC 9298) for proxying UDP to target (host:port).
+// The path and the query of the proxy URL may contain the {target_host} and {target_port} variables.
+// If the proxy URL doesn't have a path, the default template is used.
+func connectUDPRequest(ctx context.Context, proxyURL *url.URL, target string) (*http.Request, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	u := *proxyURL
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("http3: unsupported proxy scheme: %s", u.Scheme)
+	}
+	template := u.RawPath
+	if template == "" {
+		template = u.Path
+	}
+	if template == "" || template == "/" {
+		template = defaultConnectUDPTemplate
+	}
+	// colons in IPv6 addresses are percent-encoded, see section 2 of RFC 9298
+	escapedHost := strings.ReplaceAll(url.PathEscape(host), ":", "%3A")
+	u.RawPath = strings.NewReplacer("{target_host}", escapedHost, "{target_port}", port).Replace(template)
+	if u.Path, err = url.PathUnescape(u.RawPath); err != nil {
+		return nil, err
+	}
+	u.RawQuery = strings.NewReplacer("{target_host}", url.QueryEscape(host), "{target_port}", port).Replace(u.RawQuery)
+	req, err := http.NewRequestWithContext(ctx, http.MethodConnect, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Proto = "connect-udp"
+	req.Header.Set("Capsule-Protocol", "?1")
+	return req, nil
+}
+
+// dialProxy establishes a CONNECT-UDP tunnel to target through the proxy.
+// The connection to the proxy is shared by all tunnels to that proxy.
+func (t *Transport) dialProxy(ctx context.Context, proxyURL *url.URL, target string) (*proxiedConn, error) {
+	req, err := connectUDPRequest(ctx, proxyURL, target)
+	if err != nil {
+		return nil, err
+	}
+	proxyAddr := authorityAddr(proxyURL.Host, "443")
+	cl, _, err := t.proxyTransport.getClient(ctx, proxyAddr, nil, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-cl.dialing:
+	case <-ctx.Done():
+		cl.useCount.Add(-1)
+		return nil, context.Cause(ctx)
+	}
+	if cl.dialErr != nil {
+		cl.useCount.Add(-1)
+		t.proxyTransport.removeClient(proxyAddr, cl)
+		return nil, cl.dialErr
+	}
+	str, err := cl.rt.OpenRequestStream(ctx)
+	if err != nil {
+		cl.useCount.Add(-1)
+		return nil, err
+	}
+	if err := str.SendRequestHeader(req); err != nil {
+		cl.useCount.Add(-1)
+		return nil, err
+	}
+	rsp, err := str.ReadResponse()
+	if err != nil {
+		cl.useCount.Add(-1)
+		return nil, err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		str.CancelRead(quic.StreamErrorCode(ErrCodeNoError))
+		str.Close()
+		cl.useCount.Add(-1)
+		return nil, fmt.Errorf("http3: proxy responded with %d", rsp.StatusCode)
+	}
+	// quic-go identifies packet conns by their local address, which therefore needs to be unique per tunnel
+	localAddr := proxiedAddr(fmt.Sprintf("%s/%d", cl.conn.LocalAddr(), str.StreamID()))
+	return newProxiedConn(str, localAddr, proxiedAddr(target), func() { cl.useCount.Add(-1) }), nil
+}
+
+// dialThroughProxy establishes a QUIC connection to addr, tunneled through the proxy.
+func (t *Transport) dialThroughProxy(ctx context.Context, proxyURL *url.URL, addr string, tlsConf *tls.Config, conf *quic.Config) (quic.EarlyConnection, error) {
+	pconn, err := t.dialProxy(ctx, proxyURL, addr)
+	if err != nil {
+		return nil, err
+	}
+	// Packets are sent in HTTP datagrams on the connection to the proxy.
+	// Use the smallest packet size, such that they fit into the packets sent to the proxy.
+	conf = conf.Clone()
+	conf.InitialPacketSize = protocol.MinInitialPacketSize
+	conf.DisablePathMTUDiscovery = true
+	tr := &quic.Transport{Conn: pconn}
+	conn, err := tr.DialEarly(ctx, pconn.RemoteAddr(), tlsConf, conf)
+	if err != nil {
+		tr.Close()
+		pconn.Close()
+		return nil, err
+	}
+	context.AfterFunc(conn.Context(), func() {
+		tr.Close()
+		pconn.Close()
+	})
+	return conn, nil
+}
+
+// proxiedAddr is an address of a CONNECT-UDP tunnel.
+type proxiedAddr string
+
+func (a proxiedAddr) Network() string { return "udp" }
+func (a proxiedAddr) String() string  { return string(a) }
+
+// A proxiedConn is a net.PacketConn that sends and receives UDP payloads
+// in HTTP datagrams on a CONNECT-UDP request stream.
+// All packets are sent to (and received from) the target of the tunnel.
+type proxiedConn struct {
+	str        RequestStream
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	onClose    func()
+
+	ctx    context.Context // canceled when the conn is closed
+	cancel context.CancelFunc
+
+	mx            sync.Mutex
+	readCtx       context.Context // canceled when the read deadline changes
+	readCancel    context.CancelFunc
+	writeDeadline time.Time
+
+	closeOnce sync.Once
+}
+
+var _ net.PacketConn = &proxiedConn{}
+
+func newProxiedConn(str RequestStream, localAddr, remoteAddr net.Addr, onClose func()) *proxiedConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &proxiedConn{
+		str:        str,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		onClose:    onClose,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	c.readCtx, c.readCancel = context.WithCancel(ctx)
+	return c
+}
+
+func (c *proxiedConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mx.Lock()
+		ctx := c.readCtx
+		c.mx.Unlock()
+
+		data, err := c.str.ReceiveDatagram(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				return 0, nil, err
+			}
+			if c.ctx.Err() != nil {
+				return 0, nil, net.ErrClosed
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			continue // the read deadline was changed
+		}
+		contextID, n, err := quicvarint.Parse(data)
+		// Datagrams with an unknown context ID are dropped, see section 4 of RFC 9298.
+		if err != nil || contextID != 0 {
+			continue
+		}
+		return copy(b, data[n:]), c.remoteAddr, nil
+	}
+}
+
+func (c *proxiedConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	data := make([]byte, 0, len(b)+1)
+	data = quicvarint.Append(data, 0) // context ID 0 is used for UDP payloads
+	data = append(data, b...)
+
+	c.mx.Lock()
+	deadline := c.writeDeadline
+	c.mx.Unlock()
+	if deadline.IsZero() {
+		if err := c.str.SendDatagram(data); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	// SendDatagram blocks while the datagram send queue of the connection is full.
+	// Since there's no way to get notified when there's space in the queue,
+	// poll until the datagram is queued or the write deadline expires.
+	for {
+		err := c.str.TrySendDatagram(data)
+		if err == nil {
+			return len(b), nil
+		}
+		if !errors.Is(err, quic.ErrDatagramQueueFull) {
+			return 0, err
+		}
+		c.mx.Lock()
+		deadline = c.writeDeadline
+		c.mx.Unlock()
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(datagramQueuePollInterval)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return 0, net.ErrClosed
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *proxiedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		c.str.CancelRead(quic.StreamErrorCode(ErrCodeNoError))
+		c.str.Close()
+		c.onClose()
+	})
+	return nil
+}
+
+func (c *proxiedConn) LocalAddr() net.Addr  { return c.localAddr }
+func (c *proxiedConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+func (c *proxiedConn) SetDeadline(t time.Time) error {
+	_ = c.SetWriteDeadline(t) // SetWriteDeadline never errors
+	return c.SetReadDeadline(t)
+}
+
+func (c *proxiedConn) SetReadDeadline(t time.Time) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.readCancel()
+	if t.IsZero() {
+		c.readCtx, c.readCancel = context.WithCancel(c.ctx)
+	} else {
+		c.readCtx, c.readCancel = context.WithDeadline(c.ctx, t)
+	}
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for WriteTo calls.
+// Sending a datagram only blocks while the datagram send queue of the connection is full.
+// A zero value means WriteTo blocks until the datagram was queued.
+func (c *proxiedConn) SetWriteDeadline(t time.Time) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+// SetReadBuffer and SetWriteBuffer are no-ops, since there's no socket involved.
+// They prevent quic-go from warning about the buffer sizes.
+func (c *proxiedConn) SetReadBuffer(int) error  { return nil }
+func (c *proxiedConn) SetWriteBuffer(int) error { return nil }
@@ -0,0 +1,147 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// datagramRequestStream is a RequestStream that only supports sending and receiving datagrams.
+type datagramRequestStream struct {
+	RequestStream
+	sent      [][]byte
+	received  chan []byte
+	queueFull atomic.Bool
+}
+
+func (s *datagramRequestStream) SendDatagram(b []byte) error {
+	s.sent = append(s.sent, b)
+	return nil
+}
+
+func (s *datagramRequestStream) TrySendDatagram(b []byte) error {
+	if s.queueFull.Load() {
+		return quic.ErrDatagramQueueFull
+	}
+	s.sent = append(s.sent, b)
+	return nil
+}
+
+func (s *datagramRequestStream) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	select {
+	case b := <-s.received:
+		return b, nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+var _ = Describe("CONNECT-UDP", func() {
+	Context("creating requests", func() {
+		parse := func(s string) *url.URL {
+			u, err := url.Parse(s)
+			Expect(err).ToNot(HaveOccurred())
+			return u
+		}
+
+		It("uses the default URI template", func() {
+			req, err := connectUDPRequest(context.Background(), parse("https://proxy.example:4443"), "quic-go.net:443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(req.Method).To(Equal("CONNECT"))
+			Expect(req.Proto).To(Equal("connect-udp"))
+			Expect(req.Header.Get("Capsule-Protocol")).To(Equal("?1"))
+			Expect(req.URL.String()).To(Equal("https://proxy.example:4443/.well-known/masque/udp/quic-go.net/443/"))
+		})
+
+		It("expands a custom URI template", func() {
+			req, err := connectUDPRequest(context.Background(), parse("https://proxy.example/masque?h={target_host}&p={target_port}"), "quic-go.net:443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(req.URL.String()).To(Equal("https://proxy.example/masque?h=quic-go.net&p=443"))
+		})
+
+		It("percent-encodes IPv6 addresses", func() {
+			req, err := connectUDPRequest(context.Background(), parse("https://proxy.example"), "[2001:db8::42]:443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(req.URL.String()).To(Equal("https://proxy.example/.well-known/masque/udp/2001%3Adb8%3A%3A42/443/"))
+		})
+
+		It("rejects proxies that don't use https", func() {
+			_, err := connectUDPRequest(context.Background(), parse("socks5://proxy.example"), "quic-go.net:443")
+			Expect(err).To(MatchError("http3: unsupported proxy scheme: socks5"))
+		})
+	})
+
+	Context("tunneled packets", func() {
+		var (
+			str  *datagramRequestStream
+			conn *proxiedConn
+		)
+
+		BeforeEach(func() {
+			str = &datagramRequestStream{received: make(chan []byte, 10)}
+			conn = newProxiedConn(str, proxiedAddr("local"), proxiedAddr("quic-go.net:443"), func() {})
+		})
+
+		It("sends packets with context ID 0", func() {
+			n, err := conn.WriteTo([]byte("foobar"), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(6))
+			Expect(str.sent).To(Equal([][]byte{append([]byte{0}, "foobar"...)}))
+		})
+
+		It("receives packets, dropping datagrams with an unknown context ID", func() {
+			str.received <- append([]byte{2}, "foo"...)
+			str.received <- append([]byte{0}, "bar"...)
+			b := make([]byte, 100)
+			n, addr, err := conn.ReadFrom(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("bar")))
+			Expect(addr.String()).To(Equal("quic-go.net:443"))
+		})
+
+		It("respects the read deadline", func() {
+			Expect(conn.SetReadDeadline(time.Now().Add(scaleDuration(10 * time.Millisecond)))).To(Succeed())
+			_, _, err := conn.ReadFrom(make([]byte, 100))
+			Expect(errors.Is(err, os.ErrDeadlineExceeded)).To(BeTrue())
+			// reading can be resumed after resetting the deadline
+			Expect(conn.SetReadDeadline(time.Time{})).To(Succeed())
+			str.received <- append([]byte{0}, "foo"...)
+			n, _, err := conn.ReadFrom(make([]byte, 100))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(3))
+		})
+
+		It("respects the write deadline", func() {
+			str.queueFull.Store(true)
+			Expect(conn.SetWriteDeadline(time.Now().Add(scaleDuration(10 * time.Millisecond)))).To(Succeed())
+			_, err := conn.WriteTo([]byte("foo"), nil)
+			Expect(errors.Is(err, os.ErrDeadlineExceeded)).To(BeTrue())
+			Expect(str.sent).To(BeEmpty())
+
+			// the datagram is sent once there's space in the queue
+			Expect(conn.SetWriteDeadline(time.Now().Add(time.Hour))).To(Succeed())
+			time.AfterFunc(scaleDuration(10*time.Millisecond), func() { str.queueFull.Store(false) })
+			n, err := conn.WriteTo([]byte("bar"), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(3))
+			Expect(str.sent).To(Equal([][]byte{append([]byte{0}, "bar"...)}))
+		})
+
+		It("stops waiting for the datagram send queue when closed", func() {
+			str.queueFull.Store(true)
+			Expect(conn.SetWriteDeadline(time.Now().Add(time.Hour))).To(Succeed())
+			time.AfterFunc(scaleDuration(10*time.Millisecond), func() { conn.cancel() })
+			_, err := conn.WriteTo([]byte("foo"), nil)
+			Expect(err).To(MatchError(net.ErrClosed))
+		})
+	})
+})
@@ -0,0 +1,83 @@
+package http3
+
+import (
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+
+	"github.com/quic-go/qpack"
+)
+
+// QPACKEventType is the type of a QPACKEvent.
+type QPACKEventType uint8
+
+const (
+	// QPACKEventHeadersEncoded is emitted when a header block was encoded.
+	QPACKEventHeadersEncoded QPACKEventType = iota + 1
+	// QPACKEventHeadersDecoded is emitted when a header block (including trailers) was decoded.
+	QPACKEventHeadersDecoded
+	// QPACKEventEncoderStreamOpened is emitted when the peer opened its QPACK encoder stream.
+	QPACKEventEncoderStreamOpened
+	// QPACKEventDecoderStreamOpened is emitted when the peer opened its QPACK decoder stream.
+	QPACKEventDecoderStreamOpened
+)
+
+func (t QPACKEventType) String() string {
+	switch t {
+	case QPACKEventHeadersEncoded:
+		return "headers encoded"
+	case QPACKEventHeadersDecoded:
+		return "headers decoded"
+	case QPACKEventEncoderStreamOpened:
+		return "encoder stream opened"
+	case QPACKEventDecoderStreamOpened:
+		return "decoder stream opened"
+	default:
+		return "unknown QPACK event"
+	}
+}
+
+// A QPACKEvent describes QPACK activity on a connection.
+//
+// Since the QPACK implementation doesn't use the dynamic table (yet), header blocks
+// only ever reference the static table or contain literal field lines, and no
+// instructions are sent on the encoder and decoder streams.
+type QPACKEvent struct {
+	Type QPACKEventType
+	// StreamID is the ID of the request stream for header block events,
+	// and the ID of the unidirectional stream for encoder and decoder stream events.
+	StreamID quic.StreamID
+	// HeaderBlockLen is the length of the encoded header block.
+	// It is only set for header block events.
+	HeaderBlockLen int
+	// Fields are the header fields contained in the header block.
+	// It is only set for header block events.
+	Fields []qpack.HeaderField
+}
+
+func (c *connection) tracingQPACK() bool {
+	return c != nil && c.qpackTracer != nil
+}
+
+// traceEncodedHeaders emits a QPACKEventHeadersEncoded event for a serialized HEADERS frame.
+func (w *requestWriter) traceEncodedHeaders(id quic.StreamID, frame []byte) {
+	// skip the frame type and length
+	_, l, err := quicvarint.Parse(frame)
+	if err != nil {
+		return
+	}
+	_, n, err := quicvarint.Parse(frame[l:])
+	if err != nil {
+		return
+	}
+	headerBlock := frame[l+n:]
+	fields, err := decodeHeaderBlock(headerBlock)
+	if err != nil {
+		return
+	}
+	w.qpackTracer(QPACKEvent{
+		Type:           QPACKEventHeadersEncoded,
+		StreamID:       id,
+		HeaderBlockLen: len(headerBlock),
+		Fields:         fields,
+	})
+}
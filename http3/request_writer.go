@@ -7,6 +7,9 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,14 +28,31 @@ type requestWriter struct {
 	mutex     sync.Mutex
 	encoder   *qpack.Encoder
 	headerBuf *bytes.Buffer
+	// used to encode the header fields that are not part of a HeaderTemplate
+	deltaEncoder *qpack.Encoder
+	deltaBuf     *bytes.Buffer
+
+	// If set, requests containing connection-specific header fields are rejected.
+	// Otherwise, these header fields are silently removed.
+	rejectConnectionHeaders bool
+	// The User-Agent sent when a request doesn't set one.
+	// If empty, defaultUserAgent is used.
+	userAgent string
+	// The Accept-Encoding sent when a request doesn't set one, and the Transport doesn't request gzip.
+	// If empty, no Accept-Encoding is sent.
+	acceptEncoding string
+	// If set, it is called for every header block that is encoded.
+	qpackTracer func(QPACKEvent)
 }
 
 func newRequestWriter() *requestWriter {
 	headerBuf := &bytes.Buffer{}
-	encoder := qpack.NewEncoder(headerBuf)
+	deltaBuf := &bytes.Buffer{}
 	return &requestWriter{
-		encoder:   encoder,
-		headerBuf: headerBuf,
+		encoder:      qpack.NewEncoder(headerBuf),
+		headerBuf:    headerBuf,
+		deltaEncoder: qpack.NewEncoder(deltaBuf),
+		deltaBuf:     deltaBuf,
 	}
 }
 
@@ -42,6 +62,9 @@ func (w *requestWriter) WriteRequestHeader(str quic.Stream, req *http.Request, g
 	if err := w.writeHeaders(buf, req, gzip); err != nil {
 		return err
 	}
+	if w.qpackTracer != nil {
+		w.traceEncodedHeaders(str.StreamID(), buf.Bytes())
+	}
 	_, err := str.Write(buf.Bytes())
 	return err
 }
@@ -52,7 +75,13 @@ func (w *requestWriter) writeHeaders(wr io.Writer, req *http.Request, gzip bool)
 	defer w.encoder.Close()
 	defer w.headerBuf.Reset()
 
-	if err := w.encodeHeaders(req, gzip, "", actualContentLength(req)); err != nil {
+	var err error
+	if tmpl, _ := req.Context().Value(HeaderTemplateContextKey).(*HeaderTemplate); tmpl != nil && tmpl.matches(req) {
+		err = w.encodeHeadersWithTemplate(tmpl, req, gzip, actualContentLength(req))
+	} else {
+		err = w.encodeHeaders(req, w.addedAcceptEncoding(req, gzip), "", actualContentLength(req))
+	}
+	if err != nil {
 		return err
 	}
 
@@ -61,10 +90,176 @@ func (w *requestWriter) writeHeaders(wr io.Writer, req *http.Request, gzip bool)
 	if _, err := wr.Write(b); err != nil {
 		return err
 	}
-	_, err := wr.Write(w.headerBuf.Bytes())
+	_, err = wr.Write(w.headerBuf.Bytes())
 	return err
 }
 
+// addedAcceptEncoding returns the value of the Accept-Encoding header field that is added to the request.
+// It returns an empty string if no Accept-Encoding is added.
+func (w *requestWriter) addedAcceptEncoding(req *http.Request, addGzipHeader bool) string {
+	if addGzipHeader {
+		return "gzip"
+	}
+	if w.acceptEncoding != "" && req.Header.Get("Accept-Encoding") == "" {
+		return w.acceptEncoding
+	}
+	return ""
+}
+
+// HeaderTemplateContextKey is a context key. It can be used to send a request
+// using a HeaderTemplate created by ClientConn.PrepareHeaders.
+// The associated value must be of type *http3.HeaderTemplate.
+//
+// The template is only used if the request has the same method, URL and Host as
+// the template request, and if it contains all of its header fields with the same values.
+// Otherwise, the request header is encoded as usual.
+var HeaderTemplateContextKey = &contextKey{"header-template"}
+
+// A HeaderTemplate contains the QPACK-encoded header fields of a request.
+// It allows sending many requests with the same method, URL and header fields
+// without encoding these header fields every time.
+// Header fields that are not part of the template, as well as the Content-Length
+// and the Accept-Encoding header fields, are encoded when the request is sent.
+//
+// Since the QPACK encoder doesn't use the dynamic table, a template can be used
+// for requests on any connection.
+type HeaderTemplate struct {
+	method string
+	host   string
+	url    url.URL
+	proto  string
+	header http.Header
+
+	// the encoded field lines, without the header block prefix
+	fields []byte
+}
+
+func (t *HeaderTemplate) matches(req *http.Request) bool {
+	if req.Method != t.method || req.Host != t.host || req.URL == nil || *req.URL != t.url {
+		return false
+	}
+	if isExtendedConnectRequest(req) && req.Proto != t.proto {
+		return false
+	}
+	// The template might contain the default User-Agent.
+	if len(req.Header["User-Agent"]) > 0 && len(t.header["User-Agent"]) == 0 {
+		return false
+	}
+	for k, vv := range t.header {
+		if !slices.Equal(req.Header[k], vv) {
+			return false
+		}
+	}
+	return true
+}
+
+// prepareHeaders encodes the header fields of a request into a HeaderTemplate.
+func (w *requestWriter) prepareHeaders(req *http.Request) (*HeaderTemplate, error) {
+	if req.URL == nil {
+		return nil, errors.New("http3: nil Request.URL")
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	defer w.encoder.Close()
+	defer w.headerBuf.Reset()
+
+	// A content length of -1 prevents the Content-Length header field from being encoded,
+	// and an empty accept encoding prevents the Accept-Encoding header field from being added.
+	// Both are encoded when the request is sent.
+	if err := w.encodeHeaders(req, "", "", -1); err != nil {
+		return nil, err
+	}
+	return &HeaderTemplate{
+		method: req.Method,
+		host:   req.Host,
+		url:    *req.URL,
+		proto:  req.Proto,
+		header: req.Header.Clone(),
+		// skip the header block prefix
+		fields: slices.Clone(w.headerBuf.Bytes()[headerBlockPrefixLen:]),
+	}, nil
+}
+
+// The QPACK encoder doesn't use the dynamic table, so the prefix always consists of
+// a zero Required Insert Count and a zero Delta Base.
+const headerBlockPrefixLen = 2
+
+// encodeHeadersWithTemplate encodes the header fields of a request that matches the template.
+// Only the header fields that are not part of the template are encoded.
+func (w *requestWriter) encodeHeadersWithTemplate(tmpl *HeaderTemplate, req *http.Request, addGzipHeader bool, contentLength int64) error {
+	if w.rejectConnectionHeaders {
+		if err := checkConnectionHeaders(req.Header); err != nil {
+			return err
+		}
+	}
+	for k, vv := range req.Header {
+		if _, ok := tmpl.header[k]; ok {
+			continue
+		}
+		if !httpguts.ValidHeaderFieldName(k) {
+			return fmt.Errorf("invalid HTTP header name %q", k)
+		}
+		for _, v := range vv {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				return fmt.Errorf("invalid HTTP header value %q for header %q", v, k)
+			}
+		}
+	}
+
+	w.headerBuf.Write(make([]byte, headerBlockPrefixLen))
+	w.headerBuf.Write(tmpl.fields)
+	// The encoder writes the header block prefix before the first field,
+	// so we encode the remaining fields separately, and then strip the prefix.
+	fields := w.deltaBuf
+	defer fields.Reset()
+	enc := w.deltaEncoder
+	defer enc.Close()
+	for k, vv := range req.Header {
+		if _, ok := tmpl.header[k]; ok || skipRequestHeaderField(k) {
+			continue
+		}
+		if strings.EqualFold(k, "te") {
+			if !containsTrailers(vv) {
+				continue
+			}
+			vv = []string{"trailers"}
+		} else if strings.EqualFold(k, "user-agent") {
+			// The template didn't contain a User-Agent, otherwise it would have been skipped above.
+			// matches makes sure that the request doesn't have one either.
+			continue
+		}
+		for _, v := range vv {
+			enc.WriteField(qpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	if shouldSendReqContentLength(req.Method, contentLength) {
+		enc.WriteField(qpack.HeaderField{Name: "content-length", Value: strconv.FormatInt(contentLength, 10)})
+	}
+	if ae := w.addedAcceptEncoding(req, addGzipHeader); ae != "" {
+		enc.WriteField(qpack.HeaderField{Name: "accept-encoding", Value: ae})
+	}
+	if fields.Len() > 0 {
+		w.headerBuf.Write(fields.Bytes()[headerBlockPrefixLen:])
+	}
+	return nil
+}
+
+// skipRequestHeaderField says if a header field from the http.Request.Header is not sent.
+func skipRequestHeaderField(k string) bool {
+	if strings.EqualFold(k, "host") || strings.EqualFold(k, "content-length") {
+		// Host is :authority, already sent.
+		// Content-Length is automatic, set below.
+		return true
+	}
+	// Per 8.1.2.2 Connection-Specific Header
+	// Fields, don't send connection-specific
+	// fields. We have already checked if any
+	// are error-worthy so just ignore the rest.
+	return strings.EqualFold(k, "connection") || strings.EqualFold(k, "proxy-connection") ||
+		strings.EqualFold(k, "transfer-encoding") || strings.EqualFold(k, "upgrade") ||
+		strings.EqualFold(k, "keep-alive")
+}
+
 func isExtendedConnectRequest(req *http.Request) bool {
 	return req.Method == http.MethodConnect && req.Proto != "" && req.Proto != "HTTP/1.1"
 }
@@ -73,7 +268,7 @@ func isExtendedConnectRequest(req *http.Request) bool {
 // Modified to support Extended CONNECT:
 // Contrary to what the godoc for the http.Request says,
 // we do respect the Proto field if the method is CONNECT.
-func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, trailers string, contentLength int64) error {
+func (w *requestWriter) encodeHeaders(req *http.Request, acceptEncoding string, trailers string, contentLength int64) error {
 	host := req.Host
 	if host == "" {
 		host = req.URL.Host
@@ -91,7 +286,12 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 
 	var path string
 	if req.Method != http.MethodConnect || isExtendedConnect {
+		// RequestURI normalizes an empty path to "/".
 		path = req.URL.RequestURI()
+		// The asterisk-form is only allowed for server-wide OPTIONS requests, see section 7.1 of RFC 9110.
+		if path == "*" && req.Method != http.MethodOptions {
+			return fmt.Errorf("invalid request :path %q for method %s", path, req.Method)
+		}
 		if !validPseudoPath(path) {
 			orig := path
 			path = strings.TrimPrefix(path, req.URL.Scheme+"://"+host)
@@ -105,6 +305,12 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 		}
 	}
 
+	if w.rejectConnectionHeaders {
+		if err := checkConnectionHeaders(req.Header); err != nil {
+			return err
+		}
+	}
+
 	// Check for any invalid headers and return an error before we
 	// potentially pollute our hpack state. (We want to be able to
 	// continue to reuse the hpack encoder for future requests)
@@ -140,18 +346,15 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 
 		var didUA bool
 		for k, vv := range req.Header {
-			if strings.EqualFold(k, "host") || strings.EqualFold(k, "content-length") {
-				// Host is :authority, already sent.
-				// Content-Length is automatic, set below.
-				continue
-			} else if strings.EqualFold(k, "connection") || strings.EqualFold(k, "proxy-connection") ||
-				strings.EqualFold(k, "transfer-encoding") || strings.EqualFold(k, "upgrade") ||
-				strings.EqualFold(k, "keep-alive") {
-				// Per 8.1.2.2 Connection-Specific Header
-				// Fields, don't send connection-specific
-				// fields. We have already checked if any
-				// are error-worthy so just ignore the rest.
+			if skipRequestHeaderField(k) {
 				continue
+			} else if strings.EqualFold(k, "te") {
+				// The TE header field may only be sent with the value "trailers",
+				// see section 4.2 of RFC 9114. Drop all other values.
+				if !containsTrailers(vv) {
+					continue
+				}
+				vv = []string{"trailers"}
 			} else if strings.EqualFold(k, "user-agent") {
 				// Match Go's http1 behavior: at most one
 				// User-Agent. If set to nil or empty string,
@@ -175,11 +378,15 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 		if shouldSendReqContentLength(req.Method, contentLength) {
 			f("content-length", strconv.FormatInt(contentLength, 10))
 		}
-		if addGzipHeader {
-			f("accept-encoding", "gzip")
+		if acceptEncoding != "" {
+			f("accept-encoding", acceptEncoding)
 		}
 		if !didUA {
-			f("user-agent", defaultUserAgent)
+			if w.userAgent != "" {
+				f("user-agent", w.userAgent)
+			} else {
+				f("user-agent", defaultUserAgent)
+			}
 		}
 	}
 
@@ -213,20 +420,64 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 	return nil
 }
 
+// checkConnectionHeaders returns an error if the header contains any connection-specific header fields,
+// or a TE header field with a value other than "trailers".
+// See section 4.2 of RFC 9114.
+func checkConnectionHeaders(hdr http.Header) error {
+	for _, name := range invalidHeaderFields {
+		if vv := hdr.Values(name); len(vv) > 0 {
+			return fmt.Errorf("http3: invalid connection-specific request header %s: %q", name, vv)
+		}
+	}
+	if vv := hdr.Values("Te"); len(vv) > 0 && (len(vv) > 1 || !strings.EqualFold(vv[0], "trailers")) {
+		return fmt.Errorf("http3: invalid TE request header: %q", vv)
+	}
+	return nil
+}
+
+// containsTrailers says if the "trailers" token is contained in the values of a TE header field.
+// Each value can be a comma-separated list of tokens, e.g. "gzip, trailers".
+func containsTrailers(vv []string) bool {
+	for _, v := range vv {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // authorityAddr returns a given authority (a host/IP, or host:port / ip:port)
-// and returns a host:port. The port 443 is added if needed.
-func authorityAddr(authority string) (addr string) {
+// and returns a host:port. The defaultPort is added if the authority doesn't contain a port.
+// If defaultPort is empty, and the authority doesn't contain a port, only the host is returned.
+// IP addresses are normalized and host names are converted to lower-case ASCII,
+// such that the same host always results in the same address.
+func authorityAddr(authority, defaultPort string) (addr string) {
 	host, port, err := net.SplitHostPort(authority)
 	if err != nil { // authority didn't have a port
-		port = "443"
 		host = authority
+		// IPv6 address literal, without a port
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		}
 	}
-	if a, err := idna.ToASCII(host); err == nil {
-		host = a
+	if port == "" {
+		port = defaultPort
 	}
-	// IPv6 address literal, without a port:
-	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
-		return host + ":" + port
+	if ip, err := netip.ParseAddr(host); err == nil {
+		host = ip.String()
+	} else {
+		if a, err := idna.ToASCII(host); err == nil {
+			host = a
+		}
+		host = strings.ToLower(host)
+	}
+	if port == "" {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
 	}
 	return net.JoinHostPort(host, port)
 }
@@ -252,7 +503,7 @@ func validPseudoPath(v string) bool {
 // req.ContentLength, where 0 actually means zero (not unknown) and -1
 // means unknown.
 func actualContentLength(req *http.Request) int64 {
-	if req.Body == nil {
+	if req.Body == nil || req.Body == http.NoBody {
 		return 0
 	}
 	if req.ContentLength != 0 {
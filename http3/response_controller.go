@@ -0,0 +1,83 @@
+package http3
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// A ResponseController controls the request stream of a response received by the client.
+// It is the client-side counterpart of the http.ResponseController.
+//
+// Methods return http.ErrNotSupported if the response wasn't received by this package,
+// or if the Body of the response was replaced.
+type ResponseController struct {
+	body *hijackableBody
+}
+
+// NewResponseController creates a ResponseController for a response.
+func NewResponseController(rsp *http.Response) *ResponseController {
+	return &ResponseController{body: responseBodyOf(rsp)}
+}
+
+// SetReadDeadline sets the deadline for reading the response body.
+// It is backed by the read deadline of the request stream.
+// If the deadline is exceeded, reading the body returns an error that satisfies the net.Error interface,
+// with Timeout() returning true. Reading can be resumed after extending the deadline.
+// A zero value means no deadline.
+func (c *ResponseController) SetReadDeadline(t time.Time) error {
+	if c.body == nil {
+		return http.ErrNotSupported
+	}
+	return c.body.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for writing to the request stream,
+// i.e. for sending the remainder of the request body,
+// or for writes to the RequestStreamWriter of a CONNECT request.
+// A zero value means no deadline.
+func (c *ResponseController) SetWriteDeadline(t time.Time) error {
+	if c.body == nil {
+		return http.ErrNotSupported
+	}
+	return c.body.body.str.SetWriteDeadline(t)
+}
+
+// SetPriority changes the priority of the request while the response is still being received,
+// by sending a PRIORITY_UPDATE frame on the control stream (see section 7 of RFC 9218).
+// This can be used to deprioritize a large download when a more important request is started.
+// The server is free to ignore the update.
+func (c *ResponseController) SetPriority(p Priority) error {
+	if c.body == nil || c.body.updatePriority == nil {
+		return http.ErrNotSupported
+	}
+	return c.body.updatePriority(p)
+}
+
+// EnableFullDuplex indicates that the application will interleave sending the request body
+// with reading the response body.
+// Unlike HTTP/1.x, HTTP/3 streams are always full-duplex: the client sends the request body
+// concurrently with receiving the response, and the response can be read before the request
+// body has been sent completely. Therefore, this only checks that the response was received
+// by this package.
+func (c *ResponseController) EnableFullDuplex() error {
+	if c.body == nil {
+		return http.ErrNotSupported
+	}
+	return nil
+}
+
+// Abort aborts the request by resetting both directions of the request stream with the given error code.
+// If the request body is still being sent, the server sees the upload fail with this error code,
+// allowing it to distinguish an aborted upload from a complete one, e.g. by using ErrCodeRequestIncomplete.
+// Reading the response body returns an error afterwards.
+// The response body still needs to be closed.
+func (c *ResponseController) Abort(code ErrCode) error {
+	if c.body == nil {
+		return http.ErrNotSupported
+	}
+	c.body.body.str.CancelWrite(quic.StreamErrorCode(code))
+	c.body.body.str.CancelRead(quic.StreamErrorCode(code))
+	return nil
+}
@@ -0,0 +1,73 @@
+package http3
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response Controller", func() {
+	var (
+		str *mockquic.MockStream
+		rsp *http.Response
+	)
+
+	BeforeEach(func() {
+		str = mockquic.NewMockStream(mockCtrl)
+		rsp = &http.Response{Body: newResponseBody(&stream{Stream: str}, -1, make(chan struct{}))}
+	})
+
+	It("sets the read deadline", func() {
+		deadline := time.Now().Add(time.Hour)
+		str.EXPECT().SetReadDeadline(deadline)
+		Expect(NewResponseController(rsp).SetReadDeadline(deadline)).To(Succeed())
+	})
+
+	It("sets the write deadline", func() {
+		deadline := time.Now().Add(time.Hour)
+		str.EXPECT().SetWriteDeadline(deadline)
+		Expect(NewResponseController(rsp).SetWriteDeadline(deadline)).To(Succeed())
+	})
+
+	It("enables full-duplex", func() {
+		Expect(NewResponseController(rsp).EnableFullDuplex()).To(Succeed())
+	})
+
+	It("sets the priority", func() {
+		var priority Priority
+		responseBodyOf(rsp).updatePriority = func(p Priority) error {
+			priority = p
+			return nil
+		}
+		Expect(NewResponseController(rsp).SetPriority(Priority{Urgency: 1})).To(Succeed())
+		Expect(priority).To(Equal(Priority{Urgency: 1}))
+	})
+
+	It("aborts the request", func() {
+		str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestIncomplete))
+		str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestIncomplete))
+		Expect(NewResponseController(rsp).Abort(ErrCodeRequestIncomplete)).To(Succeed())
+	})
+
+	It("works with buffered bodies", func() {
+		deadline := time.Now().Add(time.Hour)
+		str.EXPECT().SetReadDeadline(deadline)
+		rsp.Body = newBufferedBody(rsp.Body, 1024)
+		Expect(NewResponseController(rsp).SetReadDeadline(deadline)).To(Succeed())
+	})
+
+	It("doesn't support responses that weren't received by this package", func() {
+		rc := NewResponseController(&http.Response{Body: io.NopCloser(nil)})
+		Expect(rc.SetReadDeadline(time.Now())).To(MatchError(http.ErrNotSupported))
+		Expect(rc.SetWriteDeadline(time.Now())).To(MatchError(http.ErrNotSupported))
+		Expect(rc.EnableFullDuplex()).To(MatchError(http.ErrNotSupported))
+		Expect(rc.SetPriority(DefaultPriority)).To(MatchError(http.ErrNotSupported))
+		Expect(rc.Abort(ErrCodeRequestCanceled)).To(MatchError(http.ErrNotSupported))
+	})
+})
@@ -0,0 +1,183 @@
+package http3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxDownloadResumptions is the maximum number of times a download is resumed,
+// see RoundTripOpt.ResumeDownloads.
+const maxDownloadResumptions = 3
+
+// resumableBody is the body of a response that is resumed using a Range request
+// if reading from it fails before the whole body was received.
+type resumableBody struct {
+	mutex  sync.Mutex
+	body   io.ReadCloser // replaced when the download is resumed
+	closed bool
+
+	req           *http.Request
+	etag          string
+	contentLength int64 // -1 if unknown
+	roundTrip     func(*http.Request) (*http.Response, error)
+
+	offset      int64 // number of bytes delivered to the application
+	resumptions int
+}
+
+var _ io.ReadCloser = &resumableBody{}
+
+// makeResumable wraps the body of the response, if the download can be resumed:
+// It must be the successful response to a GET request without a body that didn't request a range itself,
+// and it must carry a strong ETag, so that the server can guarantee that the ranges belong to the same representation.
+// Bodies that were decompressed transparently can't be resumed, since the offsets would refer to the decompressed data.
+func makeResumable(req *http.Request, rsp *http.Response, roundTrip func(*http.Request) (*http.Response, error)) {
+	if req.Method != http.MethodGet || rsp.StatusCode != http.StatusOK || rsp.Uncompressed {
+		return
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		return
+	}
+	if _, ok := req.Header["Range"]; ok {
+		return
+	}
+	etag := rsp.Header.Get("Etag")
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return
+	}
+	rsp.Body = &resumableBody{
+		body:          rsp.Body,
+		req:           req,
+		etag:          etag,
+		contentLength: rsp.ContentLength,
+		roundTrip:     roundTrip,
+	}
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		b.mutex.Lock()
+		if b.closed {
+			b.mutex.Unlock()
+			return 0, errReadOnClosedBody
+		}
+		body := b.body
+		b.mutex.Unlock()
+
+		n, err := body.Read(p)
+		b.offset += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if b.contentLength >= 0 && b.offset == b.contentLength {
+			// the body was received completely, only the end of the stream is missing
+			return n, io.EOF
+		}
+		// Only resume if the body was truncated, e.g. because the connection was lost.
+		// Other errors, like an exceeded deadline or body size limit, are returned to the application.
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			return n, err
+		}
+		if rerr := b.resume(); rerr != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume requests the remainder of the body using a Range request.
+// The If-Range header field makes sure that the server only responds with a partial response
+// if the representation didn't change since the original response.
+func (b *resumableBody) resume() error {
+	if b.resumptions >= maxDownloadResumptions {
+		return errors.New("http3: too many download resumptions")
+	}
+	if err := b.req.Context().Err(); err != nil {
+		return err
+	}
+	if b.isClosed() {
+		return errReadOnClosedBody
+	}
+	b.resumptions++
+	req := b.req.Clone(b.req.Context())
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+	req.Header.Set("If-Range", b.etag)
+	rsp, err := b.roundTrip(req)
+	if err != nil {
+		return err
+	}
+	if err := b.checkPartialResponse(rsp); err != nil {
+		rsp.Body.Close()
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	// the body might have been closed while the Range request was sent
+	if b.closed {
+		rsp.Body.Close()
+		return errReadOnClosedBody
+	}
+	b.body.Close()
+	b.body = rsp.Body
+	return nil
+}
+
+// currentBody returns the body that is currently read from.
+func (b *resumableBody) currentBody() io.ReadCloser {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.body
+}
+
+func (b *resumableBody) isClosed() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.closed
+}
+
+func (b *resumableBody) checkPartialResponse(rsp *http.Response) error {
+	if rsp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("http3: unexpected status code for a range request: %d", rsp.StatusCode)
+	}
+	if etag := rsp.Header.Get("Etag"); etag != b.etag {
+		return fmt.Errorf("http3: ETag changed: %s (expected %s)", etag, b.etag)
+	}
+	start, ok := parseContentRangeStart(rsp.Header.Get("Content-Range"))
+	if !ok || start != b.offset {
+		return fmt.Errorf("http3: unexpected Content-Range: %q", rsp.Header.Get("Content-Range"))
+	}
+	return nil
+}
+
+// parseContentRangeStart parses the first byte position of a Content-Range header field value,
+// e.g. "bytes 42-1336/1337", see section 14.4 of RFC 9110.
+func parseContentRangeStart(v string) (int64, bool) {
+	v, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(v, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, false
+	}
+	return start, true
+}
+
+func (b *resumableBody) Close() error {
+	b.mutex.Lock()
+	b.closed = true
+	body := b.body
+	b.mutex.Unlock()
+	return body.Close()
+}
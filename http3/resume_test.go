@@ -0,0 +1,250 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing/iotest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resuming downloads", func() {
+	var req *http.Request
+
+	// truncatedBody returns the data, followed by the error
+	truncatedBody := func(data string, err error) io.ReadCloser {
+		return io.NopCloser(io.MultiReader(strings.NewReader(data), iotest.ErrReader(err)))
+	}
+
+	partialResponse := func(contentRange, etag, data string) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusPartialContent,
+			Header:     http.Header{"Content-Range": {contentRange}, "Etag": {etag}},
+			Body:       io.NopCloser(strings.NewReader(data)),
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		req, err = http.NewRequest(http.MethodGet, "https://quic-go.net/large", nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("resumes a truncated download", func() {
+		testErr := fmt.Errorf("%w: connection lost", io.ErrUnexpectedEOF)
+		rsp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Etag": {`"v1"`}},
+			ContentLength: 9,
+			Body:          truncatedBody("foo", testErr),
+		}
+		var rangeReqs []*http.Request
+		makeResumable(req, rsp, func(r *http.Request) (*http.Response, error) {
+			rangeReqs = append(rangeReqs, r)
+			switch len(rangeReqs) {
+			case 1: // the first partial response is truncated as well
+				return &http.Response{
+					StatusCode: http.StatusPartialContent,
+					Header:     http.Header{"Content-Range": {"bytes 3-8/9"}, "Etag": {`"v1"`}},
+					Body:       truncatedBody("bar", testErr),
+				}, nil
+			case 2:
+				return partialResponse("bytes 6-8/9", `"v1"`, "baz"), nil
+			}
+			return nil, errors.New("unexpected request")
+		})
+		Expect(rsp.Body).To(BeAssignableToTypeOf(&resumableBody{}))
+		data, err := io.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("foobarbaz"))
+		Expect(rangeReqs).To(HaveLen(2))
+		Expect(rangeReqs[0].Header.Get("Range")).To(Equal("bytes=3-"))
+		Expect(rangeReqs[0].Header.Get("If-Range")).To(Equal(`"v1"`))
+		Expect(rangeReqs[1].Header.Get("Range")).To(Equal("bytes=6-"))
+		Expect(req.Header.Get("Range")).To(BeEmpty()) // the original request is not modified
+	})
+
+	It("exposes the underlying response body", func() {
+		body := &hijackableBody{info: responseInfo{timings: Timings{Start: time.Unix(1, 0)}}}
+		rsp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Etag": {`"v1"`}},
+			Body:       body,
+		}
+		makeResumable(req, rsp, func(*http.Request) (*http.Response, error) {
+			Fail("unexpected request")
+			return nil, nil
+		})
+		Expect(rsp.Body).To(BeAssignableToTypeOf(&resumableBody{}))
+		Expect(responseBodyOf(rsp)).To(BeIdenticalTo(body))
+		timings, ok := RequestTimings(rsp)
+		Expect(ok).To(BeTrue())
+		Expect(timings.Start).To(Equal(time.Unix(1, 0)))
+	})
+
+	It("doesn't resume if the whole body was received", func() {
+		rsp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Etag": {`"v1"`}},
+			ContentLength: 3,
+			Body:          truncatedBody("foo", io.ErrUnexpectedEOF),
+		}
+		makeResumable(req, rsp, func(*http.Request) (*http.Response, error) {
+			Fail("unexpected request")
+			return nil, nil
+		})
+		data, err := io.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("foo"))
+	})
+
+	DescribeTable("returns the original error if the partial response doesn't match",
+		func(rangeRsp *http.Response) {
+			testErr := fmt.Errorf("%w: connection lost", io.ErrUnexpectedEOF)
+			rsp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Etag": {`"v1"`}},
+				ContentLength: -1,
+				Body:          truncatedBody("foo", testErr),
+			}
+			makeResumable(req, rsp, func(*http.Request) (*http.Response, error) { return rangeRsp, nil })
+			data, err := io.ReadAll(rsp.Body)
+			Expect(err).To(MatchError(testErr))
+			Expect(string(data)).To(Equal("foo"))
+		},
+		Entry("full response", &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Etag": {`"v1"`}}, Body: io.NopCloser(strings.NewReader("foobar"))}),
+		Entry("different ETag", partialResponse("bytes 3-5/6", `"v2"`, "bar")),
+		Entry("different range", partialResponse("bytes 2-5/6", `"v1"`, "obar")),
+		Entry("invalid Content-Range", partialResponse("3-5/6", `"v1"`, "bar")),
+	)
+
+	It("gives up after too many resumptions", func() {
+		testErr := fmt.Errorf("%w: connection lost", io.ErrUnexpectedEOF)
+		rsp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Etag": {`"v1"`}},
+			ContentLength: -1,
+			Body:          truncatedBody("", testErr),
+		}
+		var count int
+		makeResumable(req, rsp, func(*http.Request) (*http.Response, error) {
+			count++
+			return &http.Response{
+				StatusCode: http.StatusPartialContent,
+				Header:     http.Header{"Content-Range": {"bytes 0-99/100"}, "Etag": {`"v1"`}},
+				Body:       truncatedBody("", testErr),
+			}, nil
+		})
+		_, err := io.ReadAll(rsp.Body)
+		Expect(err).To(MatchError(testErr))
+		Expect(count).To(Equal(maxDownloadResumptions))
+	})
+
+	It("doesn't resume if the request context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		rsp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Etag": {`"v1"`}},
+			Body:       truncatedBody("foo", io.ErrUnexpectedEOF),
+		}
+		makeResumable(req.WithContext(ctx), rsp, func(*http.Request) (*http.Response, error) {
+			Fail("unexpected request")
+			return nil, nil
+		})
+		_, err := io.ReadAll(rsp.Body)
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+	})
+
+	DescribeTable("doesn't resume if the body wasn't truncated",
+		func(testErr error) {
+			rsp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Etag": {`"v1"`}},
+				ContentLength: 9,
+				Body:          truncatedBody("foo", testErr),
+			}
+			makeResumable(req, rsp, func(*http.Request) (*http.Response, error) {
+				Fail("unexpected request")
+				return nil, nil
+			})
+			data, err := io.ReadAll(rsp.Body)
+			Expect(err).To(MatchError(testErr))
+			Expect(string(data)).To(Equal("foo"))
+		},
+		Entry("deadline exceeded", os.ErrDeadlineExceeded),
+		Entry("body too large", ErrResponseBodyTooLarge),
+	)
+
+	It("doesn't resume if the body is closed while reading", func() {
+		var closed bool
+		rsp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Etag": {`"v1"`}},
+			ContentLength: -1,
+		}
+		rsp.Body = &readerFunc{
+			read: func([]byte) (int, error) {
+				// the application closes the body while the Read call is blocked
+				Expect(rsp.Body.Close()).To(Succeed())
+				return 0, io.ErrUnexpectedEOF
+			},
+			close: func() error { closed = true; return nil },
+		}
+		makeResumable(req, rsp, func(*http.Request) (*http.Response, error) {
+			Fail("unexpected request")
+			return nil, nil
+		})
+		_, err := rsp.Body.Read(make([]byte, 10))
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+		Expect(closed).To(BeTrue())
+		_, err = rsp.Body.Read(make([]byte, 10))
+		Expect(err).To(MatchError(errReadOnClosedBody))
+	})
+
+	It("closes the partial response if the body is closed while resuming", func() {
+		rsp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Etag": {`"v1"`}},
+			ContentLength: -1,
+			Body:          truncatedBody("", io.ErrUnexpectedEOF),
+		}
+		var rangeRspClosed bool
+		makeResumable(req, rsp, func(*http.Request) (*http.Response, error) {
+			Expect(rsp.Body.Close()).To(Succeed())
+			return &http.Response{
+				StatusCode: http.StatusPartialContent,
+				Header:     http.Header{"Content-Range": {"bytes 0-2/3"}, "Etag": {`"v1"`}},
+				Body: &readerFunc{
+					read:  strings.NewReader("foo").Read,
+					close: func() error { rangeRspClosed = true; return nil },
+				},
+			}, nil
+		})
+		_, err := rsp.Body.Read(make([]byte, 10))
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+		Expect(rangeRspClosed).To(BeTrue())
+	})
+
+	DescribeTable("only resumes downloads that can be resumed",
+		func(method string, rsp *http.Response) {
+			req, err := http.NewRequest(method, "https://quic-go.net/large", nil)
+			Expect(err).ToNot(HaveOccurred())
+			body := rsp.Body
+			makeResumable(req, rsp, nil)
+			Expect(rsp.Body).To(Equal(body))
+		},
+		Entry("POST request", http.MethodPost, &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Etag": {`"v1"`}}, Body: http.NoBody}),
+		Entry("error response", http.MethodGet, &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{"Etag": {`"v1"`}}, Body: http.NoBody}),
+		Entry("no ETag", http.MethodGet, &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}),
+		Entry("weak ETag", http.MethodGet, &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Etag": {`W/"v1"`}}, Body: http.NoBody}),
+		Entry("decompressed body", http.MethodGet, &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Etag": {`"v1"`}}, Uncompressed: true, Body: http.NoBody}),
+	)
+})
@@ -19,8 +19,6 @@ import (
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/quicvarint"
-
-	"github.com/quic-go/qpack"
 )
 
 // allows mocking of quic.Listen and quic.ListenAddr
@@ -67,6 +65,23 @@ func versionToALPN(v protocol.Version) string {
 	}
 }
 
+// versionsToALPNs returns the ALPN values for a list of QUIC versions, without duplicates.
+// Versions that HTTP/3 can't be used with are skipped.
+func versionsToALPNs(versions []protocol.Version) []string {
+	// keep track of which have been seen so we don't yield duplicate values
+	seen := make(map[string]struct{}, len(versions))
+	var alpns []string
+	for _, version := range versions {
+		if v := versionToALPN(version); len(v) > 0 {
+			if _, ok := seen[v]; !ok {
+				alpns = append(alpns, v)
+				seen[v] = struct{}{}
+			}
+		}
+	}
+	return alpns
+}
+
 // ConfigureTLSConfig creates a new tls.Config which can be used
 // to create a quic.Listener meant for serving http3. The created
 // tls.Config adds the functionality of detecting the used QUIC version
@@ -222,7 +237,8 @@ type Server struct {
 	graceCtx         context.Context    // canceled when the server is closed or gracefully closed
 	graceCancel      context.CancelFunc // cancels the graceCtx
 	connCount        atomic.Int64
-	connHandlingDone chan struct{}
+	connHandlingDone chan struct{} // closed once all connections were closed after the server was shut down
+	connDoneOnce     sync.Once
 
 	altSvcHeader string
 }
@@ -281,12 +297,17 @@ func (s *Server) init() {
 		s.closeCtx, s.closeCancel = context.WithCancel(context.Background())
 		s.graceCtx, s.graceCancel = context.WithCancel(s.closeCtx)
 	}
-	s.connHandlingDone = make(chan struct{}, 1)
+	if s.connHandlingDone == nil {
+		s.connHandlingDone = make(chan struct{})
+	}
 }
 
 func (s *Server) decreaseConnCount() {
-	if s.connCount.Add(-1) == 0 {
-		close(s.connHandlingDone)
+	// The connection count might drop to zero multiple times:
+	// While the server is running, and when ServeQUICConn is called after the server was shut down.
+	// Only signal that connection handling is done once the server is shutting down, and only once.
+	if s.connCount.Add(-1) == 0 && s.graceCtx.Err() != nil {
+		s.connDoneOnce.Do(func() { close(s.connHandlingDone) })
 	}
 }
 
@@ -411,18 +432,7 @@ func (s *Server) generateAltSvcHeader() {
 	if s.QUICConfig != nil && len(s.QUICConfig.Versions) > 0 {
 		supportedVersions = s.QUICConfig.Versions
 	}
-
-	// keep track of which have been seen so we don't yield duplicate values
-	seen := make(map[string]struct{}, len(supportedVersions))
-	var versionStrings []string
-	for _, version := range supportedVersions {
-		if v := versionToALPN(version); len(v) > 0 {
-			if _, ok := seen[v]; !ok {
-				versionStrings = append(versionStrings, v)
-				seen[v] = struct{}{}
-			}
-		}
-	}
+	versionStrings := versionsToALPNs(supportedVersions)
 
 	var altSvc []string
 	addPort := func(port int) {
@@ -575,7 +585,7 @@ func (s *Server) handleConn(conn quic.Connection) error {
 			// handleRequest will return once the request has been handled,
 			// or the underlying connection is closed
 			defer wg.Done()
-			s.handleRequest(hconn, str, datagrams, hconn.decoder)
+			s.handleRequest(hconn, str, datagrams)
 		}()
 	}
 	wg.Wait()
@@ -589,7 +599,7 @@ func (s *Server) maxHeaderBytes() uint64 {
 	return uint64(s.MaxHeaderBytes)
 }
 
-func (s *Server) handleRequest(conn *connection, str quic.Stream, datagrams *datagrammer, decoder *qpack.Decoder) {
+func (s *Server) handleRequest(conn *connection, str quic.Stream, datagrams *datagrammer) {
 	var ufh unknownFrameHandlerFunc
 	if s.StreamHijacker != nil {
 		ufh = func(ft FrameType, e error) (processed bool, err error) {
@@ -626,7 +636,7 @@ func (s *Server) handleRequest(conn *connection, str quic.Stream, datagrams *dat
 		str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestIncomplete))
 		return
 	}
-	hfs, err := decoder.DecodeFull(headerBlock)
+	hfs, err := decodeHeaderBlock(headerBlock)
 	if err != nil {
 		// TODO: use the right error code
 		conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeGeneralProtocolError), "expected first frame to be a HEADERS frame")
@@ -86,7 +86,6 @@ var _ = Describe("Server", func() {
 
 	Context("handling requests", func() {
 		var (
-			qpackDecoder       *qpack.Decoder
 			str                *mockquic.MockStream
 			conn               *connection
 			exampleGetRequest  *http.Request
@@ -140,7 +139,6 @@ var _ = Describe("Server", func() {
 			examplePostRequest, err = http.NewRequest("POST", "https://www.example.com", bytes.NewReader([]byte("foobar")))
 			Expect(err).ToNot(HaveOccurred())
 
-			qpackDecoder = qpack.NewDecoder(nil)
 			str = mockquic.NewMockStream(mockCtrl)
 			str.EXPECT().Context().Return(reqContext).AnyTimes()
 			str.EXPECT().StreamID().AnyTimes()
@@ -166,7 +164,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(gomock.Any())
 			str.EXPECT().Close()
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			var req *http.Request
 			Eventually(requestChan).Should(Receive(&req))
 			Expect(req.Host).To(Equal("www.example.com"))
@@ -182,7 +180,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(gomock.Any())
 			str.EXPECT().Close()
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
 		})
@@ -198,7 +196,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(gomock.Any())
 			str.EXPECT().Close()
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
 			Expect(hfs).To(HaveKeyWithValue("content-length", []string{"6"}))
@@ -218,7 +216,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(gomock.Any())
 			str.EXPECT().Close()
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"404"}))
 			Expect(hfs).To(HaveKeyWithValue("content-length", []string{"13"}))
@@ -238,7 +236,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(gomock.Any())
 			str.EXPECT().Close()
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
 			// status, date, content-type
@@ -258,7 +256,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(gomock.Any())
 			str.EXPECT().Close()
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
 			Expect(responseBuf.Bytes()).To(BeEmpty())
@@ -277,7 +275,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(gomock.Any())
 			str.EXPECT().Close()
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
 			Expect(hfs).To(HaveKeyWithValue("content-length", []string{"13"}))
@@ -295,7 +293,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeInternalError))
 			str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeInternalError))
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			Expect(responseBuf.Bytes()).To(HaveLen(0))
 		})
 
@@ -312,7 +310,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeInternalError))
 			str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeInternalError))
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			Expect(responseBuf.Bytes()).To(HaveLen(0))
 			Expect(logBuf.String()).To(ContainSubstring("http: panic serving"))
 			Expect(logBuf.String()).To(ContainSubstring("foobar"))
@@ -623,7 +621,7 @@ var _ = Describe("Server", func() {
 				data := make([]byte, df.Length)
 				_, err = io.ReadFull(&buf, data)
 				Expect(err).ToNot(HaveOccurred())
-				hdrs, err := qpackDecoder.DecodeFull(data)
+				hdrs, err := qpack.NewDecoder(nil).DecodeFull(data)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(hdrs).To(ContainElement(qpack.HeaderField{Name: ":status", Value: "200"}))
 				Expect(buf.Bytes()).To(Equal([]byte("foobar")))
@@ -727,7 +725,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeNoError))
 			str.EXPECT().Close()
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			Eventually(handlerCalled).Should(BeClosed())
 		})
 
@@ -750,7 +748,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeNoError))
 			str.EXPECT().Close()
 
-			s.handleRequest(conn, str, nil, qpackDecoder)
+			s.handleRequest(conn, str, nil)
 			Eventually(handlerCalled).Should(BeClosed())
 		})
 	})
@@ -1150,6 +1148,43 @@ var _ = Describe("Server", func() {
 		})
 	})
 
+	Context("counting connections", func() {
+		BeforeEach(func() {
+			s.mutex.Lock()
+			s.init()
+			s.mutex.Unlock()
+		})
+
+		It("handles the connection count dropping to zero multiple times", func() {
+			for i := 0; i < 2; i++ {
+				s.connCount.Add(1)
+				Expect(s.decreaseConnCount).ToNot(Panic())
+			}
+
+			// Shutdown waits for the last connection to be closed
+			s.connCount.Add(1)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				Expect(s.Shutdown(context.Background())).To(Succeed())
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			s.decreaseConnCount()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("handles the connection count dropping to zero multiple times after shutting down", func() {
+			Expect(s.Shutdown(context.Background())).To(Succeed())
+			// connections served using ServeQUICConn after the server was shut down
+			for i := 0; i < 2; i++ {
+				s.connCount.Add(1)
+				Expect(s.decreaseConnCount).ToNot(Panic())
+			}
+			Expect(s.connHandlingDone).To(BeClosed())
+		})
+	})
+
 	Context("ServeQUICConn", func() {
 		It("serves a QUIC connection", func() {
 			mux := http.NewServeMux()
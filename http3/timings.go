@@ -0,0 +1,41 @@
+package http3
+
+import (
+	"net/http"
+	"time"
+)
+
+// Timings is the timing breakdown of a single request.
+type Timings struct {
+	// Start is the time when the request was started.
+	// For requests sent using the Transport, this includes the time spent dialing the connection.
+	Start time.Time
+	// ConnReady is the time when the connection was ready to send the request.
+	// For requests sent in 0-RTT, this is the time when the request was sent.
+	ConnReady time.Time
+	// FirstResponseByte is the time when the first frame of the response was received.
+	// This includes informational (1xx) responses.
+	FirstResponseByte time.Time
+	// Headers is the time when the header of the final response was received.
+	Headers time.Time
+	// BodyDone is the time when the response body was read completely.
+	// It is zero until Read on the response body returned io.EOF.
+	BodyDone time.Time
+}
+
+// TimeToFirstByte is the time from starting the request until the first byte of the response was received.
+func (t Timings) TimeToFirstByte() time.Duration { return t.FirstResponseByte.Sub(t.Start) }
+
+// TimeToHeaders is the time from starting the request until the header of the final response was received.
+func (t Timings) TimeToHeaders() time.Duration { return t.Headers.Sub(t.Start) }
+
+// RequestTimings returns the timing breakdown of the request that produced the response.
+// It returns false if the response wasn't received by this package, or if the Body of the
+// response was replaced.
+// It must not be called concurrently with Read on the response body.
+func RequestTimings(rsp *http.Response) (Timings, bool) {
+	if b := responseBodyOf(rsp); b != nil {
+		return b.info.timings, true
+	}
+	return Timings{}, false
+}
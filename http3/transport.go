@@ -9,9 +9,14 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/http/httpguts"
 
@@ -25,6 +30,9 @@ type Settings struct {
 	EnableDatagrams bool
 	// Extended CONNECT, RFC 9220
 	EnableExtendedConnect bool
+	// WebTransport over HTTP/3 (draft-ietf-webtrans-http3).
+	// The setting is also contained in Other.
+	EnableWebTransport bool
 	// Other settings, defined by the application
 	Other map[uint64]uint64
 }
@@ -34,8 +42,101 @@ type RoundTripOpt struct {
 	// OnlyCachedConn controls whether the Transport may create a new QUIC connection.
 	// If set true and no cached connection is available, RoundTripOpt will return ErrNoCachedConn.
 	OnlyCachedConn bool
+	// DisableCompression, if true, prevents the Transport from requesting compression with an
+	// "Accept-Encoding: gzip" request header for this request, even if compression is enabled
+	// on the Transport. This allows obtaining the raw response body for a single request.
+	DisableCompression bool
+	// BufferedBodySize, if positive, wraps the response body in a *BufferedBody
+	// backed by a buffer of (at least) this size.
+	// This allows peeking at the body without consuming it, see BufferedBody.Peek.
+	BufferedBodySize int
+	// MaxStreamWait, if positive, limits the time spent waiting for the server to allow
+	// opening a new request stream, when the stream limit (MAX_STREAMS) of the connection is reached.
+	// If the stream can't be opened in time, ErrStreamLimitReached is returned.
+	// By default, the request blocks until the stream can be opened or the request context is done.
+	MaxStreamWait time.Duration
+	// NonBlockingStreamOpen, if true, returns ErrStreamLimitReached right away if the stream limit
+	// (MAX_STREAMS) of the connection is reached, instead of waiting for the server to allow opening a new
+	// request stream. The request can then be retried later, or on a different connection.
+	NonBlockingStreamOpen bool
+	// SynthesizeErrorResponse, if true, replaces errors caused by an unreachable or unresponsive server
+	// with a synthetic response, allowing code paths that expect an *http.Response to handle them uniformly:
+	// Timeouts (e.g. an idle timeout or a handshake timeout) result in a 504 (Gateway Timeout) response,
+	// and refused connections result in a 502 (Bad Gateway) response.
+	// All other errors, including HTTP/3 and QUIC protocol errors, are still returned as errors.
+	// Errors caused by the cancellation of the request context are not replaced either.
+	SynthesizeErrorResponse bool
+	// DontCloseRequestStream, if true, keeps the request stream open for writing after the request
+	// header was sent. This is used for CONNECT requests that exchange data (e.g. capsules) with the
+	// server on the request stream, see RequestStreamWriter.
+	// It only applies to CONNECT requests that don't have a request body.
+	DontCloseRequestStream bool
+	// DeadlineBasedPriority, if true, sets the urgency of requests that don't have a Priority header field
+	// based on the time remaining until the deadline of the request context (see RFC 9218):
+	// The closer the deadline, the higher the urgency.
+	// Requests without a deadline, or with a deadline more than 2 seconds in the future,
+	// are sent with the default priority.
+	DeadlineBasedPriority bool
+	// WireTap, if set, receives copies of the raw HTTP/3 frames sent and received on the request stream.
+	// This is intended for debugging and protocol conformance testing.
+	// By default, only HEADERS frames are passed, since copying large bodies is expensive.
+	WireTap WireTap
+	// WireTapData, if true, also passes DATA frames to the WireTap.
+	WireTapData bool
+	// ResumeDownloads, if true, resumes the download of the response body using a Range request
+	// if the body is truncated, i.e. reading fails with an error wrapping io.ErrUnexpectedEOF,
+	// e.g. because the connection was lost or the stream was reset by the server.
+	// This is transparent to the application, which reads the complete body.
+	// It only applies to successful responses to GET requests that carry a strong ETag,
+	// which is sent in the If-Range header field of the Range request. If the server doesn't respond
+	// with the remainder of the same representation, the original error is returned.
+	// Bodies that are decompressed transparently are not resumed.
+	// The body doesn't implement the methods of the ResponseController.
+	ResumeDownloads bool
+	// MaxResponseHeaderBytes, if positive, overrides Transport.MaxResponseHeaderBytes for this request.
+	// This allows raising the limit for requests to endpoints known to send large header blocks.
+	MaxResponseHeaderBytes int64
+	// SettingsTimeout, if positive, limits the time spent waiting for the server's SETTINGS frame,
+	// for requests that can only be sent once the SETTINGS were received (i.e. Extended CONNECT requests).
+	// If the SETTINGS aren't received in time, ErrSettingsTimeout is returned.
+	// By default, the request waits until the SETTINGS are received or the connection is closed.
+	SettingsTimeout time.Duration
+	// LocalAddr, if set, is the local address the connection used for this request is bound to.
+	// This allows sending requests from a specific interface on multi-homed hosts.
+	// Since the address is fixed when dialing, requests with different local addresses use different connections.
+	// If the port is 0, an ephemeral port is used.
+	// It can't be used with Transport.Dial, Transport.DialConnection or a Proxy.
+	LocalAddr *net.UDPAddr
 }
 
+// A RoundTripFunc sends a single HTTP request and returns the response.
+// It is used to chain interceptors, see Transport.Interceptor.
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// disableCompressionKey is the context key used to disable compression for a single request.
+type disableCompressionKey struct{}
+
+// bufferedBodyKey is the context key used to request a buffered response body for a single request.
+type bufferedBodyKey struct{}
+
+// maxStreamWaitKey is the context key used to limit the time waiting for a request stream for a single request.
+type maxStreamWaitKey struct{}
+
+// nonBlockingStreamOpenKey is the context key used to open the request stream without blocking for a single request.
+type nonBlockingStreamOpenKey struct{}
+
+// dontCloseRequestStreamKey is the context key used to keep the request stream of a CONNECT request open.
+type dontCloseRequestStreamKey struct{}
+
+// maxResponseHeaderBytesKey is the context key used to set the response header size limit for a single request.
+type maxResponseHeaderBytesKey struct{}
+
+// settingsTimeoutKey is the context key used to limit the time waiting for the server's SETTINGS for a single request.
+type settingsTimeoutKey struct{}
+
 type singleRoundTripper interface {
 	OpenRequestStream(context.Context) (RequestStream, error)
 	RoundTrip(*http.Request) (*http.Response, error)
@@ -47,10 +148,37 @@ type roundTripperWithCount struct {
 	dialErr error
 	conn    quic.EarlyConnection
 	rt      singleRoundTripper
+	proxied bool // the connection is tunneled through a proxy
+	// the local address the connection is bound to, only set if RoundTripOpt.LocalAddr was used
+	localAddr *net.UDPAddr
+
+	hostname string // the authority this connection was dialed for
+	// authorities that the server refused to serve on this connection (by responding with a 421),
+	// the connection isn't coalesced for these anymore, protected by the Transport's mutex
+	misdirected map[string]struct{}
 
 	useCount atomic.Int64
 }
 
+// closed says if the connection was established, and was closed since then,
+// e.g. due to an idle timeout or because the server closed it.
+func (r *roundTripperWithCount) closed() bool {
+	select {
+	case <-r.dialing:
+	default:
+		return false
+	}
+	if r.dialErr != nil {
+		return false
+	}
+	select {
+	case <-r.conn.Context().Done():
+		return true
+	default:
+		return false
+	}
+}
+
 func (r *roundTripperWithCount) Close() error {
 	r.cancel()
 	<-r.dialing
@@ -60,42 +188,284 @@ func (r *roundTripperWithCount) Close() error {
 	return nil
 }
 
+// Shutdown gracefully shuts down the connection, see ClientConn.Shutdown.
+// If the connection is still being dialed, it waits for the handshake to complete first.
+func (r *roundTripperWithCount) Shutdown(ctx context.Context) error {
+	select {
+	case <-r.dialing:
+	case <-ctx.Done():
+		r.Close()
+		return ctx.Err()
+	}
+	if r.conn == nil {
+		return nil
+	}
+	if s, ok := r.rt.(interface{ Shutdown(context.Context) error }); ok {
+		return s.Shutdown(ctx)
+	}
+	return r.Close()
+}
+
 // Transport implements the http.RoundTripper interface
 type Transport struct {
 	// TLSClientConfig specifies the TLS configuration to use with
 	// tls.Client. If nil, the default configuration is used.
+	// If it doesn't set a ClientSessionCache, the Transport uses an in-memory session cache,
+	// which allows using 0-RTT when connecting to the same server again (see MethodGet0RTT).
+	// This cache can be cleared using ClearSessionCache.
 	TLSClientConfig *tls.Config
 
+	// VerifyConnection, if not nil, is called after normal certificate verification
+	// (and after TLSClientConfig.VerifyConnection, if set) for every connection dialed by
+	// the Transport. In addition to the tls.ConnectionState, it receives the authority
+	// (host:port) that the connection was dialed for.
+	// If it returns a non-nil error, the handshake is aborted and that error results.
+	// Custom verification callbacks set on the TLSClientConfig (VerifyPeerCertificate
+	// and VerifyConnection) are used as well.
+	VerifyConnection func(authority string, cs tls.ConnectionState) error
+
+	// GetClientCertificate, if not nil, is called when the server requests a client certificate
+	// during the handshake of a connection dialed by the Transport. In addition to the
+	// tls.CertificateRequestInfo, it receives the authority (host:port) that the connection
+	// was dialed for, which allows using a different client certificate for every server.
+	// It takes precedence over TLSClientConfig.GetClientCertificate and TLSClientConfig.Certificates.
+	// The returned certificate is the one presented to the server.
+	GetClientCertificate func(authority string, info *tls.CertificateRequestInfo) (*tls.Certificate, error)
+
 	// QUICConfig is the quic.Config used for dialing new connections.
 	// If nil, reasonable default values will be used.
+	// If multiple QUIC versions are configured, the connection is attempted with the first one,
+	// and QUIC version negotiation falls back to another one if the server doesn't support it.
 	QUICConfig *quic.Config
 
+	// KeepAlivePeriod overrides the keep-alive period of the QUICConfig (or the default config).
+	// Zero means to use the value from the QUICConfig.
+	// A negative value disables keep-alives.
+	KeepAlivePeriod time.Duration
+
+	// MaxIdleTimeout overrides the idle timeout of the QUICConfig (or the default config).
+	// Zero means to use the value from the QUICConfig.
+	MaxIdleTimeout time.Duration
+
+	// TokenStore overrides the token store of the QUICConfig (or the default config).
+	// It stores the address validation tokens received from servers (in NEW_TOKEN frames),
+	// which are used when establishing a new connection to the same server,
+	// saving the round trip for address validation (a Retry).
+	// An in-memory token store can be created using quic.NewLRUTokenStore.
+	// If nil, the token store of the QUICConfig is used.
+	TokenStore quic.TokenStore
+
+	// CongestionControl overrides the congestion control algorithm of the QUICConfig (or the default config).
+	// Zero means to use the value from the QUICConfig.
+	CongestionControl quic.CongestionControlAlgorithm
+
 	// Dial specifies an optional dial function for creating QUIC
 	// connections for requests.
-	// If Dial is nil, a UDPConn will be created at the first request
+	// If Dial is nil, the QUICTransport is used.
+	// If that is nil as well, a UDPConn will be created at the first request
 	// and will be reused for subsequent connections to other servers.
 	Dial func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error)
 
+	// DialConnection specifies an optional dial function for creating QUIC
+	// connections that don't use 0-RTT, e.g. when using quic.Dial or when reusing a
+	// connection that was established elsewhere.
+	// The handshake of the returned connection is expected to be complete.
+	// It is only used if Dial is nil.
+	DialConnection func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Connection, error)
+
+	// QUICTransport is the quic.Transport used for dialing new connections,
+	// if neither Dial nor DialConnection are set.
+	// This allows the application to control the underlying net.PacketConn,
+	// and to share it between multiple Transports.
+	// The Transport doesn't take ownership of the quic.Transport:
+	// It is not closed when the Transport is closed.
+	// If nil, a UDPConn will be created at the first request.
+	QUICTransport *quic.Transport
+
+	// Resolve, if set, is used to resolve the host name of the server when dialing a new connection,
+	// instead of the default resolver. It allows using split-horizon DNS, DNS over HTTPS,
+	// or a custom net.Resolver (by calling its LookupNetIP method).
+	// The connection is established to the first address returned.
+	// It is only used if neither Dial nor DialConnection are set.
+	Resolve func(ctx context.Context, host string) ([]netip.Addr, error)
+
+	// Proxy specifies a function to return a proxy for a given request.
+	// If the function returns a non-nil URL, the QUIC connection to the server is tunneled
+	// through the proxy, using CONNECT-UDP (RFC 9298) over HTTP/3.
+	// The proxy URL must use the https scheme. Its path and query may contain the {target_host}
+	// and {target_port} variables of the URI template. If it has no path, the default template
+	// (/.well-known/masque/udp/{target_host}/{target_port}/) is used.
+	// The connection to the proxy is established using the TLSClientConfig, QUICTransport and
+	// Resolve of this Transport, and is shared by all tunnels through that proxy.
+	// The proxy is not used if Dial or DialConnection is set.
+	// If nil, no proxy is used.
+	Proxy func(*http.Request) (*url.URL, error)
+
 	// Enable support for HTTP/3 datagrams (RFC 9297).
 	// If a QUICConfig is set, datagram support also needs to be enabled on the QUIC layer by setting EnableDatagrams.
 	EnableDatagrams bool
+	// DatagramQueueLen is the maximum number of HTTP datagrams queued per request stream
+	// that haven't been read using ReceiveDatagram yet.
+	// If zero, up to 32 datagrams are queued.
+	// The number of datagrams dropped because a queue was full is reported by ClientConn.DroppedDatagrams.
+	DatagramQueueLen int
+	// DropOldestDatagrams controls which datagram is dropped when a stream's datagram queue is full.
+	// By default, newly received datagrams are dropped.
+	// If set, the oldest queued datagram is dropped instead, which is usually preferable
+	// for real-time data.
+	DropOldestDatagrams bool
 
 	// Additional HTTP/3 settings.
 	// It is invalid to specify any settings defined by RFC 9114 (HTTP/3) and RFC 9297 (HTTP Datagrams).
 	AdditionalSettings map[uint64]uint64
 
+	// ControlStreamInit, if set, is called for every new connection. The returned bytes are sent
+	// on the control stream, right after the SETTINGS frame. This allows sending connection-scoped
+	// extension frames, e.g. carrying a short-lived authorization token.
+	// The bytes must consist of complete HTTP/3 frames. Frames that are not allowed on the control stream
+	// (DATA, HEADERS, SETTINGS, PUSH_PROMISE and the reserved HTTP/2 frame types) are rejected,
+	// and the connection is closed.
+	ControlStreamInit func() []byte
+
 	// MaxResponseHeaderBytes specifies a limit on how many response bytes are
 	// allowed in the server's response header.
 	// Zero means to use a default limit.
 	MaxResponseHeaderBytes int64
 
+	// MaxResponseHeaderFields specifies a limit on the number of header fields
+	// allowed in the server's response header.
+	// Responses exceeding this limit are rejected, and the stream is reset with H3_EXCESSIVE_LOAD.
+	// Zero means no limit.
+	MaxResponseHeaderFields int
+
 	// DisableCompression, if true, prevents the Transport from requesting compression with an
 	// "Accept-Encoding: gzip" request header when the Request contains no existing Accept-Encoding value.
 	// If the Transport requests gzip on its own and gets a gzipped response, it's transparently
 	// decoded in the Response.Body.
-	// However, if the user explicitly requested gzip it is not automatically uncompressed.
+	// However, if the user explicitly requested gzip it is not automatically uncompressed,
+	// unless DecompressAcceptedEncodings is set.
 	DisableCompression bool
 
+	// PreserveRawResponseHeaders, if true, retains the header fields of responses in the order
+	// in which they were received from the server.
+	// They can be obtained by calling RawResponseHeaderFields.
+	PreserveRawResponseHeaders bool
+
+	// MaxDecompressedSize limits the size of a transparently decompressed response body.
+	// If the decompressed body exceeds this limit, reading from the body fails with
+	// ErrDecompressedSizeExceeded and the stream is reset.
+	// It only applies to responses that the Transport decompresses on its own (see DisableCompression
+	// and DecompressAcceptedEncodings).
+	// Zero means no limit.
+	MaxDecompressedSize int64
+
+	// DecompressAcceptedEncodings, if true, transparently decodes responses to requests that set
+	// their own Accept-Encoding header field (e.g. "zstd, br, gzip"), if the server chose one of the
+	// listed codings that the Transport can decode. Currently, only gzip is supported.
+	// Responses using any other coding are returned as-is.
+	// Decoded responses are handled like responses to requests for which the Transport added
+	// "Accept-Encoding: gzip" on its own, see DisableCompression.
+	DecompressAcceptedEncodings bool
+
+	// MaxResponseBodySize limits the size of response bodies, as received on the wire.
+	// If a response body exceeds this limit, reading from the body fails with
+	// ErrResponseBodyTooLarge and the stream is reset.
+	// If the response announces a Content-Length larger than the limit, the error is returned
+	// on the first Read.
+	// Zero means no limit.
+	MaxResponseBodySize int64
+
+	// FlushInterval specifies the flush interval to use when sending request bodies.
+	// If positive, data read from the request body is buffered, and written to the
+	// QUIC stream (as a single DATA frame) at most FlushInterval after it was read.
+	// This reduces framing overhead for request bodies that are written in many small chunks.
+	// Zero or a negative value (the default) means that every chunk is sent immediately,
+	// which is what latency-sensitive uses (e.g. forwarding Server-Sent Events) need.
+	FlushInterval time.Duration
+
+	// RejectConnectionSpecificHeaders, if true, makes requests fail that contain connection-specific
+	// header fields (Connection, Keep-Alive, Proxy-Connection, Transfer-Encoding and Upgrade),
+	// or a TE header field with a value other than "trailers".
+	// By default, these header fields are silently removed from the request.
+	RejectConnectionSpecificHeaders bool
+
+	// EnableConnectionCoalescing, if true, allows requests to be sent on a connection that
+	// was established for a different authority, as long as the server's certificate is valid
+	// for the authority of the request, and both authorities use the same port (see section 3.3
+	// of RFC 9114). If VerifyConnection is set, it is called for the new authority as well.
+	// This saves handshakes when connecting to servers using a wildcard certificate.
+	EnableConnectionCoalescing bool
+
+	// UserAgent is the User-Agent header field sent with requests that don't set one.
+	// A User-Agent set on the request always takes precedence.
+	// If empty, "quic-go HTTP/3" is used.
+	UserAgent string
+
+	// AcceptEncoding is the Accept-Encoding header field sent verbatim with requests that don't set one.
+	// If set, the Transport doesn't request gzip on its own, and responses are not decoded transparently
+	// (unless DecompressAcceptedEncodings is set).
+	// If empty, "Accept-Encoding: gzip" is sent, unless DisableCompression is set,
+	// in which case no Accept-Encoding is sent at all.
+	AcceptEncoding string
+
+	// DefaultPort is the port that connections are dialed to if the request URL doesn't contain a port.
+	// If zero, 443 is used. If negative, no default port is used,
+	// and requests to URLs that don't contain a port fail.
+	DefaultPort int
+
+	// ModifyRequest, if set, is called for every request right before the request header is
+	// serialized, after the connection has been selected. It can be used to add dynamic header
+	// fields, e.g. for signing or trace propagation. It receives a clone of the request, so
+	// modifications don't affect the caller's request.
+	// Changing the Host or the URL changes the :authority and :path pseudo-header fields, but
+	// doesn't affect which connection the request is sent on.
+	// If it returns an error, the request is aborted and that error is returned.
+	ModifyRequest func(*http.Request) error
+
+	// ModifyResponse, if set, is called for every final (i.e. non-1xx) response, before it is
+	// returned to the caller. It can be used to rewrite or remove header fields, similar to
+	// httputil.ReverseProxy.ModifyResponse.
+	// The response body has already been set up when it is called: changing the Content-Length
+	// or the Content-Encoding header field doesn't change how the body is read or decompressed.
+	// If it returns an error, the request stream is reset and that error is returned.
+	ModifyResponse func(*http.Response) error
+
+	// Interceptor, if set, wraps the sending of requests on every connection.
+	// It is called once for every connection, and the returned RoundTripFunc is used to send
+	// all requests on that connection, i.e. it runs after the connection has been selected.
+	// This allows adding cross-cutting logic, like refreshing authentication tokens or circuit breaking.
+	// Every call to next sends the request on a new request stream, so it is possible
+	// to retry a request by calling next again. Before retrying, the body of the previous
+	// response should be closed. If the request has a body, the body must be replaced
+	// (e.g. using Request.GetBody), since it was consumed by the first attempt.
+	// It isn't applied to request streams opened using ClientConn.OpenRequestStream.
+	Interceptor func(next RoundTripFunc) RoundTripFunc
+
+	// QPACKTracer, if set, is called for QPACK activity on all connections, e.g. when a request
+	// header is encoded, or when a response header is decoded.
+	// It is intended for debugging header compression interoperability issues.
+	// It may be called concurrently from multiple goroutines.
+	QPACKTracer func(QPACKEvent)
+
+	// OnSettings, if set, is called when the server's SETTINGS frame was received on a connection.
+	// It is called exactly once per connection, after ClientConn.ReceivedSettings was closed.
+	// This allows discovering the capabilities of the server, e.g. support for datagrams,
+	// Extended CONNECT or WebTransport, without having to wait on ClientConn.ReceivedSettings.
+	// It is called on the Go routine that handles the control stream, so it must not block.
+	OnSettings func(*Settings)
+
+	// OnStreamOpen, if set, is called for every request right after its QUIC stream was opened,
+	// before the request is sent.
+	// This allows correlating stream events (e.g. in a qlog trace) with HTTP requests.
+	// It is called on the Go routine that sends the request, so it should not block.
+	OnStreamOpen func(quic.StreamID, *http.Request)
+
+	// OnConnectionClosed, if set, is called when a QUIC connection dialed by the Transport is closed,
+	// e.g. due to an idle timeout, because the server closed it, or due to a network error.
+	// It is called exactly once per connection, with the address that was dialed and the
+	// reason the connection was closed, and it is called on a separate Go routine.
+	OnConnectionClosed func(addr string, err error)
+
 	StreamHijacker    func(FrameType, quic.ConnectionTracingID, quic.Stream, error) (hijacked bool, err error)
 	UniStreamHijacker func(StreamType, quic.ConnectionTracingID, quic.ReceiveStream, error) (hijacked bool)
 
@@ -107,9 +477,16 @@ type Transport struct {
 	initErr  error
 
 	newClient func(quic.EarlyConnection) singleRoundTripper
+	clock     clock // used for the Timings, defaults to the real clock
+
+	clients      map[string]*roundTripperWithCount
+	transport    *quic.Transport
+	sessionCache *clearableSessionCache
+	// the transports bound to a specific local address, see RoundTripOpt.LocalAddr
+	localTransports map[string]*quic.Transport
 
-	clients   map[string]*roundTripperWithCount
-	transport *quic.Transport
+	// used to establish the connections to the proxy, if a Proxy is set
+	proxyTransport *Transport
 }
 
 var (
@@ -123,21 +500,35 @@ type RoundTripper = Transport
 // ErrNoCachedConn is returned when Transport.OnlyCachedConn is set
 var ErrNoCachedConn = errors.New("http3: no cached connection was available")
 
+// ErrStreamLimitReached is returned when a request stream couldn't be opened within
+// RoundTripOpt.MaxStreamWait (or right away, if RoundTripOpt.NonBlockingStreamOpen is set),
+// because the server's stream limit was reached.
+// The connection is still usable, and the request can be retried, potentially on a different connection.
+var ErrStreamLimitReached = errors.New("http3: stream limit reached")
+
+// ErrSettingsTimeout is returned when the server's SETTINGS frame wasn't received within
+// RoundTripOpt.SettingsTimeout.
+var ErrSettingsTimeout = errors.New("http3: timeout waiting for SETTINGS")
+
+// ErrDecompressedSizeExceeded is returned when reading from a response body that was transparently
+// decompressed, and the decompressed body exceeds Transport.MaxDecompressedSize.
+var ErrDecompressedSizeExceeded = errors.New("http3: decompressed response body too large")
+
+// ErrResponseBodyTooLarge is returned when reading from a response body that exceeds
+// Transport.MaxResponseBodySize.
+var ErrResponseBodyTooLarge = errors.New("http3: response body too large")
+
 func (t *Transport) init() error {
+	if t.clock == nil {
+		t.clock = realClock{}
+	}
 	if t.newClient == nil {
+		conf := t.clientConnConfig()
 		t.newClient = func(conn quic.EarlyConnection) singleRoundTripper {
-			return newClientConn(
-				conn,
-				t.EnableDatagrams,
-				t.AdditionalSettings,
-				t.StreamHijacker,
-				t.UniStreamHijacker,
-				t.MaxResponseHeaderBytes,
-				t.DisableCompression,
-				t.Logger,
-			)
+			return newClientConn(conn, conf)
 		}
 	}
+	t.sessionCache = &clearableSessionCache{}
 	if t.QUICConfig == nil {
 		t.QUICConfig = defaultQuicConfig.Clone()
 		t.QUICConfig.EnableDatagrams = t.EnableDatagrams
@@ -149,21 +540,76 @@ func (t *Transport) init() error {
 		t.QUICConfig = t.QUICConfig.Clone()
 		t.QUICConfig.Versions = []quic.Version{protocol.SupportedVersions[0]}
 	}
-	if len(t.QUICConfig.Versions) != 1 {
-		return errors.New("can only use a single QUIC version for dialing a HTTP/3 connection")
+	// Multiple versions can be offered. QUIC version negotiation then selects the one used for the connection.
+	if len(versionsToALPNs(t.QUICConfig.Versions)) == 0 {
+		return errors.New("none of the QUIC versions can be used for dialing a HTTP/3 connection")
 	}
 	if t.QUICConfig.MaxIncomingStreams == 0 {
 		t.QUICConfig.MaxIncomingStreams = -1 // don't allow any bidirectional streams
 	}
+	if t.KeepAlivePeriod != 0 || t.MaxIdleTimeout != 0 || t.TokenStore != nil || t.CongestionControl != 0 {
+		t.QUICConfig = t.QUICConfig.Clone()
+		if t.KeepAlivePeriod > 0 {
+			t.QUICConfig.KeepAlivePeriod = t.KeepAlivePeriod
+		} else if t.KeepAlivePeriod < 0 {
+			t.QUICConfig.KeepAlivePeriod = 0
+		}
+		if t.MaxIdleTimeout != 0 {
+			t.QUICConfig.MaxIdleTimeout = t.MaxIdleTimeout
+		}
+		if t.TokenStore != nil {
+			t.QUICConfig.TokenStore = t.TokenStore
+		}
+		if t.CongestionControl != 0 {
+			t.QUICConfig.CongestionControl = t.CongestionControl
+		}
+	}
+	if t.Proxy != nil {
+		// HTTP datagrams are used to tunnel QUIC packets through the proxy
+		quicConf := t.QUICConfig.Clone()
+		quicConf.EnableDatagrams = true
+		t.proxyTransport = &Transport{
+			TLSClientConfig: t.TLSClientConfig,
+			QUICConfig:      quicConf,
+			QUICTransport:   t.QUICTransport,
+			Resolve:         t.Resolve,
+			EnableDatagrams: true,
+			Logger:          t.Logger,
+		}
+		t.proxyTransport.initOnce.Do(func() { t.proxyTransport.initErr = t.proxyTransport.init() })
+		return t.proxyTransport.initErr
+	}
 	return nil
 }
 
 // RoundTripOpt is like RoundTrip, but takes options.
+//
+// The :authority pseudo-header field is taken from Request.Host, if set, and from Request.URL.Host otherwise.
+// This allows sending an :authority that differs from the server the request is sent to:
+// Connections are always established to (and reused based on) Request.URL.Host.
+//
+// If a request fails because a reused connection timed out, it is retried on a new connection.
+// Since the body was consumed by the first attempt, requests with a body are only retried
+// if Request.GetBody is set.
 func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Response, error) {
+	rsp, err := t.roundTripOpt(req, opt)
+	if err == nil && opt.ResumeDownloads {
+		makeResumable(req, rsp, func(r *http.Request) (*http.Response, error) { return t.roundTripOpt(r, opt) })
+	}
+	if err != nil && opt.SynthesizeErrorResponse {
+		if rsp := errorResponse(req, err); rsp != nil {
+			return rsp, nil
+		}
+	}
+	return rsp, err
+}
+
+func (t *Transport) roundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Response, error) {
 	t.initOnce.Do(func() { t.initErr = t.init() })
 	if t.initErr != nil {
 		return nil, t.initErr
 	}
+	start := t.clock.Now()
 
 	if req.URL == nil {
 		closeRequestBody(req)
@@ -197,8 +643,26 @@ func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Res
 		return nil, fmt.Errorf("http3: invalid method %q", req.Method)
 	}
 
-	hostname := authorityAddr(hostnameFromURL(req.URL))
-	cl, isReused, err := t.getClient(req.Context(), hostname, opt.OnlyCachedConn)
+	hostname := authorityAddr(hostnameFromURL(req.URL), t.defaultPort())
+	if _, port, err := net.SplitHostPort(hostname); err != nil || port == "" {
+		closeRequestBody(req)
+		return nil, errors.New("http3: no port in request URL")
+	}
+	var proxyURL *url.URL
+	if t.Proxy != nil && t.Dial == nil && t.DialConnection == nil {
+		var err error
+		proxyURL, err = t.Proxy(req)
+		if err != nil {
+			closeRequestBody(req)
+			return nil, err
+		}
+	}
+	if opt.LocalAddr != nil && (t.Dial != nil || t.DialConnection != nil || proxyURL != nil) {
+		closeRequestBody(req)
+		return nil, errors.New("http3: RoundTripOpt.LocalAddr can't be used with a custom dial function or a proxy")
+	}
+	key := clientKey(hostname, proxyURL, opt.LocalAddr)
+	cl, isReused, err := t.getClient(req.Context(), hostname, proxyURL, opt.LocalAddr, opt.OnlyCachedConn)
 	if err != nil {
 		return nil, err
 	}
@@ -210,34 +674,168 @@ func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Res
 	}
 
 	if cl.dialErr != nil {
-		t.removeClient(hostname)
+		t.removeClient(key, cl)
 		return nil, cl.dialErr
 	}
 	defer cl.useCount.Add(-1)
-	rsp, err := cl.rt.RoundTrip(req)
+	rtReq := req
+	if opt.DeadlineBasedPriority {
+		rtReq = withDeadlineBasedPriority(rtReq)
+	}
+	if opt.DisableCompression {
+		rtReq = rtReq.WithContext(context.WithValue(rtReq.Context(), disableCompressionKey{}, true))
+	}
+	if opt.BufferedBodySize > 0 {
+		rtReq = rtReq.WithContext(context.WithValue(rtReq.Context(), bufferedBodyKey{}, opt.BufferedBodySize))
+	}
+	if opt.MaxStreamWait > 0 {
+		rtReq = rtReq.WithContext(context.WithValue(rtReq.Context(), maxStreamWaitKey{}, opt.MaxStreamWait))
+	}
+	if opt.NonBlockingStreamOpen {
+		rtReq = rtReq.WithContext(context.WithValue(rtReq.Context(), nonBlockingStreamOpenKey{}, true))
+	}
+	if opt.DontCloseRequestStream {
+		rtReq = rtReq.WithContext(context.WithValue(rtReq.Context(), dontCloseRequestStreamKey{}, true))
+	}
+	if opt.MaxResponseHeaderBytes > 0 {
+		rtReq = rtReq.WithContext(context.WithValue(rtReq.Context(), maxResponseHeaderBytesKey{}, opt.MaxResponseHeaderBytes))
+	}
+	if opt.SettingsTimeout > 0 {
+		rtReq = rtReq.WithContext(context.WithValue(rtReq.Context(), settingsTimeoutKey{}, opt.SettingsTimeout))
+	}
+	if opt.WireTap != nil {
+		rtReq = rtReq.WithContext(context.WithValue(rtReq.Context(), wireTapKey{}, wireTapOpt{tap: opt.WireTap, includeData: opt.WireTapData}))
+	}
+	rsp, err := cl.rt.RoundTrip(rtReq)
+	// include the time spent dialing in the Timings
+	if err == nil && rsp != nil {
+		if b := responseBodyOf(rsp); b != nil && !b.info.timings.Start.IsZero() {
+			b.info.timings.Start = start
+		}
+	}
+	// The server can't produce a response for this authority on a coalesced connection.
+	// Retry on a dedicated connection, see section 15.5.20 of RFC 9110.
+	// This is safe for all methods, since the server didn't process the request.
+	if err == nil && rsp != nil && rsp.StatusCode == http.StatusMisdirectedRequest && cl.hostname != hostname {
+		if retryReq, rerr := rewindBody(req); rerr == nil {
+			rsp.Body.Close()
+			t.markMisdirected(key, hostname, cl)
+			return t.roundTripOpt(retryReq, opt)
+		}
+	}
 	if err != nil {
 		// non-nil errors on roundtrip are likely due to a problem with the connection
 		// so we remove the client from the cache so that subsequent trips reconnect
-		// context cancelation is excluded as is does not signify a connection error
-		if !errors.Is(err, context.Canceled) {
-			t.removeClient(hostname)
+		// context cancelation is excluded as is does not signify a connection error,
+		// and neither does hitting the stream limit
+		if !errors.Is(err, context.Canceled) && !errors.Is(err, ErrStreamLimitReached) {
+			t.removeClient(key, cl)
 		}
 
 		if isReused {
 			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
-				return t.RoundTripOpt(req, opt)
+				retryReq, rerr := rewindBody(req)
+				if rerr != nil {
+					return nil, fmt.Errorf("%w: %w", rerr, err)
+				}
+				return t.roundTripOpt(retryReq, opt)
 			}
 		}
 	}
 	return rsp, err
 }
 
+func (t *Transport) defaultPort() string {
+	switch {
+	case t.DefaultPort == 0:
+		return "443"
+	case t.DefaultPort < 0:
+		return ""
+	default:
+		return strconv.Itoa(t.DefaultPort)
+	}
+}
+
 // RoundTrip does a round trip.
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return t.RoundTripOpt(req, RoundTripOpt{})
 }
 
-func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached bool) (rtc *roundTripperWithCount, isReused bool, err error) {
+// Warmup establishes a connection to the authority (host:port, the port defaults to Transport.DefaultPort)
+// without sending a request. It returns once the handshake has completed and the server's SETTINGS
+// were received. The connection is added to the pool and used for subsequent requests to this authority.
+// If a connection to the authority already exists, no new connection is dialed.
+func (t *Transport) Warmup(ctx context.Context, authority string) error {
+	t.initOnce.Do(func() { t.initErr = t.init() })
+	if t.initErr != nil {
+		return t.initErr
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+authority, nil)
+	if err != nil {
+		return err
+	}
+	hostname := authorityAddr(hostnameFromURL(req.URL), t.defaultPort())
+	if _, port, err := net.SplitHostPort(hostname); err != nil || port == "" {
+		return errors.New("http3: no port in authority")
+	}
+	var proxyURL *url.URL
+	if t.Proxy != nil && t.Dial == nil && t.DialConnection == nil {
+		proxyURL, err = t.Proxy(req)
+		if err != nil {
+			return err
+		}
+	}
+	key := clientKey(hostname, proxyURL, nil)
+	cl, _, err := t.getClient(ctx, hostname, proxyURL, nil, false)
+	if err != nil {
+		return err
+	}
+	defer cl.useCount.Add(-1)
+
+	select {
+	case <-cl.dialing:
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+	if cl.dialErr != nil {
+		t.removeClient(key, cl)
+		return cl.dialErr
+	}
+	select {
+	case <-cl.conn.HandshakeComplete():
+	case <-cl.conn.Context().Done():
+		return context.Cause(cl.conn.Context())
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+	if rs, ok := cl.rt.(interface{ ReceivedSettings() <-chan struct{} }); ok {
+		select {
+		case <-rs.ReceivedSettings():
+		case <-cl.conn.Context().Done():
+			return context.Cause(cl.conn.Context())
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+	return nil
+}
+
+// clientKey is the key of the client cache.
+// Connections tunneled through a proxy are not shared with direct connections,
+// and connections bound to a local address are not shared with other connections.
+func clientKey(hostname string, proxyURL *url.URL, localAddr *net.UDPAddr) string {
+	key := hostname
+	if proxyURL != nil {
+		key += " via " + proxyURL.Redacted()
+	}
+	if localAddr != nil {
+		key += " from " + localAddr.String()
+	}
+	return key
+}
+
+func (t *Transport) getClient(ctx context.Context, hostname string, proxyURL *url.URL, localAddr *net.UDPAddr, onlyCached bool) (rtc *roundTripperWithCount, isReused bool, err error) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
@@ -245,20 +843,34 @@ func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached b
 		t.clients = make(map[string]*roundTripperWithCount)
 	}
 
-	cl, ok := t.clients[hostname]
+	key := clientKey(hostname, proxyURL, localAddr)
+	cl, ok := t.clients[key]
+	// Connections that were closed (e.g. due to an idle timeout) can't be used anymore.
+	// Since no request was sent on them, it's safe to dial a new connection,
+	// using 0-RTT if possible.
+	if ok && cl.closed() {
+		delete(t.clients, key)
+		ok = false
+	}
+	if !ok && t.EnableConnectionCoalescing && proxyURL == nil && localAddr == nil {
+		cl, ok = t.coalescableClient(key, hostname)
+	}
 	if !ok {
 		if onlyCached {
 			return nil, false, ErrNoCachedConn
 		}
 		ctx, cancel := context.WithCancel(ctx)
 		cl = &roundTripperWithCount{
-			dialing: make(chan struct{}),
-			cancel:  cancel,
+			dialing:   make(chan struct{}),
+			cancel:    cancel,
+			proxied:   proxyURL != nil,
+			localAddr: localAddr,
+			hostname:  hostname,
 		}
 		go func() {
 			defer close(cl.dialing)
 			defer cancel()
-			conn, rt, err := t.dial(ctx, hostname)
+			conn, rt, err := t.dial(ctx, hostname, proxyURL, localAddr)
 			if err != nil {
 				cl.dialErr = err
 				return
@@ -266,12 +878,12 @@ func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached b
 			cl.conn = conn
 			cl.rt = rt
 		}()
-		t.clients[hostname] = cl
+		t.clients[key] = cl
 	}
 	select {
 	case <-cl.dialing:
 		if cl.dialErr != nil {
-			delete(t.clients, hostname)
+			delete(t.clients, key)
 			return nil, false, cl.dialErr
 		}
 		select {
@@ -285,7 +897,83 @@ func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached b
 	return cl, isReused, nil
 }
 
-func (t *Transport) dial(ctx context.Context, hostname string) (quic.EarlyConnection, singleRoundTripper, error) {
+// coalescableClient returns a client for a connection that was established for a different
+// authority, but that can be reused for hostname, and adds it to the client cache.
+// It must be called with the mutex held.
+// The mutex is released while the VerifyConnection callback is run, since the callback
+// might be slow, or it might call into the Transport.
+func (t *Transport) coalescableClient(key, hostname string) (*roundTripperWithCount, bool) {
+	candidates := t.coalescingCandidates(hostname)
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	cl := candidates[0]
+	if t.VerifyConnection != nil {
+		t.mutex.Unlock()
+		cl = nil
+		for _, c := range candidates {
+			if t.VerifyConnection(hostname, c.conn.ConnectionState().TLS) == nil {
+				cl = c
+				break
+			}
+		}
+		t.mutex.Lock()
+		if t.clients == nil { // the Transport was closed in the meantime
+			t.clients = make(map[string]*roundTripperWithCount)
+		}
+		// Another request might have added a client for this authority in the meantime.
+		if existing, ok := t.clients[key]; ok && !existing.closed() {
+			return existing, true
+		}
+		if cl == nil || cl.closed() {
+			return nil, false
+		}
+	}
+	t.clients[key] = cl
+	return cl, true
+}
+
+// coalescingCandidates returns the clients for connections that were established for a different
+// authority, and whose certificate is valid for hostname.
+// The VerifyConnection callback wasn't run for hostname on these connections yet.
+// It must be called with the mutex held.
+func (t *Transport) coalescingCandidates(hostname string) []*roundTripperWithCount {
+	host, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return nil
+	}
+	var candidates []*roundTripperWithCount
+	for authority, cl := range t.clients {
+		if _, p, err := net.SplitHostPort(authority); err != nil || p != port {
+			continue
+		}
+		// only consider connections that completed the handshake
+		select {
+		case <-cl.dialing:
+		default:
+			continue
+		}
+		if cl.dialErr != nil || cl.proxied || cl.localAddr != nil || cl.conn.Context().Err() != nil {
+			continue
+		}
+		if _, ok := cl.misdirected[hostname]; ok {
+			continue
+		}
+		select {
+		case <-cl.conn.HandshakeComplete():
+		default:
+			continue
+		}
+		cs := cl.conn.ConnectionState().TLS
+		if len(cs.PeerCertificates) == 0 || cs.PeerCertificates[0].VerifyHostname(host) != nil {
+			continue
+		}
+		candidates = append(candidates, cl)
+	}
+	return candidates
+}
+
+func (t *Transport) dial(ctx context.Context, hostname string, proxyURL *url.URL, localAddr *net.UDPAddr) (quic.EarlyConnection, singleRoundTripper, error) {
 	var tlsConf *tls.Config
 	if t.TLSClientConfig == nil {
 		tlsConf = &tls.Config{}
@@ -300,24 +988,74 @@ func (t *Transport) dial(ctx context.Context, hostname string) (quic.EarlyConnec
 		}
 		tlsConf.ServerName = sni
 	}
-	// Replace existing ALPNs by H3
-	tlsConf.NextProtos = []string{versionToALPN(t.QUICConfig.Versions[0])}
+	if t.VerifyConnection != nil {
+		verifyConnection := tlsConf.VerifyConnection
+		tlsConf.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verifyConnection != nil {
+				if err := verifyConnection(cs); err != nil {
+					return err
+				}
+			}
+			return t.VerifyConnection(hostname, cs)
+		}
+	}
+	if t.GetClientCertificate != nil {
+		tlsConf.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return t.GetClientCertificate(hostname, info)
+		}
+	}
+	if tlsConf.ClientSessionCache == nil {
+		tlsConf.ClientSessionCache = t.sessionCache
+	}
+	// Replace existing ALPNs by the HTTP/3 ALPNs of all QUIC versions that might be negotiated
+	tlsConf.NextProtos = versionsToALPNs(t.QUICConfig.Versions)
 
 	dial := t.Dial
-	if dial == nil {
-		if t.transport == nil {
-			udpConn, err := net.ListenUDP("udp", nil)
+	if dial == nil && t.DialConnection != nil {
+		dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+			conn, err := t.DialConnection(ctx, addr, tlsCfg, cfg)
+			if err != nil {
+				return nil, err
+			}
+			return &handshakeCompletedConn{Connection: conn}, nil
+		}
+	}
+	if dial == nil && proxyURL != nil {
+		dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+			return t.dialThroughProxy(ctx, proxyURL, addr, tlsCfg, cfg)
+		}
+	}
+	if dial == nil && localAddr != nil {
+		tr, err := t.localTransport(localAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+			udpAddr, err := t.resolveUDPAddr(ctx, addr)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
-			t.transport = &quic.Transport{Conn: udpConn}
+			return tr.DialEarly(ctx, udpAddr, tlsCfg, cfg)
+		}
+	}
+	if dial == nil {
+		tr := t.QUICTransport
+		if tr == nil {
+			if t.transport == nil {
+				udpConn, err := net.ListenUDP("udp", nil)
+				if err != nil {
+					return nil, nil, err
+				}
+				t.transport = &quic.Transport{Conn: udpConn}
+			}
+			tr = t.transport
 		}
 		dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
-			udpAddr, err := net.ResolveUDPAddr("udp", addr)
+			udpAddr, err := t.resolveUDPAddr(ctx, addr)
 			if err != nil {
 				return nil, err
 			}
-			return t.transport.DialEarly(ctx, udpAddr, tlsCfg, cfg)
+			return tr.DialEarly(ctx, udpAddr, tlsCfg, cfg)
 		}
 	}
 
@@ -325,16 +1063,77 @@ func (t *Transport) dial(ctx context.Context, hostname string) (quic.EarlyConnec
 	if err != nil {
 		return nil, nil, err
 	}
+	if t.OnConnectionClosed != nil {
+		context.AfterFunc(conn.Context(), func() {
+			t.OnConnectionClosed(hostname, context.Cause(conn.Context()))
+		})
+	}
 	return conn, t.newClient(conn), nil
 }
 
-func (t *Transport) removeClient(hostname string) {
+func (t *Transport) resolveUDPAddr(ctx context.Context, addr string) (*net.UDPAddr, error) {
+	if t.Resolve == nil {
+		return net.ResolveUDPAddr("udp", addr)
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := net.LookupPort("udp", portStr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := t.Resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("http3: no addresses found for %s", host)
+	}
+	return net.UDPAddrFromAddrPort(netip.AddrPortFrom(ips[0].Unmap(), uint16(port))), nil
+}
+
+// handshakeCompletedConn wraps a quic.Connection whose handshake has already completed,
+// such that it can be used wherever a quic.EarlyConnection is expected.
+type handshakeCompletedConn struct {
+	quic.Connection
+}
+
+var _ quic.EarlyConnection = &handshakeCompletedConn{}
+
+func (c *handshakeCompletedConn) HandshakeComplete() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+func (c *handshakeCompletedConn) NextConnection(context.Context) (quic.Connection, error) {
+	return c.Connection, nil
+}
+
+// removeClient removes the client for hostname, unless it was already replaced by a new client.
+// When many requests fail on a connection at the same time, this makes sure that the first
+// request to retry dials a new connection, and that all other requests wait for the same dial.
+func (t *Transport) removeClient(hostname string, cl *roundTripperWithCount) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	if t.clients == nil {
-		return
+	if t.clients[hostname] == cl {
+		delete(t.clients, hostname)
+	}
+}
+
+// markMisdirected removes a coalesced connection for an authority the server refused to serve,
+// and makes sure that it is not coalesced for this authority again.
+func (t *Transport) markMisdirected(key, hostname string, cl *roundTripperWithCount) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.clients[key] == cl {
+		delete(t.clients, key)
+	}
+	if cl.misdirected == nil {
+		cl.misdirected = make(map[string]struct{})
 	}
-	delete(t.clients, hostname)
+	cl.misdirected[hostname] = struct{}{}
 }
 
 // NewClientConn creates a new HTTP/3 client connection on top of a QUIC connection.
@@ -344,16 +1143,39 @@ func (t *Transport) removeClient(hostname string) {
 // Obtaining a ClientConn is only needed for more advanced use cases, such as
 // using Extended CONNECT for WebTransport or the various MASQUE protocols.
 func (t *Transport) NewClientConn(conn quic.Connection) *ClientConn {
-	return newClientConn(
-		conn,
-		t.EnableDatagrams,
-		t.AdditionalSettings,
-		t.StreamHijacker,
-		t.UniStreamHijacker,
-		t.MaxResponseHeaderBytes,
-		t.DisableCompression,
-		t.Logger,
-	)
+	return newClientConn(conn, t.clientConnConfig())
+}
+
+// clientConnConfig returns the configuration for the ClientConns created by this Transport.
+func (t *Transport) clientConnConfig() *clientConnConfig {
+	return &clientConnConfig{
+		enableDatagrams:             t.EnableDatagrams,
+		additionalSettings:          t.AdditionalSettings,
+		controlStreamInit:           t.ControlStreamInit,
+		streamHijacker:              t.StreamHijacker,
+		uniStreamHijacker:           t.UniStreamHijacker,
+		maxResponseHeaderBytes:      t.MaxResponseHeaderBytes,
+		maxResponseHeaderFields:     t.MaxResponseHeaderFields,
+		disableCompression:          t.DisableCompression,
+		decompressAcceptedEncodings: t.DecompressAcceptedEncodings,
+		preserveRawResponseHeaders:  t.PreserveRawResponseHeaders,
+		maxDecompressedSize:         t.MaxDecompressedSize,
+		maxResponseBodySize:         t.MaxResponseBodySize,
+		flushInterval:               t.FlushInterval,
+		rejectConnectionHeaders:     t.RejectConnectionSpecificHeaders,
+		userAgent:                   t.UserAgent,
+		acceptEncoding:              t.AcceptEncoding,
+		modifyRequest:               t.ModifyRequest,
+		modifyResponse:              t.ModifyResponse,
+		onStreamOpen:                t.OnStreamOpen,
+		interceptor:                 t.Interceptor,
+		qpackTracer:                 t.QPACKTracer,
+		onSettings:                  t.OnSettings,
+		datagramQueueLen:            t.DatagramQueueLen,
+		dropOldestDatagrams:         t.DropOldestDatagrams,
+		logger:                      t.Logger,
+		clock:                       t.clock,
+	}
 }
 
 // Close closes the QUIC connections that this Transport has used.
@@ -366,6 +1188,11 @@ func (t *Transport) Close() error {
 		}
 	}
 	t.clients = nil
+	if t.proxyTransport != nil {
+		if err := t.proxyTransport.Close(); err != nil {
+			return err
+		}
+	}
 	if t.transport != nil {
 		if err := t.transport.Close(); err != nil {
 			return err
@@ -375,9 +1202,137 @@ func (t *Transport) Close() error {
 		}
 		t.transport = nil
 	}
+	for addr, tr := range t.localTransports {
+		if err := tr.Close(); err != nil {
+			return err
+		}
+		if err := tr.Conn.Close(); err != nil {
+			return err
+		}
+		delete(t.localTransports, addr)
+	}
 	return nil
 }
 
+// localTransport returns the transport bound to the local address, creating it if necessary.
+// All connections bound to the same local address share the same UDP socket.
+func (t *Transport) localTransport(addr *net.UDPAddr) (*quic.Transport, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if tr, ok := t.localTransports[addr.String()]; ok {
+		return tr, nil
+	}
+	udpConn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if t.localTransports == nil {
+		t.localTransports = make(map[string]*quic.Transport)
+	}
+	tr := &quic.Transport{Conn: udpConn}
+	t.localTransports[addr.String()] = tr
+	return tr, nil
+}
+
+// Shutdown gracefully shuts down the QUIC connections that this Transport has used.
+// The connections are removed from the pool, so they aren't used for new requests.
+// On every connection, a GOAWAY frame is sent, and the connection is closed (with H3_NO_ERROR)
+// once all in-flight requests have completed, see ClientConn.Shutdown.
+// If the context is canceled before, the remaining connections are closed immediately,
+// and the context's error is returned.
+// Finally, the Transport is closed, as if Close was called.
+func (t *Transport) Shutdown(ctx context.Context) error {
+	t.mutex.Lock()
+	// with connection coalescing, a connection might be used for multiple hostnames
+	clients := make(map[*roundTripperWithCount]struct{}, len(t.clients))
+	for _, cl := range t.clients {
+		clients[cl] = struct{}{}
+	}
+	t.clients = nil
+	t.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for cl := range clients {
+		wg.Add(1)
+		go func(cl *roundTripperWithCount) {
+			defer wg.Done()
+			if err := cl.Shutdown(ctx); err != nil && t.Logger != nil {
+				t.Logger.Debug("shutting down connection failed", "error", err)
+			}
+		}(cl)
+	}
+	wg.Wait()
+	if err := t.Close(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// ClearSessionCache removes all TLS session tickets from the Transport's default session cache.
+// Subsequent connections will use a full handshake, and won't be able to use 0-RTT.
+// It has no effect if the TLSClientConfig sets a ClientSessionCache.
+func (t *Transport) ClearSessionCache() {
+	t.initOnce.Do(func() { t.initErr = t.init() })
+	t.sessionCache.Clear()
+}
+
+// clearableSessionCache is an in-memory tls.ClientSessionCache that can be cleared.
+type clearableSessionCache struct {
+	mx    sync.Mutex
+	cache tls.ClientSessionCache
+}
+
+var _ tls.ClientSessionCache = &clearableSessionCache{}
+
+func (c *clearableSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.cache == nil {
+		return nil, false
+	}
+	return c.cache.Get(sessionKey)
+}
+
+func (c *clearableSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.cache == nil {
+		c.cache = tls.NewLRUClientSessionCache(0) // use the default capacity
+	}
+	c.cache.Put(sessionKey, cs)
+}
+
+func (c *clearableSessionCache) Clear() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.cache = nil
+}
+
+var errCannotRewindBody = errors.New("http3: cannot retry request with a body, Request.GetBody is nil")
+
+// rewindBody returns a request that can be used to retry req.
+// The body of req was (possibly partially) consumed by the previous attempt,
+// so a fresh body is obtained from Request.GetBody.
+func rewindBody(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errCannotRewindBody
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	newReq := *req
+	newReq.Body = body
+	return &newReq, nil
+}
+
 func closeRequestBody(req *http.Request) {
 	if req.Body != nil {
 		req.Body.Close()
@@ -406,6 +1361,62 @@ func isNotToken(r rune) bool {
 	return !httpguts.IsTokenRune(r)
 }
 
+// ConnInfo describes a connection of a Transport, see Transport.Connections.
+type ConnInfo struct {
+	// Authority is the authority (host:port) that the connection was dialed for.
+	// With EnableConnectionCoalescing, the connection might also be used for other authorities.
+	Authority string
+	// Proxied says if the connection is tunneled through a proxy, see Transport.Proxy.
+	Proxied bool
+	// ActiveRequests is the number of requests that are currently in flight on the connection.
+	ActiveRequests int
+	// Used0RTT says if the connection used 0-RTT, see quic.ConnectionState.
+	Used0RTT bool
+	// Stats are the RTT estimates and the congestion window of the QUIC connection.
+	Stats quic.ConnectionStats
+}
+
+// Connections returns a snapshot of the connections in the transport's pool,
+// sorted by authority. Every connection is only listed once, even if it is used for multiple authorities.
+// Connections that are still being dialed, or that were closed, are not included.
+// It does not include connections obtained via NewClientConn.
+func (t *Transport) Connections() []ConnInfo {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	conns := make([]ConnInfo, 0, len(t.clients))
+	seen := make(map[*roundTripperWithCount]struct{}, len(t.clients))
+	for _, cl := range t.clients {
+		if _, ok := seen[cl]; ok {
+			continue
+		}
+		seen[cl] = struct{}{}
+		select {
+		case <-cl.dialing:
+		default:
+			continue
+		}
+		if cl.dialErr != nil || cl.closed() {
+			continue
+		}
+		// A ClientConn counts requests until the response body has been read or closed.
+		// Fall back to the number of calls to RoundTrip that haven't returned yet.
+		activeRequests := int(cl.useCount.Load())
+		if ar, ok := cl.rt.(interface{ ActiveRequests() int }); ok {
+			activeRequests = ar.ActiveRequests()
+		}
+		conns = append(conns, ConnInfo{
+			Authority:      cl.hostname,
+			Proxied:        cl.proxied,
+			ActiveRequests: activeRequests,
+			Used0RTT:       cl.conn.ConnectionState().Used0RTT,
+			Stats:          cl.conn.ConnectionStats(),
+		})
+	}
+	slices.SortFunc(conns, func(a, b ConnInfo) int { return strings.Compare(a.Authority, b.Authority) })
+	return conns
+}
+
 // CloseIdleConnections closes any QUIC connections in the transport's pool that are currently idle.
 // An idle connection is one that was previously used for requests but is now sitting unused.
 // This method does not interrupt any connections currently in use.
@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
@@ -54,13 +59,31 @@ var _ = Describe("Transport", func() {
 		Expect(err).ToNot(HaveOccurred())
 	})
 
-	It("rejects quic.Configs that allow multiple QUIC versions", func() {
+	It("offers multiple QUIC versions", func() {
+		var dialAddrCalled bool
+		tr := &Transport{
+			QUICConfig: &quic.Config{Versions: []quic.Version{protocol.Version2, protocol.Version1}},
+			Dial: func(_ context.Context, _ string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlyConnection, error) {
+				defer GinkgoRecover()
+				Expect(quicConf.Versions).To(Equal([]protocol.Version{protocol.Version2, protocol.Version1}))
+				// both versions use the same ALPN
+				Expect(tlsConf.NextProtos).To(Equal([]string{NextProtoH3}))
+				dialAddrCalled = true
+				return nil, errors.New("test done")
+			},
+		}
+		_, err := tr.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		Expect(dialAddrCalled).To(BeTrue())
+	})
+
+	It("rejects quic.Configs that only contain versions that can't be used for HTTP/3", func() {
 		qconf := &quic.Config{
-			Versions: []quic.Version{protocol.Version2, protocol.Version1},
+			Versions: []quic.Version{0x1234},
 		}
 		tr := &Transport{QUICConfig: qconf}
 		_, err := tr.RoundTrip(req)
-		Expect(err).To(MatchError("can only use a single QUIC version for dialing a HTTP/3 connection"))
+		Expect(err).To(MatchError("none of the QUIC versions can be used for dialing a HTTP/3 connection"))
 	})
 
 	It("uses the default QUIC and TLS config if none is give", func() {
@@ -97,6 +120,50 @@ var _ = Describe("Transport", func() {
 		Expect(dialAddrCalled).To(BeTrue())
 	})
 
+	DescribeTable("dialing the authority of the request URL",
+		func(url string, defaultPort int, expected string) {
+			var dialed string
+			tr := &Transport{
+				DefaultPort: defaultPort,
+				Dial: func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					dialed = hostname
+					return nil, errors.New("test done")
+				},
+			}
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = tr.RoundTripOpt(req, RoundTripOpt{})
+			Expect(err).To(MatchError("test done"))
+			Expect(dialed).To(Equal(expected))
+		},
+		Entry("IPv6 literal with port", "https://[::1]:8443/foo", 0, "[::1]:8443"),
+		Entry("IPv6 literal without port", "https://[::1]/foo", 0, "[::1]:443"),
+		Entry("non-canonical IPv6 literal", "https://[0:0::1]:8443/foo", 0, "[::1]:8443"),
+		Entry("IPv4 address without port", "https://127.0.0.1/foo", 0, "127.0.0.1:443"),
+		Entry("host name with empty port", "https://quic-go.net:/foo", 0, "quic-go.net:443"),
+		Entry("upper-case host name", "https://QUIC-go.net/foo", 0, "quic-go.net:443"),
+		Entry("custom default port", "https://quic-go.net/foo", 8443, "quic-go.net:8443"),
+		Entry("custom default port, IPv6 literal", "https://[::1]/foo", 8443, "[::1]:8443"),
+		Entry("custom default port, explicit port", "https://quic-go.net:1337/foo", 8443, "quic-go.net:1337"),
+		Entry("disabled default port, explicit port", "https://[::1]:1337/foo", -1, "[::1]:1337"),
+	)
+
+	It("rejects URLs without a port, if the default port is disabled", func() {
+		tr := &Transport{
+			DefaultPort: -1,
+			Dial: func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				Fail("didn't expect any dial")
+				return nil, nil
+			},
+		}
+		for _, url := range []string{"https://quic-go.net/foo", "https://[::1]/foo"} {
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = tr.RoundTripOpt(req, RoundTripOpt{})
+			Expect(err).To(MatchError("http3: no port in request URL"))
+		}
+	})
+
 	It("sets the ServerName in the tls.Config, if not set", func() {
 		const host = "foo.bar"
 		var dialCalled bool
@@ -142,6 +209,293 @@ var _ = Describe("Transport", func() {
 		Expect(tlsConf.NextProtos).To(Equal([]string{"proto foo", "proto bar"}))
 	})
 
+	Context("verifying connections", func() {
+		It("preserves the verification callbacks of the tls.Config", func() {
+			var dialCalled bool
+			tlsConf := &tls.Config{
+				VerifyPeerCertificate: func([][]byte, [][]*x509.Certificate) error { return errors.New("peer certificate") },
+				VerifyConnection:      func(tls.ConnectionState) error { return errors.New("connection") },
+			}
+			tr := &Transport{
+				TLSClientConfig: tlsConf,
+				Dial: func(_ context.Context, _ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					defer GinkgoRecover()
+					Expect(tlsConf.VerifyPeerCertificate(nil, nil)).To(MatchError("peer certificate"))
+					Expect(tlsConf.VerifyConnection(tls.ConnectionState{})).To(MatchError("connection"))
+					dialCalled = true
+					return nil, errors.New("test done")
+				},
+			}
+			_, err := tr.RoundTrip(req)
+			Expect(err).To(MatchError("test done"))
+			Expect(dialCalled).To(BeTrue())
+		})
+
+		It("calls VerifyConnection with the authority", func() {
+			var verifiedAuthority string
+			var verifyConnection func(tls.ConnectionState) error
+			tr := &Transport{
+				TLSClientConfig: &tls.Config{
+					VerifyConnection: func(cs tls.ConnectionState) error {
+						if cs.ServerName == "fail" {
+							return errors.New("tls.Config verification failed")
+						}
+						return nil
+					},
+				},
+				VerifyConnection: func(authority string, _ tls.ConnectionState) error {
+					verifiedAuthority = authority
+					return errors.New("verification failed")
+				},
+				Dial: func(_ context.Context, _ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					verifyConnection = tlsConf.VerifyConnection
+					return nil, errors.New("test done")
+				},
+			}
+			_, err := tr.RoundTrip(req)
+			Expect(err).To(MatchError("test done"))
+			Expect(verifyConnection).ToNot(BeNil())
+			// the VerifyConnection callback of the tls.Config is called first
+			Expect(verifyConnection(tls.ConnectionState{ServerName: "fail"})).To(MatchError("tls.Config verification failed"))
+			Expect(verifiedAuthority).To(BeEmpty())
+			Expect(verifyConnection(tls.ConnectionState{})).To(MatchError("verification failed"))
+			Expect(verifiedAuthority).To(Equal("www.example.org:443"))
+		})
+	})
+
+	Context("client certificates", func() {
+		It("preserves the GetClientCertificate callback of the tls.Config", func() {
+			cert := &tls.Certificate{}
+			var dialCalled bool
+			tr := &Transport{
+				TLSClientConfig: &tls.Config{
+					GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return cert, nil },
+				},
+				Dial: func(_ context.Context, _ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					defer GinkgoRecover()
+					Expect(tlsConf.GetClientCertificate(&tls.CertificateRequestInfo{})).To(BeIdenticalTo(cert))
+					dialCalled = true
+					return nil, errors.New("test done")
+				},
+			}
+			_, err := tr.RoundTrip(req)
+			Expect(err).To(MatchError("test done"))
+			Expect(dialCalled).To(BeTrue())
+		})
+
+		It("calls GetClientCertificate with the authority", func() {
+			cert := &tls.Certificate{}
+			var getClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+			var authority string
+			tr := &Transport{
+				TLSClientConfig: &tls.Config{
+					GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+						return nil, errors.New("shouldn't be called")
+					},
+				},
+				GetClientCertificate: func(a string, _ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					authority = a
+					return cert, nil
+				},
+				Dial: func(_ context.Context, _ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					getClientCertificate = tlsConf.GetClientCertificate
+					return nil, errors.New("test done")
+				},
+			}
+			_, err := tr.RoundTrip(req)
+			Expect(err).To(MatchError("test done"))
+			Expect(getClientCertificate).ToNot(BeNil())
+			Expect(getClientCertificate(&tls.CertificateRequestInfo{})).To(BeIdenticalTo(cert))
+			Expect(authority).To(Equal("www.example.org:443"))
+		})
+	})
+
+	Context("TLS session cache", func() {
+		It("uses a default session cache", func() {
+			caches := make(chan tls.ClientSessionCache, 2)
+			tr := &Transport{
+				TLSClientConfig: &tls.Config{},
+				Dial: func(_ context.Context, _ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					caches <- tlsConf.ClientSessionCache
+					return nil, errors.New("test done")
+				},
+			}
+			for _, host := range []string{"foo.bar", "bar.baz"} {
+				req, err := http.NewRequest(http.MethodGet, "https://"+host, nil)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = tr.RoundTrip(req)
+				Expect(err).To(MatchError("test done"))
+			}
+			var cache1, cache2 tls.ClientSessionCache
+			Expect(caches).To(Receive(&cache1))
+			Expect(caches).To(Receive(&cache2))
+			Expect(cache1).ToNot(BeNil())
+			// the same cache is used for all connections
+			Expect(cache1).To(BeIdenticalTo(cache2))
+			// make sure the original tls.Config was not modified
+			Expect(tr.TLSClientConfig.ClientSessionCache).To(BeNil())
+		})
+
+		It("uses the session cache from the tls.Config", func() {
+			cache := tls.NewLRUClientSessionCache(1)
+			var dialCalled bool
+			tr := &Transport{
+				TLSClientConfig: &tls.Config{ClientSessionCache: cache},
+				Dial: func(_ context.Context, _ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					defer GinkgoRecover()
+					Expect(tlsConf.ClientSessionCache).To(BeIdenticalTo(cache))
+					dialCalled = true
+					return nil, errors.New("test done")
+				},
+			}
+			_, err := tr.RoundTrip(req)
+			Expect(err).To(MatchError("test done"))
+			Expect(dialCalled).To(BeTrue())
+		})
+
+		It("clears the session cache", func() {
+			var cache tls.ClientSessionCache
+			tr := &Transport{
+				Dial: func(_ context.Context, _ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					cache = tlsConf.ClientSessionCache
+					return nil, errors.New("test done")
+				},
+			}
+			_, err := tr.RoundTrip(req)
+			Expect(err).To(MatchError("test done"))
+			Expect(cache).ToNot(BeNil())
+			state, err := tls.NewResumptionState([]byte("ticket"), &tls.SessionState{})
+			Expect(err).ToNot(HaveOccurred())
+			cache.Put("foo", state)
+			_, ok := cache.Get("foo")
+			Expect(ok).To(BeTrue())
+			tr.ClearSessionCache()
+			_, ok = cache.Get("foo")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	It("overrides the keep-alive period and the idle timeout", func() {
+		tr := &Transport{
+			KeepAlivePeriod: 3 * time.Second,
+			MaxIdleTimeout:  42 * time.Second,
+			Dial: func(_ context.Context, _ string, _ *tls.Config, quicConf *quic.Config) (quic.EarlyConnection, error) {
+				defer GinkgoRecover()
+				Expect(quicConf.KeepAlivePeriod).To(Equal(3 * time.Second))
+				Expect(quicConf.MaxIdleTimeout).To(Equal(42 * time.Second))
+				Expect(quicConf.MaxIncomingStreams).To(Equal(defaultQuicConfig.MaxIncomingStreams))
+				return nil, errors.New("test done")
+			},
+		}
+		_, err := tr.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		// make sure the default config was not modified
+		Expect(defaultQuicConfig.KeepAlivePeriod).To(Equal(10 * time.Second))
+	})
+
+	It("disables keep-alives", func() {
+		quicConf := &quic.Config{KeepAlivePeriod: time.Second, MaxIdleTimeout: 5 * time.Second}
+		tr := &Transport{
+			QUICConfig:      quicConf,
+			KeepAlivePeriod: -1,
+			Dial: func(_ context.Context, _ string, _ *tls.Config, quicConf *quic.Config) (quic.EarlyConnection, error) {
+				defer GinkgoRecover()
+				Expect(quicConf.KeepAlivePeriod).To(BeZero())
+				Expect(quicConf.MaxIdleTimeout).To(Equal(5 * time.Second))
+				return nil, errors.New("test done")
+			},
+		}
+		_, err := tr.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		// make sure the original quic.Config was not modified
+		Expect(quicConf.KeepAlivePeriod).To(Equal(time.Second))
+	})
+
+	It("uses the token store", func() {
+		tokenStore := quic.NewLRUTokenStore(1, 1)
+		quicConf := &quic.Config{MaxIdleTimeout: 5 * time.Second}
+		tr := &Transport{
+			QUICConfig: quicConf,
+			TokenStore: tokenStore,
+			Dial: func(_ context.Context, _ string, _ *tls.Config, quicConf *quic.Config) (quic.EarlyConnection, error) {
+				defer GinkgoRecover()
+				Expect(quicConf.TokenStore).To(Equal(tokenStore))
+				Expect(quicConf.MaxIdleTimeout).To(Equal(5 * time.Second))
+				return nil, errors.New("test done")
+			},
+		}
+		_, err := tr.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		// make sure the original quic.Config was not modified
+		Expect(quicConf.TokenStore).To(BeNil())
+	})
+
+	It("overrides the congestion control algorithm", func() {
+		quicConf := &quic.Config{MaxIdleTimeout: 5 * time.Second}
+		tr := &Transport{
+			QUICConfig:        quicConf,
+			CongestionControl: quic.CongestionControlCubic,
+			Dial: func(_ context.Context, _ string, _ *tls.Config, quicConf *quic.Config) (quic.EarlyConnection, error) {
+				defer GinkgoRecover()
+				Expect(quicConf.CongestionControl).To(Equal(quic.CongestionControlCubic))
+				Expect(quicConf.MaxIdleTimeout).To(Equal(5 * time.Second))
+				return nil, errors.New("test done")
+			},
+		}
+		_, err := tr.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		// make sure the original quic.Config was not modified
+		Expect(quicConf.CongestionControl).To(BeZero())
+	})
+
+	It("uses the custom resolver", func() {
+		ln, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		resolved := make(chan string, 1)
+		tr := &Transport{
+			Resolve: func(_ context.Context, host string) ([]netip.Addr, error) {
+				resolved <- host
+				return []netip.Addr{netip.MustParseAddr("127.0.0.1")}, nil
+			},
+		}
+		defer tr.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodGet,
+			fmt.Sprintf("https://quic-go.test:%d/", ln.LocalAddr().(*net.UDPAddr).Port),
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		errChan := make(chan error, 1)
+		go func() {
+			_, err := tr.RoundTrip(req)
+			errChan <- err
+		}()
+		Eventually(resolved).Should(Receive(Equal("quic-go.test")))
+		// the Initial packet is sent to the address returned by the resolver
+		ln.SetReadDeadline(time.Now().Add(scaleDuration(time.Second)))
+		_, _, err = ln.ReadFrom(make([]byte, 1500))
+		Expect(err).ToNot(HaveOccurred())
+		cancel()
+		Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+	})
+
+	It("returns errors from the custom resolver", func() {
+		testErr := errors.New("test done")
+		tr := &Transport{
+			Resolve: func(context.Context, string) ([]netip.Addr, error) { return nil, testErr },
+		}
+		defer tr.Close()
+		_, err := tr.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+		tr.Resolve = func(context.Context, string) ([]netip.Addr, error) { return nil, nil }
+		_, err = tr.RoundTrip(req)
+		Expect(err).To(MatchError("http3: no addresses found for www.example.org"))
+	})
+
 	It("uses the custom dialer, if provided", func() {
 		testErr := errors.New("test done")
 		tlsConf := &tls.Config{ServerName: "foo.bar"}
@@ -238,218 +592,1059 @@ var _ = Describe("Transport", func() {
 			Expect(err).ToNot(HaveOccurred())
 			req2, err = http.NewRequest("GET", "https://quic-go.net/file2.html", nil)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(req1.URL).ToNot(Equal(req2.URL))
+			Expect(req1.URL).ToNot(Equal(req2.URL))
+		})
+
+		It("reuses existing clients", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
+
+			cl.EXPECT().RoundTrip(req1).Return(&http.Response{Request: req1}, nil)
+			cl.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
+			var count int
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				count++
+				return conn, nil
+			}
+			rsp, err := tr.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req1))
+			rsp, err = tr.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req2))
+			Expect(count).To(Equal(1))
+		})
+
+		It("warms up a connection that is used for subsequent requests", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			var count int
+			tr.Dial = func(_ context.Context, addr string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+				Expect(addr).To(Equal("quic-go.net:443"))
+				count++
+				return conn, nil
+			}
+			Expect(tr.Warmup(context.Background(), "quic-go.net")).To(Succeed())
+			Expect(count).To(Equal(1))
+
+			cl.EXPECT().RoundTrip(req1).Return(&http.Response{Request: req1}, nil)
+			rsp, err := tr.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req1))
+			Expect(count).To(Equal(1))
+		})
+
+		It("returns the dial error when warming up a connection", func() {
+			testErr := errors.New("test error")
+			var count int
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				count++
+				return nil, testErr
+			}
+			Expect(tr.Warmup(context.Background(), "quic-go.net")).To(MatchError(testErr))
+			// the failed connection is not cached
+			Expect(tr.Warmup(context.Background(), "quic-go.net")).To(MatchError(testErr))
+			Expect(count).To(Equal(2))
+		})
+
+		It("stops waiting for the handshake when warming up a connection, if the context is canceled", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn.EXPECT().HandshakeComplete().Return(make(chan struct{})).AnyTimes()
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				return conn, nil
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(10*time.Millisecond))
+			defer cancel()
+			Expect(tr.Warmup(ctx, "quic-go.net:443")).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("dials a new connection if the cached connection was closed", func() {
+			cl1 := NewMockSingleRoundTripper(mockCtrl)
+			cl2 := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl1
+			clientChan <- cl2
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			ctx, cancel := context.WithCancel(context.Background())
+			conn1 := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn1.EXPECT().Context().Return(ctx).AnyTimes()
+			conn1.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			conn2 := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn2.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn2.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			var count int
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				count++
+				if count == 1 {
+					return conn1, nil
+				}
+				return conn2, nil
+			}
+			cl1.EXPECT().RoundTrip(req1).Return(&http.Response{Request: req1}, nil)
+			rsp, err := tr.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req1))
+
+			// the connection is closed, e.g. due to an idle timeout
+			cancel()
+			cl2.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
+			rsp, err = tr.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req2))
+			Expect(count).To(Equal(2))
+		})
+
+		Context("redialing after the connection died", func() {
+			const num = 100
+
+			var (
+				conn1, conn2 *mockquic.MockEarlyConnection
+				cl1, cl2     *MockSingleRoundTripper
+				closeConn1   context.CancelFunc
+				dials        atomic.Int32
+				blocked      atomic.Int32
+				died         chan struct{}
+			)
+
+			BeforeEach(func() {
+				dials.Store(0)
+				blocked.Store(0)
+				died = make(chan struct{})
+				handshakeChan := make(chan struct{})
+				close(handshakeChan)
+				var ctx context.Context
+				ctx, closeConn1 = context.WithCancel(context.Background())
+				conn1 = mockquic.NewMockEarlyConnection(mockCtrl)
+				conn1.EXPECT().Context().Return(ctx).AnyTimes()
+				conn1.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+				conn2 = mockquic.NewMockEarlyConnection(mockCtrl)
+				conn2.EXPECT().Context().Return(context.Background()).AnyTimes()
+				conn2.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+				cl1 = NewMockSingleRoundTripper(mockCtrl)
+				cl2 = NewMockSingleRoundTripper(mockCtrl)
+				tr.newClient = func(c quic.EarlyConnection) singleRoundTripper {
+					if c == conn1 {
+						return cl1
+					}
+					return cl2
+				}
+
+				tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+					dials.Add(1)
+					return conn1, nil
+				}
+				cl1.EXPECT().RoundTrip(req1).Return(&http.Response{Request: req1}, nil)
+				_, err := tr.RoundTrip(req1)
+				Expect(err).ToNot(HaveOccurred())
+
+				// all requests are sent on the first connection, and fail once it dies
+				cl1.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+					blocked.Add(1)
+					<-died
+					return nil, &qerr.IdleTimeoutError{}
+				}).Times(num)
+			})
+
+			runRequests := func() <-chan error {
+				errChan := make(chan error, num)
+				for i := 0; i < num; i++ {
+					go func() { _, err := tr.RoundTrip(req2.Clone(context.Background())); errChan <- err }()
+				}
+				Eventually(func() int32 { return blocked.Load() }).Should(BeEquivalentTo(num))
+				closeConn1()
+				close(died)
+				return errChan
+			}
+
+			It("dials a single new connection", func() {
+				tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+					dials.Add(1)
+					return conn2, nil
+				}
+				cl2.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+					return &http.Response{Request: r}, nil
+				}).Times(num)
+				errChan := runRequests()
+				for i := 0; i < num; i++ {
+					var err error
+					Eventually(errChan).Should(Receive(&err))
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(dials.Load()).To(BeEquivalentTo(2))
+			})
+
+			It("returns the error of the new dial to all requests", func() {
+				testErr := errors.New("test err")
+				releaseDial := make(chan struct{})
+				tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+					dials.Add(1)
+					<-releaseDial
+					return nil, testErr
+				}
+				errChan := runRequests()
+				// give all requests time to join the dial
+				time.Sleep(scaleDuration(20 * time.Millisecond))
+				close(releaseDial)
+				for i := 0; i < num; i++ {
+					var err error
+					Eventually(errChan).Should(Receive(&err))
+					Expect(err).To(MatchError(testErr))
+				}
+				Expect(dials.Load()).To(BeEquivalentTo(2))
+			})
+		})
+
+		It("uses connections returned by DialConnection", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			// don't EXPECT any calls to HandshakeComplete
+			tr.newClient = func(c quic.EarlyConnection) singleRoundTripper {
+				defer GinkgoRecover()
+				Expect(c.HandshakeComplete()).To(BeClosed())
+				next, err := c.NextConnection(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(next).To(Equal(conn))
+				return cl
+			}
+			var count int
+			tr.DialConnection = func(_ context.Context, addr string, tlsConf *tls.Config, _ *quic.Config) (quic.Connection, error) {
+				defer GinkgoRecover()
+				Expect(addr).To(Equal("quic-go.net:443"))
+				Expect(tlsConf.NextProtos).To(Equal([]string{NextProtoH3}))
+				count++
+				return conn, nil
+			}
+			cl.EXPECT().RoundTrip(req1).Return(&http.Response{Request: req1}, nil)
+			cl.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
+			rsp, err := tr.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req1))
+			rsp, err = tr.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req2))
+			Expect(count).To(Equal(1))
+		})
+
+		It("prefers Dial over DialConnection", func() {
+			testErr := errors.New("test done")
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				return nil, testErr
+			}
+			tr.DialConnection = func(context.Context, string, *tls.Config, *quic.Config) (quic.Connection, error) {
+				Fail("didn't expect DialConnection to be called")
+				return nil, nil
+			}
+			_, err := tr.RoundTrip(req1)
+			Expect(err).To(MatchError(testErr))
+		})
+
+		It("rejects requests bound to a local address when a custom Dial function is used", func() {
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				Fail("didn't expect Dial to be called")
+				return nil, nil
+			}
+			_, err := tr.RoundTripOpt(req1, RoundTripOpt{LocalAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}})
+			Expect(err).To(MatchError("http3: RoundTripOpt.LocalAddr can't be used with a custom dial function or a proxy"))
+		})
+
+		It("keys connections on the URL host, not on Request.Host", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
+			var dialed []string
+			tr.Dial = func(_ context.Context, addr string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+				dialed = append(dialed, addr)
+				return conn, nil
+			}
+			req1.Host = "authority1.example"
+			req2.Host = "authority2.example"
+			cl.EXPECT().RoundTrip(req1).Return(&http.Response{Request: req1}, nil)
+			cl.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
+			_, err := tr.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = tr.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dialed).To(Equal([]string{"quic-go.net:443"}))
+		})
+
+		It("redials a connection if dialing failed", func() {
+			cl1 := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl1
+
+			req1, err := http.NewRequest("GET", "https://quic-go.net/foo.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req2, err := http.NewRequest("GET", "https://quic-go.net/bar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			testErr := errors.New("handshake error")
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			var count int
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				count++
+				if count == 1 {
+					return nil, testErr
+				}
+				return conn, nil
+			}
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
+			cl1.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
+			_, err = tr.RoundTrip(req1)
+			Expect(err).To(MatchError(testErr))
+			rsp, err := tr.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req2))
+			Expect(count).To(Equal(2))
+		})
+
+		It("immediately removes a clients when a request errored", func() {
+			cl1 := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl1
+			cl2 := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl2
+
+			req1, err := http.NewRequest("GET", "https://quic-go.net/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req2, err := http.NewRequest("GET", "https://quic-go.net/bar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			var count int
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				count++
+				return conn, nil
+			}
+			testErr := errors.New("test err")
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
+			cl1.EXPECT().RoundTrip(req1).Return(nil, testErr)
+			cl2.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
+			_, err = tr.RoundTrip(req1)
+			Expect(err).To(MatchError(testErr))
+			rsp, err := tr.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req2))
+			Expect(count).To(Equal(2))
+		})
+
+		It("does not remove a client when a request returns context canceled error", func() {
+			cl1 := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl1
+			cl2 := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl2
+
+			req1, err := http.NewRequest("GET", "https://quic-go.net/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req2, err := http.NewRequest("GET", "https://quic-go.net/bar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			var count int
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				count++
+				return conn, nil
+			}
+			testErr := context.Canceled
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
+			cl1.EXPECT().RoundTrip(req1).Return(nil, testErr)
+			cl1.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
+			_, err = tr.RoundTrip(req1)
+			Expect(err).To(MatchError(testErr))
+			rsp, err := tr.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req2))
+			Expect(count).To(Equal(1))
+		})
+
+		It("recreates a client when a request times out", func() {
+			var reqCount int
+			cl1 := NewMockSingleRoundTripper(mockCtrl)
+			cl1.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+				reqCount++
+				if reqCount == 1 { // the first request is successful...
+					Expect(req.URL).To(Equal(req1.URL))
+					return &http.Response{Request: req}, nil
+				}
+				// ... after that, the connection timed out in the background
+				Expect(req.URL).To(Equal(req2.URL))
+				return nil, &qerr.IdleTimeoutError{}
+			}).Times(2)
+			cl2 := NewMockSingleRoundTripper(mockCtrl)
+			cl2.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{Request: req}, nil
+			})
+			clientChan <- cl1
+			clientChan <- cl2
+
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
+			var count int
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				count++
+				return conn, nil
+			}
+			rsp1, err := tr.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp1.Request.RemoteAddr).To(Equal(req1.RemoteAddr))
+			rsp2, err := tr.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp2.Request.RemoteAddr).To(Equal(req2.RemoteAddr))
+		})
+
+		Context("retrying requests with a body", func() {
+			// runRequests sends a request using the first client, and then sends a POST request.
+			// The connection times out in the background, so the POST request fails on the first client.
+			runRequests := func(post *http.Request, cl2 *MockSingleRoundTripper) (*http.Response, error) {
+				cl1 := NewMockSingleRoundTripper(mockCtrl)
+				cl1.EXPECT().RoundTrip(req1).Return(&http.Response{Request: req1}, nil)
+				cl1.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+					_, err := io.ReadAll(req.Body)
+					Expect(err).ToNot(HaveOccurred())
+					return nil, &qerr.IdleTimeoutError{}
+				})
+				clientChan <- cl1
+				if cl2 != nil {
+					clientChan <- cl2
+				}
+
+				conn := mockquic.NewMockEarlyConnection(mockCtrl)
+				conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+				handshakeChan := make(chan struct{})
+				close(handshakeChan)
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+				tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+					return conn, nil
+				}
+				_, err := tr.RoundTrip(req1)
+				Expect(err).ToNot(HaveOccurred())
+				return tr.RoundTrip(post)
+			}
+
+			It("uses GetBody to obtain a fresh body", func() {
+				post, err := http.NewRequest(http.MethodPost, "https://quic-go.net/upload", bytes.NewReader([]byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(post.GetBody).ToNot(BeNil())
+				cl2 := NewMockSingleRoundTripper(mockCtrl)
+				cl2.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+					data, err := io.ReadAll(req.Body)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(data).To(Equal([]byte("foobar")))
+					return &http.Response{Request: req}, nil
+				})
+				rsp, err := runRequests(post, cl2)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Request.URL).To(Equal(post.URL))
+			})
+
+			It("doesn't retry if GetBody is not set", func() {
+				post, err := http.NewRequest(http.MethodPost, "https://quic-go.net/upload", bytes.NewReader([]byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				post.GetBody = nil
+				_, err = runRequests(post, nil)
+				Expect(err).To(MatchError(errCannotRewindBody))
+				Expect(err).To(MatchError(&qerr.IdleTimeoutError{}))
+			})
+
+			It("returns errors from GetBody", func() {
+				post, err := http.NewRequest(http.MethodPost, "https://quic-go.net/upload", bytes.NewReader([]byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				testErr := errors.New("test error")
+				post.GetBody = func() (io.ReadCloser, error) { return nil, testErr }
+				_, err = runRequests(post, nil)
+				Expect(err).To(MatchError(testErr))
+			})
+		})
+
+		It("only issues a request once, even if a timeout error occurs", func() {
+			var count int
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				count++
+				return mockquic.NewMockEarlyConnection(mockCtrl), nil
+			}
+			tr.newClient = func(quic.EarlyConnection) singleRoundTripper {
+				cl := NewMockSingleRoundTripper(mockCtrl)
+				cl.EXPECT().RoundTrip(gomock.Any()).Return(nil, &qerr.IdleTimeoutError{})
+				return cl
+			}
+			_, err := tr.RoundTrip(req1)
+			Expect(err).To(MatchError(&qerr.IdleTimeoutError{}))
+			Expect(count).To(Equal(1))
+		})
+
+		It("handles a burst of requests", func() {
+			wait := make(chan struct{})
+			reqs := make(chan struct{}, 2)
+
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+				reqs <- struct{}{}
+				<-wait
+				return nil, &qerr.IdleTimeoutError{}
+			}).Times(2)
+			clientChan <- cl
+
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn.EXPECT().HandshakeComplete().Return(wait).AnyTimes()
+			var count int
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				count++
+				return conn, nil
+			}
+
+			done := make(chan struct{}, 2)
+			go func() {
+				defer GinkgoRecover()
+				defer func() { done <- struct{}{} }()
+				_, err := tr.RoundTrip(req1)
+				Expect(err).To(MatchError(&qerr.IdleTimeoutError{}))
+			}()
+			// wait for the first requests to be issued
+			Eventually(reqs).Should(Receive())
+			go func() {
+				defer GinkgoRecover()
+				defer func() { done <- struct{}{} }()
+				_, err := tr.RoundTrip(req2)
+				Expect(err).To(MatchError(&qerr.IdleTimeoutError{}))
+			}()
+			Eventually(reqs).Should(Receive())
+			close(wait) // now return the requests
+			Eventually(done).Should(Receive())
+			Eventually(done).Should(Receive())
+			Expect(count).To(Equal(1))
+		})
+
+		Context("connection coalescing", func() {
+			var (
+				conn       *mockquic.MockEarlyConnection
+				reqA, reqB *http.Request
+			)
+
+			BeforeEach(func() {
+				conn = mockquic.NewMockEarlyConnection(mockCtrl)
+				handshakeChan := make(chan struct{})
+				close(handshakeChan)
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+				conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{
+					TLS: tls.ConnectionState{
+						PeerCertificates: []*x509.Certificate{{DNSNames: []string{"*.quic-go.net"}}},
+					},
+				}).AnyTimes()
+				var err error
+				reqA, err = http.NewRequest("GET", "https://a.quic-go.net/file.html", nil)
+				Expect(err).ToNot(HaveOccurred())
+				reqB, err = http.NewRequest("GET", "https://b.quic-go.net/file.html", nil)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("reuses a connection if the certificate is valid for the authority", func() {
+				tr.EnableConnectionCoalescing = true
+				cl := NewMockSingleRoundTripper(mockCtrl)
+				clientChan <- cl
+				cl.EXPECT().RoundTrip(reqA).Return(&http.Response{Request: reqA}, nil)
+				cl.EXPECT().RoundTrip(reqB).Return(&http.Response{Request: reqB}, nil)
+				var dialed []string
+				tr.Dial = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					dialed = append(dialed, hostname)
+					return conn, nil
+				}
+				_, err := tr.RoundTrip(reqA)
+				Expect(err).ToNot(HaveOccurred())
+				rsp, err := tr.RoundTrip(reqB)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Request).To(Equal(reqB))
+				Expect(dialed).To(Equal([]string{"a.quic-go.net:443"}))
+			})
+
+			It("retries on a dedicated connection when the server responds with 421 on a coalesced connection", func() {
+				tr.EnableConnectionCoalescing = true
+				clA := NewMockSingleRoundTripper(mockCtrl)
+				clB := NewMockSingleRoundTripper(mockCtrl)
+				clientChan <- clA
+				clientChan <- clB
+				clA.EXPECT().RoundTrip(reqA).Return(&http.Response{Request: reqA}, nil)
+				clA.EXPECT().RoundTrip(reqB).Return(&http.Response{
+					StatusCode: http.StatusMisdirectedRequest,
+					Body:       io.NopCloser(&bytes.Buffer{}),
+					Request:    reqB,
+				}, nil)
+				clB.EXPECT().RoundTrip(reqB).Return(&http.Response{StatusCode: http.StatusOK, Request: reqB}, nil).Times(2)
+				var dialed []string
+				tr.Dial = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					dialed = append(dialed, hostname)
+					return conn, nil
+				}
+				_, err := tr.RoundTrip(reqA)
+				Expect(err).ToNot(HaveOccurred())
+				rsp, err := tr.RoundTrip(reqB)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+				Expect(dialed).To(Equal([]string{"a.quic-go.net:443", "b.quic-go.net:443"}))
+				// subsequent requests use the dedicated connection
+				rsp, err = tr.RoundTrip(reqB)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+				Expect(dialed).To(HaveLen(2))
+			})
+
+			It("doesn't retry 421 responses received on a dedicated connection", func() {
+				tr.EnableConnectionCoalescing = true
+				cl := NewMockSingleRoundTripper(mockCtrl)
+				clientChan <- cl
+				cl.EXPECT().RoundTrip(reqA).Return(&http.Response{StatusCode: http.StatusMisdirectedRequest, Request: reqA}, nil)
+				tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+					return conn, nil
+				}
+				rsp, err := tr.RoundTrip(reqA)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(http.StatusMisdirectedRequest))
+			})
+
+			It("doesn't reuse connections if coalescing is disabled", func() {
+				for i := 0; i < 2; i++ {
+					cl := NewMockSingleRoundTripper(mockCtrl)
+					cl.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{}, nil)
+					clientChan <- cl
+				}
+				var dialed []string
+				tr.Dial = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					dialed = append(dialed, hostname)
+					return conn, nil
+				}
+				_, err := tr.RoundTrip(reqA)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = tr.RoundTrip(reqB)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(dialed).To(Equal([]string{"a.quic-go.net:443", "b.quic-go.net:443"}))
+			})
+
+			It("doesn't reuse connections if the certificate isn't valid for the authority", func() {
+				tr.EnableConnectionCoalescing = true
+				for i := 0; i < 2; i++ {
+					cl := NewMockSingleRoundTripper(mockCtrl)
+					cl.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{}, nil)
+					clientChan <- cl
+				}
+				var dialed []string
+				tr.Dial = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					dialed = append(dialed, hostname)
+					return conn, nil
+				}
+				req, err := http.NewRequest("GET", "https://example.com/file.html", nil)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = tr.RoundTrip(reqA)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = tr.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(dialed).To(Equal([]string{"a.quic-go.net:443", "example.com:443"}))
+			})
+
+			It("doesn't reuse connections for a different port", func() {
+				tr.EnableConnectionCoalescing = true
+				for i := 0; i < 2; i++ {
+					cl := NewMockSingleRoundTripper(mockCtrl)
+					cl.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{}, nil)
+					clientChan <- cl
+				}
+				var dialed []string
+				tr.Dial = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					dialed = append(dialed, hostname)
+					return conn, nil
+				}
+				req, err := http.NewRequest("GET", "https://b.quic-go.net:8443/file.html", nil)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = tr.RoundTrip(reqA)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = tr.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(dialed).To(Equal([]string{"a.quic-go.net:443", "b.quic-go.net:8443"}))
+			})
+
+			It("doesn't reuse connections if VerifyConnection fails for the authority", func() {
+				tr.EnableConnectionCoalescing = true
+				var authorities []string
+				tr.VerifyConnection = func(authority string, _ tls.ConnectionState) error {
+					authorities = append(authorities, authority)
+					return errors.New("verification failed")
+				}
+				for i := 0; i < 2; i++ {
+					cl := NewMockSingleRoundTripper(mockCtrl)
+					cl.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{}, nil)
+					clientChan <- cl
+				}
+				var dialed []string
+				tr.Dial = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					dialed = append(dialed, hostname)
+					return conn, nil
+				}
+				_, err := tr.RoundTrip(reqA)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = tr.RoundTrip(reqB)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(authorities).To(Equal([]string{"b.quic-go.net:443"}))
+				Expect(dialed).To(Equal([]string{"a.quic-go.net:443", "b.quic-go.net:443"}))
+			})
+
+			It("doesn't hold the mutex while running VerifyConnection", func() {
+				tr.EnableConnectionCoalescing = true
+				conn.EXPECT().ConnectionStats().AnyTimes()
+				var numConns int
+				tr.VerifyConnection = func(string, tls.ConnectionState) error {
+					// calling into the Transport would deadlock if the mutex was held
+					numConns = len(tr.Connections())
+					return nil
+				}
+				cl := NewMockSingleRoundTripper(mockCtrl)
+				clientChan <- cl
+				cl.EXPECT().RoundTrip(reqA).Return(&http.Response{}, nil)
+				cl.EXPECT().RoundTrip(reqB).Return(&http.Response{}, nil)
+				var dialed []string
+				tr.Dial = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+					dialed = append(dialed, hostname)
+					return conn, nil
+				}
+				_, err := tr.RoundTrip(reqA)
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					_, err := tr.RoundTrip(reqB)
+					Expect(err).ToNot(HaveOccurred())
+				}()
+				Eventually(done).Should(BeClosed())
+				Expect(numConns).To(Equal(1))
+				Expect(dialed).To(Equal([]string{"a.quic-go.net:443"}))
+			})
+		})
+
+		It("disables compression for a single request", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				return conn, nil
+			}
+			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+				Expect(r.Context().Value(disableCompressionKey{})).To(BeTrue())
+				return &http.Response{}, nil
+			})
+			_, err := tr.RoundTripOpt(req1, RoundTripOpt{DisableCompression: true})
+			Expect(err).ToNot(HaveOccurred())
+			// the option only applies to a single request
+			cl.EXPECT().RoundTrip(req2).Return(&http.Response{}, nil)
+			_, err = tr.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(req2.Context().Value(disableCompressionKey{})).To(BeNil())
+		})
+
+		It("includes the time spent dialing in the Timings", func() {
+			clock := newFakeClock()
+			start := clock.Now()
+			tr.clock = clock
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				clock.Advance(time.Second)
+				return conn, nil
+			}
+			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+				b := &hijackableBody{info: responseInfo{timings: Timings{Start: clock.Now()}}}
+				return &http.Response{Body: b}, nil
+			})
+			rsp, err := tr.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			timings, ok := RequestTimings(rsp)
+			Expect(ok).To(BeTrue())
+			Expect(timings.Start).To(Equal(start))
 		})
 
-		It("reuses existing clients", func() {
+		It("sets the priority based on the deadline of the request context", func() {
 			cl := NewMockSingleRoundTripper(mockCtrl)
 			clientChan <- cl
 			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
 			handshakeChan := make(chan struct{})
 			close(handshakeChan)
-			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				return conn, nil
+			}
+			var priorities []string
+			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+				priorities = append(priorities, r.Header.Get("Priority"))
+				return &http.Response{}, nil
+			}).Times(4)
+			for _, timeout := range []time.Duration{0, time.Minute, time.Second, 50 * time.Millisecond} {
+				ctx := context.Background()
+				if timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, timeout)
+					defer cancel()
+				}
+				_, err := tr.RoundTripOpt(req1.WithContext(ctx), RoundTripOpt{DeadlineBasedPriority: true})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(priorities).To(Equal([]string{"", "", "u=2", "u=0"}))
+			Expect(req1.Header).ToNot(HaveKey("Priority"))
+		})
 
-			cl.EXPECT().RoundTrip(req1).Return(&http.Response{Request: req1}, nil)
-			cl.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
-			var count int
+		It("keeps the request stream open for a single request", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
 			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
-				count++
 				return conn, nil
 			}
-			rsp, err := tr.RoundTrip(req1)
+			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+				Expect(r.Context().Value(dontCloseRequestStreamKey{})).To(BeTrue())
+				return &http.Response{}, nil
+			})
+			_, err := tr.RoundTripOpt(req1, RoundTripOpt{DontCloseRequestStream: true})
 			Expect(err).ToNot(HaveOccurred())
-			Expect(rsp.Request).To(Equal(req1))
-			rsp, err = tr.RoundTrip(req2)
+			cl.EXPECT().RoundTrip(req2).Return(&http.Response{}, nil)
+			_, err = tr.RoundTrip(req2)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(rsp.Request).To(Equal(req2))
-			Expect(count).To(Equal(1))
+			Expect(req2.Context().Value(dontCloseRequestStreamKey{})).To(BeNil())
 		})
 
-		It("redials a connection if dialing failed", func() {
-			cl1 := NewMockSingleRoundTripper(mockCtrl)
-			clientChan <- cl1
-
-			req1, err := http.NewRequest("GET", "https://quic-go.net/foo.html", nil)
+		It("sets the wire tap for a single request", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				return conn, nil
+			}
+			var called bool
+			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+				o, ok := r.Context().Value(wireTapKey{}).(wireTapOpt)
+				Expect(ok).To(BeTrue())
+				Expect(o.includeData).To(BeTrue())
+				o.tap(WireOutbound, nil)
+				return &http.Response{}, nil
+			})
+			_, err := tr.RoundTripOpt(req1, RoundTripOpt{
+				WireTap:     func(WireDirection, []byte) { called = true },
+				WireTapData: true,
+			})
 			Expect(err).ToNot(HaveOccurred())
-			req2, err := http.NewRequest("GET", "https://quic-go.net/bar.html", nil)
+			Expect(called).To(BeTrue())
+			cl.EXPECT().RoundTrip(req2).Return(&http.Response{}, nil)
+			_, err = tr.RoundTrip(req2)
 			Expect(err).ToNot(HaveOccurred())
+			Expect(req2.Context().Value(wireTapKey{})).To(BeNil())
+		})
 
-			testErr := errors.New("handshake error")
+		It("sets the response header size limit for a single request", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
 			conn := mockquic.NewMockEarlyConnection(mockCtrl)
-			var count int
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
 			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
-				count++
-				if count == 1 {
-					return nil, testErr
-				}
 				return conn, nil
 			}
-			handshakeChan := make(chan struct{})
-			close(handshakeChan)
-			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
-			cl1.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
-			_, err = tr.RoundTrip(req1)
-			Expect(err).To(MatchError(testErr))
-			rsp, err := tr.RoundTrip(req2)
+			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+				Expect(r.Context().Value(maxResponseHeaderBytesKey{})).To(BeEquivalentTo(1 << 20))
+				return &http.Response{}, nil
+			})
+			_, err := tr.RoundTripOpt(req1, RoundTripOpt{MaxResponseHeaderBytes: 1 << 20})
+			Expect(err).ToNot(HaveOccurred())
+			cl.EXPECT().RoundTrip(req2).Return(&http.Response{}, nil)
+			_, err = tr.RoundTrip(req2)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(rsp.Request).To(Equal(req2))
-			Expect(count).To(Equal(2))
 		})
 
-		It("immediately removes a clients when a request errored", func() {
-			cl1 := NewMockSingleRoundTripper(mockCtrl)
-			clientChan <- cl1
-			cl2 := NewMockSingleRoundTripper(mockCtrl)
-			clientChan <- cl2
-
-			req1, err := http.NewRequest("GET", "https://quic-go.net/foobar.html", nil)
+		It("sets the SETTINGS timeout for a single request", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+				return conn, nil
+			}
+			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+				Expect(r.Context().Value(settingsTimeoutKey{})).To(Equal(time.Second))
+				return &http.Response{}, nil
+			})
+			_, err := tr.RoundTripOpt(req1, RoundTripOpt{SettingsTimeout: time.Second})
 			Expect(err).ToNot(HaveOccurred())
-			req2, err := http.NewRequest("GET", "https://quic-go.net/bar.html", nil)
+			cl.EXPECT().RoundTrip(req2).Return(&http.Response{}, nil)
+			_, err = tr.RoundTrip(req2)
 			Expect(err).ToNot(HaveOccurred())
+		})
 
+		It("synthesizes a 504 response on idle timeouts, if enabled", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
 			conn := mockquic.NewMockEarlyConnection(mockCtrl)
-			var count int
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
 			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
-				count++
 				return conn, nil
 			}
-			testErr := errors.New("test err")
-			handshakeChan := make(chan struct{})
-			close(handshakeChan)
-			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
-			cl1.EXPECT().RoundTrip(req1).Return(nil, testErr)
-			cl2.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
-			_, err = tr.RoundTrip(req1)
-			Expect(err).To(MatchError(testErr))
-			rsp, err := tr.RoundTrip(req2)
+			cl.EXPECT().RoundTrip(gomock.Any()).Return(nil, &ConnectionError{Err: &qerr.IdleTimeoutError{}})
+			rsp, err := tr.RoundTripOpt(req1, RoundTripOpt{SynthesizeErrorResponse: true})
 			Expect(err).ToNot(HaveOccurred())
-			Expect(rsp.Request).To(Equal(req2))
-			Expect(count).To(Equal(2))
+			Expect(rsp.StatusCode).To(Equal(http.StatusGatewayTimeout))
+			Expect(rsp.Request).To(Equal(req1))
 		})
 
-		It("does not remove a client when a request returns context canceled error", func() {
-			cl1 := NewMockSingleRoundTripper(mockCtrl)
-			clientChan <- cl1
-			cl2 := NewMockSingleRoundTripper(mockCtrl)
-			clientChan <- cl2
-
-			req1, err := http.NewRequest("GET", "https://quic-go.net/foobar.html", nil)
-			Expect(err).ToNot(HaveOccurred())
-			req2, err := http.NewRequest("GET", "https://quic-go.net/bar.html", nil)
-			Expect(err).ToNot(HaveOccurred())
-
+		It("doesn't synthesize responses for protocol errors", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
 			conn := mockquic.NewMockEarlyConnection(mockCtrl)
-			var count int
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
 			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
-				count++
 				return conn, nil
 			}
-			testErr := context.Canceled
-			handshakeChan := make(chan struct{})
-			close(handshakeChan)
-			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
-			cl1.EXPECT().RoundTrip(req1).Return(nil, testErr)
-			cl1.EXPECT().RoundTrip(req2).Return(&http.Response{Request: req2}, nil)
-			_, err = tr.RoundTrip(req1)
+			testErr := &Error{ErrorCode: ErrCodeFrameUnexpected, Remote: true}
+			cl.EXPECT().RoundTrip(gomock.Any()).Return(nil, testErr)
+			_, err := tr.RoundTripOpt(req1, RoundTripOpt{SynthesizeErrorResponse: true})
 			Expect(err).To(MatchError(testErr))
-			rsp, err := tr.RoundTrip(req2)
-			Expect(err).ToNot(HaveOccurred())
-			Expect(rsp.Request).To(Equal(req2))
-			Expect(count).To(Equal(1))
 		})
 
-		It("recreates a client when a request times out", func() {
-			var reqCount int
-			cl1 := NewMockSingleRoundTripper(mockCtrl)
-			cl1.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
-				reqCount++
-				if reqCount == 1 { // the first request is successful...
-					Expect(req.URL).To(Equal(req1.URL))
-					return &http.Response{Request: req}, nil
-				}
-				// ... after that, the connection timed out in the background
-				Expect(req.URL).To(Equal(req2.URL))
-				return nil, &qerr.IdleTimeoutError{}
-			}).Times(2)
-			cl2 := NewMockSingleRoundTripper(mockCtrl)
-			cl2.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
-				return &http.Response{Request: req}, nil
-			})
-			clientChan <- cl1
-			clientChan <- cl2
-
+		It("keeps the client when the stream limit is reached", func() {
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
 			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
 			handshakeChan := make(chan struct{})
 			close(handshakeChan)
-			conn.EXPECT().HandshakeComplete().Return(handshakeChan).MaxTimes(2)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
 			var count int
 			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
 				count++
 				return conn, nil
 			}
-			rsp1, err := tr.RoundTrip(req1)
-			Expect(err).ToNot(HaveOccurred())
-			Expect(rsp1.Request.RemoteAddr).To(Equal(req1.RemoteAddr))
-			rsp2, err := tr.RoundTrip(req2)
+			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+				Expect(r.Context().Value(maxStreamWaitKey{})).To(Equal(time.Second))
+				return nil, ErrStreamLimitReached
+			})
+			_, err := tr.RoundTripOpt(req1, RoundTripOpt{MaxStreamWait: time.Second})
+			Expect(err).To(MatchError(ErrStreamLimitReached))
+			cl.EXPECT().RoundTrip(req2).Return(&http.Response{}, nil)
+			_, err = tr.RoundTrip(req2)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(rsp2.Request.RemoteAddr).To(Equal(req2.RemoteAddr))
+			Expect(count).To(Equal(1))
 		})
 
-		It("only issues a request once, even if a timeout error occurs", func() {
-			var count int
+		It("lists the connections", func() {
+			Expect(tr.Connections()).To(BeEmpty())
+			cl := NewMockSingleRoundTripper(mockCtrl)
+			clientChan <- cl
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			conn.EXPECT().ConnectionState().Return(quic.ConnectionState{Used0RTT: true}).AnyTimes()
+			conn.EXPECT().ConnectionStats().Return(quic.ConnectionStats{SmoothedRTT: 42 * time.Millisecond}).AnyTimes()
 			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
-				count++
-				return mockquic.NewMockEarlyConnection(mockCtrl), nil
-			}
-			tr.newClient = func(quic.EarlyConnection) singleRoundTripper {
-				cl := NewMockSingleRoundTripper(mockCtrl)
-				cl.EXPECT().RoundTrip(gomock.Any()).Return(nil, &qerr.IdleTimeoutError{})
-				return cl
+				return conn, nil
 			}
-			_, err := tr.RoundTrip(req1)
-			Expect(err).To(MatchError(&qerr.IdleTimeoutError{}))
-			Expect(count).To(Equal(1))
+			inRoundTrip := make(chan struct{})
+			done := make(chan struct{})
+			cl.EXPECT().RoundTrip(req1).DoAndReturn(func(*http.Request) (*http.Response, error) {
+				close(inRoundTrip)
+				<-done
+				return &http.Response{}, nil
+			})
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := tr.RoundTrip(req1)
+				errChan <- err
+			}()
+			Eventually(inRoundTrip).Should(BeClosed())
+			Expect(tr.Connections()).To(Equal([]ConnInfo{{
+				Authority:      "quic-go.net:443",
+				ActiveRequests: 1,
+				Used0RTT:       true,
+				Stats:          quic.ConnectionStats{SmoothedRTT: 42 * time.Millisecond},
+			}}))
+			close(done)
+			Eventually(errChan).Should(Receive(BeNil()))
+			conns := tr.Connections()
+			Expect(conns).To(HaveLen(1))
+			Expect(conns[0].ActiveRequests).To(BeZero())
 		})
 
-		It("handles a burst of requests", func() {
-			wait := make(chan struct{})
-			reqs := make(chan struct{}, 2)
-
+		It("keeps the client when a non-blocking stream open fails", func() {
 			cl := NewMockSingleRoundTripper(mockCtrl)
-			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
-				reqs <- struct{}{}
-				<-wait
-				return nil, &qerr.IdleTimeoutError{}
-			}).Times(2)
 			clientChan <- cl
-
 			conn := mockquic.NewMockEarlyConnection(mockCtrl)
-			conn.EXPECT().HandshakeComplete().Return(wait).AnyTimes()
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
 			var count int
 			tr.Dial = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
 				count++
 				return conn, nil
 			}
-
-			done := make(chan struct{}, 2)
-			go func() {
-				defer GinkgoRecover()
-				defer func() { done <- struct{}{} }()
-				_, err := tr.RoundTrip(req1)
-				Expect(err).To(MatchError(&qerr.IdleTimeoutError{}))
-			}()
-			// wait for the first requests to be issued
-			Eventually(reqs).Should(Receive())
-			go func() {
-				defer GinkgoRecover()
-				defer func() { done <- struct{}{} }()
-				_, err := tr.RoundTrip(req2)
-				Expect(err).To(MatchError(&qerr.IdleTimeoutError{}))
-			}()
-			Eventually(reqs).Should(Receive())
-			close(wait) // now return the requests
-			Eventually(done).Should(Receive())
-			Eventually(done).Should(Receive())
+			cl.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+				Expect(r.Context().Value(nonBlockingStreamOpenKey{})).To(BeTrue())
+				return nil, ErrStreamLimitReached
+			})
+			_, err := tr.RoundTripOpt(req1, RoundTripOpt{NonBlockingStreamOpen: true})
+			Expect(err).To(MatchError(ErrStreamLimitReached))
+			cl.EXPECT().RoundTrip(req2).Return(&http.Response{}, nil)
+			_, err = tr.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
 			Expect(count).To(Equal(1))
 		})
 
@@ -546,6 +1741,67 @@ var _ = Describe("Transport", func() {
 			Expect(tr.Close()).To(Succeed())
 		})
 
+		It("shuts down gracefully", func() {
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			cl := &shutdownableRoundTripper{
+				MockSingleRoundTripper: NewMockSingleRoundTripper(mockCtrl),
+				shutdown:               make(chan struct{}),
+				done:                   make(chan struct{}),
+			}
+			cl.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{}, nil)
+			tr := &Transport{
+				Dial: func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+					return conn, nil
+				},
+				newClient: func(quic.EarlyConnection) singleRoundTripper { return cl },
+			}
+			req, err := http.NewRequest("GET", "https://quic-go.net/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = tr.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+
+			errChan := make(chan error, 1)
+			go func() { errChan <- tr.Shutdown(context.Background()) }()
+			Eventually(cl.shutdown).Should(BeClosed())
+			// Shutdown waits for in-flight requests to complete
+			Consistently(errChan, scaleDuration(20*time.Millisecond)).ShouldNot(Receive())
+			close(cl.done)
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+
+		It("closes the connections when the context is canceled during a graceful shutdown", func() {
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			handshakeChan := make(chan struct{})
+			close(handshakeChan)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			cl := &shutdownableRoundTripper{
+				MockSingleRoundTripper: NewMockSingleRoundTripper(mockCtrl),
+				shutdown:               make(chan struct{}),
+				done:                   make(chan struct{}),
+			}
+			cl.EXPECT().RoundTrip(gomock.Any()).Return(&http.Response{}, nil)
+			tr := &Transport{
+				Dial: func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+					return conn, nil
+				},
+				newClient: func(quic.EarlyConnection) singleRoundTripper { return cl },
+			}
+			req, err := http.NewRequest("GET", "https://quic-go.net/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = tr.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+
+			ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(10*time.Millisecond))
+			defer cancel()
+			Expect(tr.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+			Expect(cl.shutdown).To(BeClosed())
+		})
+
 		It("closes while dialing", func() {
 			tr := &Transport{
 				Dial: func(ctx context.Context, _ string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
@@ -631,3 +1887,21 @@ var _ = Describe("Transport", func() {
 		})
 	})
 })
+
+// shutdownableRoundTripper is a singleRoundTripper that can be shut down, like the ClientConn.
+// Shutdown blocks until done is closed, or the context is canceled.
+type shutdownableRoundTripper struct {
+	*MockSingleRoundTripper
+	shutdown chan struct{}
+	done     chan struct{}
+}
+
+func (r *shutdownableRoundTripper) Shutdown(ctx context.Context) error {
+	close(r.shutdown)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,76 @@
+package http3
+
+import (
+	"bytes"
+	"io"
+)
+
+// WireDirection is the direction of the bytes passed to a WireTap.
+type WireDirection uint8
+
+const (
+	// WireOutbound is used for bytes sent on the request stream.
+	WireOutbound WireDirection = iota + 1
+	// WireInbound is used for bytes received on the request stream.
+	WireInbound
+)
+
+func (d WireDirection) String() string {
+	switch d {
+	case WireOutbound:
+		return "outbound"
+	case WireInbound:
+		return "inbound"
+	default:
+		return "unknown direction"
+	}
+}
+
+// A WireTap receives copies of the raw HTTP/3 frames sent and received on a request stream,
+// see RoundTripOpt.WireTap.
+// HEADERS frames (the request header, the response header, including informational responses,
+// and the trailers) are always passed in a single call, including the frame type and length.
+// Outbound DATA frames are passed in a single call as well. Inbound DATA frames are passed in the chunks
+// in which the response body is read: first the frame type and length, then the payload.
+// Concatenating all bytes passed for one direction therefore yields the frames on the wire.
+// The slice is owned by the WireTap.
+// The WireTap is called synchronously, it must not block.
+type WireTap func(dir WireDirection, b []byte)
+
+// wireTapKey is the context key used to set a WireTap for a single request.
+type wireTapKey struct{}
+
+type wireTapOpt struct {
+	tap         WireTap
+	includeData bool
+}
+
+func (s *stream) tapEnabled() bool { return s.wireTap != nil }
+
+func (s *stream) tapDataEnabled() bool { return s.wireTap != nil && s.wireTapData }
+
+// tapFrame passes a copy of b to the WireTap.
+func (s *stream) tapFrame(dir WireDirection, b []byte) {
+	s.wireTap(dir, bytes.Clone(b))
+}
+
+// tapHeadersFrame returns a reader for the payload of an inbound HEADERS frame.
+// Once the payload has been read, the returned function passes the complete frame to the WireTap.
+func (s *stream) tapHeadersFrame(r io.Reader, length uint64) (io.Reader, func()) {
+	if !s.tapEnabled() {
+		return r, func() {}
+	}
+	buf := bytes.NewBuffer((&headersFrame{Length: length}).Append(nil))
+	return io.TeeReader(r, buf), func() { s.wireTap(WireInbound, buf.Bytes()) }
+}
+
+// wireTapWriter passes every Write to the WireTap, before writing it to the stream.
+// It is used to capture the request header, which is written using a single Write call.
+type wireTapWriter struct {
+	*stream
+}
+
+func (w *wireTapWriter) Write(b []byte) (int, error) {
+	w.tapFrame(WireOutbound, b)
+	return w.stream.Stream.Write(b)
+}
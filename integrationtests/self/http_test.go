@@ -17,6 +17,8 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -25,6 +27,7 @@ import (
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 	quicproxy "github.com/quic-go/quic-go/integrationtests/tools/proxy"
+	"github.com/quic-go/quic-go/quicvarint"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -91,9 +94,10 @@ var _ = Describe("HTTP tests", func() {
 		})
 
 		server = &http3.Server{
-			Handler:    mux,
-			TLSConfig:  getTLSConfig(),
-			QUICConfig: getQuicConfig(&quic.Config{Allow0RTT: true, EnableDatagrams: true}),
+			Handler:         mux,
+			TLSConfig:       getTLSConfig(),
+			QUICConfig:      getQuicConfig(&quic.Config{Allow0RTT: true, EnableDatagrams: true}),
+			EnableDatagrams: true,
 		}
 
 		addr, err := net.ResolveUDPAddr("udp", "0.0.0.0:0")
@@ -135,9 +139,53 @@ var _ = Describe("HTTP tests", func() {
 
 		time.Sleep(150 * time.Millisecond)
 
+		// the server closed the connection, so the client dials a new one
 		_, err = client.Get(fmt.Sprintf("https://localhost:%d/hello", port))
-		Expect(err).ToNot(MatchError("idle timeout"))
-		server.IdleTimeout = 0
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("sends requests for different authorities on a coalesced connection", func() {
+		mux.HandleFunc("/authority", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Host))
+		})
+		var dials int
+		tr.EnableConnectionCoalescing = true
+		tr.Dial = func(ctx context.Context, addr string, tlsConf *tls.Config, conf *quic.Config) (quic.EarlyConnection, error) {
+			dials++
+			return quic.DialAddrEarly(ctx, addr, tlsConf, conf)
+		}
+		// the certificate is valid for both localhost and 127.0.0.1
+		for _, host := range []string{"localhost", "127.0.0.1"} {
+			authority := fmt.Sprintf("%s:%d", host, port)
+			resp, err := client.Get(fmt.Sprintf("https://%s/authority", authority))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			// the :authority of the request is used, not the one the connection was dialed for
+			Expect(string(body)).To(Equal(authority))
+		}
+		Expect(dials).To(Equal(1))
+	})
+
+	It("synthesizes a 504 response when the server doesn't respond", func() {
+		// this UDP socket never responds to any packets
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		tr.QUICConfig.HandshakeIdleTimeout = scaleDuration(50 * time.Millisecond)
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/hello", conn.LocalAddr().(*net.UDPAddr).Port), nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = tr.RoundTripOpt(req, http3.RoundTripOpt{})
+		Expect(err).To(HaveOccurred())
+		var nerr net.Error
+		Expect(errors.As(err, &nerr)).To(BeTrue())
+		Expect(nerr.Timeout()).To(BeTrue())
+
+		resp, err := tr.RoundTripOpt(req, http3.RoundTripOpt{SynthesizeErrorResponse: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusGatewayTimeout))
 	})
 
 	It("downloads a hello", func() {
@@ -149,6 +197,23 @@ var _ = Describe("HTTP tests", func() {
 		Expect(string(body)).To(Equal("Hello, World!\n"))
 	})
 
+	It("records the request timings", func() {
+		resp, err := client.Get(fmt.Sprintf("https://localhost:%d/hello", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		_, err = io.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		timings, ok := http3.RequestTimings(resp)
+		Expect(ok).To(BeTrue())
+		Expect(timings.Start).ToNot(BeZero())
+		Expect(timings.ConnReady).To(BeTemporally(">=", timings.Start))
+		Expect(timings.FirstResponseByte).To(BeTemporally(">=", timings.ConnReady))
+		Expect(timings.Headers).To(BeTemporally(">=", timings.FirstResponseByte))
+		Expect(timings.BodyDone).To(BeTemporally(">=", timings.Headers))
+		Expect(timings.TimeToFirstByte()).To(BeNumerically(">", 0))
+		Expect(timings.TimeToHeaders()).To(BeNumerically(">=", timings.TimeToFirstByte()))
+	})
+
 	It("sets content-length for small response", func() {
 		mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
 			defer GinkgoRecover()
@@ -185,6 +250,63 @@ var _ = Describe("HTTP tests", func() {
 		Expect(resp.StatusCode).To(Equal(http.StatusOK))
 	})
 
+	It("warms up a connection", func() {
+		var dialCounter atomic.Int32
+		tr := &http3.Transport{
+			TLSClientConfig: getTLSClientConfig(),
+			Dial: func(ctx context.Context, addr string, tlsConf *tls.Config, conf *quic.Config) (quic.EarlyConnection, error) {
+				dialCounter.Add(1)
+				return quic.DialAddrEarly(ctx, addr, tlsConf, conf)
+			},
+		}
+		defer tr.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		Expect(tr.Warmup(ctx, fmt.Sprintf("localhost:%d", port))).To(Succeed())
+		Expect(dialCounter.Load()).To(BeEquivalentTo(1))
+		Expect(tr.Connections()).To(HaveLen(1))
+
+		cl := http.Client{Transport: tr}
+		resp, err := cl.Get(fmt.Sprintf("https://localhost:%d/hello", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(dialCounter.Load()).To(BeEquivalentTo(1))
+		Expect(tr.Connections()).To(HaveLen(1))
+	})
+
+	It("binds connections to the local address of the request", func() {
+		mux.HandleFunc("/remote-addr", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			w.Write([]byte(r.RemoteAddr))
+		})
+		tr := &http3.Transport{
+			TLSClientConfig: getTLSClientConfig(),
+			QUICConfig:      getQuicConfig(nil),
+		}
+		defer tr.Close()
+		getRemoteAddr := func(localIP net.IP) *net.UDPAddr {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/remote-addr", port), nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := tr.RoundTripOpt(req, http3.RoundTripOpt{LocalAddr: &net.UDPAddr{IP: localIP}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+			body, err := io.ReadAll(gbytes.TimeoutReader(rsp.Body, 3*time.Second))
+			Expect(err).ToNot(HaveOccurred())
+			addr, err := net.ResolveUDPAddr("udp", string(body))
+			Expect(err).ToNot(HaveOccurred())
+			return addr
+		}
+
+		addr1 := getRemoteAddr(net.IPv4(127, 0, 0, 1))
+		Expect(addr1.IP.Equal(net.IPv4(127, 0, 0, 1))).To(BeTrue())
+		addr2 := getRemoteAddr(net.IPv4(127, 0, 0, 2))
+		Expect(addr2.IP.Equal(net.IPv4(127, 0, 0, 2))).To(BeTrue())
+		Expect(tr.Connections()).To(HaveLen(2))
+		// requests from the same local address reuse the connection
+		Expect(getRemoteAddr(net.IPv4(127, 0, 0, 2))).To(Equal(addr2))
+		Expect(tr.Connections()).To(HaveLen(2))
+	})
+
 	It("detects stream errors when server panics when writing response", func() {
 		respChan := make(chan struct{})
 		mux.HandleFunc("/writing_and_panicking", func(w http.ResponseWriter, r *http.Request) {
@@ -205,6 +327,35 @@ var _ = Describe("HTTP tests", func() {
 		Expect(bytes.HasPrefix([]byte("foobar"), body)).To(BeTrue())
 	})
 
+	It("resumes truncated downloads", func() {
+		data := GeneratePRData(100 << 10)
+		respChan := make(chan struct{})
+		var requests atomic.Int32
+		mux.HandleFunc("/resumable", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			if requests.Add(1) == 1 {
+				// send the first half of the body, then abort the stream
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				w.Write(data[:len(data)/2])
+				w.(http.Flusher).Flush()
+				<-respChan
+				panic(http.ErrAbortHandler)
+			}
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		})
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/resumable", port), nil)
+		Expect(err).ToNot(HaveOccurred())
+		rsp, err := tr.RoundTripOpt(req, http3.RoundTripOpt{ResumeDownloads: true})
+		close(respChan)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		body, err := io.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(Equal(data))
+		Expect(requests.Load()).To(BeEquivalentTo(2))
+	})
+
 	It("requests to different servers with the same udpconn", func() {
 		resp, err := client.Get(fmt.Sprintf("https://localhost:%d/remoteAddr", port))
 		Expect(err).ToNot(HaveOccurred())
@@ -219,6 +370,126 @@ var _ = Describe("HTTP tests", func() {
 		Expect(addr1).To(Equal(addr2))
 	})
 
+	It("dials using the provided quic.Transport", func() {
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		qtr := &quic.Transport{Conn: udpConn}
+		defer qtr.Close()
+
+		newTransport := func() *http3.Transport {
+			return &http3.Transport{
+				TLSClientConfig:    getTLSClientConfigWithoutServerName(),
+				QUICConfig:         getQuicConfig(&quic.Config{MaxIdleTimeout: 10 * time.Second}),
+				QUICTransport:      qtr,
+				DisableCompression: true,
+			}
+		}
+		tr1 := newTransport()
+		tr2 := newTransport()
+		for _, tr := range []*http3.Transport{tr1, tr2} {
+			resp, err := (&http.Client{Transport: tr}).Get(fmt.Sprintf("https://localhost:%d/remoteAddr", port))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(resp.Header.Get("X-RemoteAddr")).To(Equal(udpConn.LocalAddr().String()))
+		}
+		// closing the Transport doesn't close the quic.Transport
+		Expect(tr1.Close()).To(Succeed())
+		resp, err := (&http.Client{Transport: tr2}).Get(fmt.Sprintf("https://localhost:%d/hello", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(tr2.Close()).To(Succeed())
+	})
+
+	It("calls the VerifyConnection callback during the handshake", func() {
+		authorities := make(chan string, 1)
+		tr := &http3.Transport{
+			TLSClientConfig:    getTLSClientConfigWithoutServerName(),
+			QUICConfig:         getQuicConfig(nil),
+			DisableCompression: true,
+			VerifyConnection: func(authority string, cs tls.ConnectionState) error {
+				authorities <- authority
+				if cs.ServerName != "localhost" {
+					return fmt.Errorf("unexpected server name: %s", cs.ServerName)
+				}
+				return errors.New("untrusted server")
+			},
+		}
+		defer tr.Close()
+
+		_, err := (&http.Client{Transport: tr}).Get(fmt.Sprintf("https://localhost:%d/hello", port))
+		Expect(err).To(MatchError(ContainSubstring("untrusted server")))
+		Expect(authorities).To(Receive(Equal(fmt.Sprintf("localhost:%d", port))))
+	})
+
+	It("presents the client certificate returned by GetClientCertificate", func() {
+		tlsConf := getTLSConfig()
+		tlsConf.ClientAuth = tls.RequireAnyClientCert
+		server := &http3.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(r.TLS.PeerCertificates[0].Raw)
+			}),
+			TLSConfig:  tlsConf,
+			QUICConfig: getQuicConfig(nil),
+		}
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer udpConn.Close()
+		go server.Serve(udpConn)
+		defer server.Close()
+
+		authorities := make(chan string, 1)
+		clientCert := &tlsConf.Certificates[0]
+		tr := &http3.Transport{
+			TLSClientConfig: getTLSClientConfigWithoutServerName(),
+			QUICConfig:      getQuicConfig(nil),
+			GetClientCertificate: func(authority string, _ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				authorities <- authority
+				return clientCert, nil
+			},
+		}
+		defer tr.Close()
+
+		addr := fmt.Sprintf("localhost:%d", udpConn.LocalAddr().(*net.UDPAddr).Port)
+		rsp, err := (&http.Client{Transport: tr}).Get("https://" + addr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		body, err := io.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(Equal(clientCert.Certificate[0]))
+		Expect(authorities).To(Receive(Equal(addr)))
+	})
+
+	It("calls OnConnectionClosed when the server closes the connection", func() {
+		mux.HandleFunc("/close", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			w.(http3.Hijacker).Connection().CloseWithError(0x1337, "closing")
+		})
+
+		type closeEvent struct {
+			addr string
+			err  error
+		}
+		closed := make(chan closeEvent, 2)
+		tr.OnConnectionClosed = func(addr string, err error) { closed <- closeEvent{addr: addr, err: err} }
+		// Depending on timing, the connection might be closed before the response is received.
+		if resp, err := client.Get(fmt.Sprintf("https://localhost:%d/close", port)); err == nil {
+			Expect(resp.StatusCode).To(Equal(200))
+			resp.Body.Close()
+		}
+
+		var ev closeEvent
+		Eventually(closed).Should(Receive(&ev))
+		Expect(ev.addr).To(Equal(fmt.Sprintf("localhost:%d", port)))
+		var appErr *quic.ApplicationError
+		Expect(errors.As(ev.err, &appErr)).To(BeTrue())
+		Expect(appErr.Remote).To(BeTrue())
+		Expect(appErr.ErrorCode).To(BeEquivalentTo(0x1337))
+		Expect(appErr.ErrorMessage).To(Equal("closing"))
+		Consistently(closed).ShouldNot(Receive())
+	})
+
 	It("downloads concurrently", func() {
 		group, ctx := errgroup.WithContext(context.Background())
 		for i := 0; i < 2; i++ {
@@ -241,6 +512,35 @@ var _ = Describe("HTTP tests", func() {
 		Expect(err).ToNot(HaveOccurred())
 	})
 
+	It("decodes the headers of many concurrent responses", func() {
+		mux.HandleFunc("/concurrent/", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			w.Header().Set("X-Index", strings.TrimPrefix(r.URL.Path, "/concurrent/"))
+			w.Header().Set("Trailer", "X-Trailer")
+			w.Write([]byte("foobar"))
+			w.Header().Set("X-Trailer", r.URL.Path)
+		})
+
+		group, ctx := errgroup.WithContext(context.Background())
+		for i := 0; i < 50; i++ {
+			group.Go(func() error {
+				defer GinkgoRecover()
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://localhost:%d/concurrent/%d", port, i), nil)
+				Expect(err).ToNot(HaveOccurred())
+				resp, err := client.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Header.Get("X-Index")).To(Equal(strconv.Itoa(i)))
+				body, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("foobar"))
+				Expect(resp.Trailer.Get("X-Trailer")).To(Equal(fmt.Sprintf("/concurrent/%d", i)))
+				return nil
+			})
+		}
+		Expect(group.Wait()).To(Succeed())
+	})
+
 	It("sets and gets request headers", func() {
 		handlerCalled := make(chan struct{})
 		mux.HandleFunc("/headers/request", func(w http.ResponseWriter, r *http.Request) {
@@ -260,6 +560,93 @@ var _ = Describe("HTTP tests", func() {
 		Eventually(handlerCalled).Should(BeClosed())
 	})
 
+	It("modifies request headers right before sending the request", func() {
+		mux.HandleFunc("/headers/modified", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Header.Get("X-Signature")))
+		})
+
+		var count int
+		tr.ModifyRequest = func(r *http.Request) error {
+			count++
+			r.Header.Set("X-Signature", fmt.Sprintf("signature-%d", count))
+			return nil
+		}
+		for i := 1; i <= 2; i++ {
+			resp, err := client.Get(fmt.Sprintf("https://localhost:%d/headers/modified", port))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(200))
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal(fmt.Sprintf("signature-%d", i)))
+		}
+	})
+
+	It("retries requests with a refreshed token from an interceptor", func() {
+		mux.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			body, err := io.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			if r.Header.Get("Authorization") != "Bearer valid" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write(body)
+		})
+
+		var attempts atomic.Int32
+		tr.Interceptor = func(next http3.RoundTripFunc) http3.RoundTripFunc {
+			token := "expired"
+			return func(r *http.Request) (*http.Response, error) {
+				r.Header.Set("Authorization", "Bearer "+token)
+				attempts.Add(1)
+				rsp, err := next(r)
+				if err != nil || rsp.StatusCode != http.StatusUnauthorized {
+					return rsp, err
+				}
+				rsp.Body.Close()
+				token = "valid"
+				if r.GetBody != nil {
+					if r.Body, err = r.GetBody(); err != nil {
+						return nil, err
+					}
+				}
+				r.Header.Set("Authorization", "Bearer "+token)
+				attempts.Add(1)
+				return next(r)
+			}
+		}
+		resp, err := client.Post(fmt.Sprintf("https://localhost:%d/auth", port), "text/plain", strings.NewReader("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		body, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("foobar"))
+		Expect(attempts.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("sends the TE: trailers header field", func() {
+		mux.HandleFunc("/headers/te", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Header.Get("Te")))
+		})
+
+		for _, te := range []string{"trailers", "gzip, trailers", "gzip"} {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/headers/te", port), nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("TE", te)
+			resp, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(200))
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			if te == "gzip" {
+				// TE values other than trailers are removed
+				Expect(string(body)).To(BeEmpty())
+			} else {
+				Expect(string(body)).To(Equal("trailers"))
+			}
+		}
+	})
+
 	It("sets and gets response headers", func() {
 		mux.HandleFunc("/headers/response", func(w http.ResponseWriter, r *http.Request) {
 			defer GinkgoRecover()
@@ -343,6 +730,66 @@ var _ = Describe("HTTP tests", func() {
 		Expect(body).To(Equal(PRData))
 	})
 
+	It("aborts uploads", func() {
+		errChan := make(chan error, 1)
+		mux.HandleFunc("/abort-upload", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			data, err := io.ReadAll(r.Body)
+			Expect(data).To(Equal([]byte("foobar")))
+			errChan <- err
+		})
+
+		pr, pw := io.Pipe()
+		go func() {
+			defer GinkgoRecover()
+			_, err := pw.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			time.Sleep(scaleDuration(10 * time.Millisecond))
+			pw.CloseWithError(&http3.Error{ErrorCode: http3.ErrCodeRequestIncomplete})
+		}()
+		// The handler doesn't send a response, so the request might fail.
+		client.Post(fmt.Sprintf("https://localhost:%d/abort-upload", port), "text/plain", pr)
+
+		var err error
+		Eventually(errChan).Should(Receive(&err))
+		var h3Err *http3.Error
+		Expect(errors.As(err, &h3Err)).To(BeTrue())
+		Expect(h3Err.Remote).To(BeTrue())
+		Expect(h3Err.ErrorCode).To(Equal(http3.ErrCodeRequestIncomplete))
+	})
+
+	It("aborts uploads using the ResponseController", func() {
+		errChan := make(chan error, 1)
+		mux.HandleFunc("/abort-upload-controller", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			_, err := io.ReadAll(r.Body)
+			errChan <- err
+		})
+
+		pr, pw := io.Pipe()
+		defer pw.Close()
+		go func() {
+			defer GinkgoRecover()
+			_, err := pw.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+		}()
+		rsp, err := client.Post(fmt.Sprintf("https://localhost:%d/abort-upload-controller", port), "text/plain", pr)
+		Expect(err).ToNot(HaveOccurred())
+		defer rsp.Body.Close()
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		Expect(http3.NewResponseController(rsp).Abort(http3.ErrCodeRequestIncomplete)).To(Succeed())
+
+		Eventually(errChan).Should(Receive(&err))
+		var h3Err *http3.Error
+		Expect(errors.As(err, &h3Err)).To(BeTrue())
+		Expect(h3Err.Remote).To(BeTrue())
+		Expect(h3Err.ErrorCode).To(Equal(http3.ErrCodeRequestIncomplete))
+		_, err = rsp.Body.Read([]byte{0})
+		Expect(err).To(HaveOccurred())
+	})
+
 	It("uses gzip compression", func() {
 		mux.HandleFunc("/gzipped/hello", func(w http.ResponseWriter, r *http.Request) {
 			defer GinkgoRecover()
@@ -366,6 +813,76 @@ var _ = Describe("HTTP tests", func() {
 		Expect(string(body)).To(Equal("Hello, World!\n"))
 	})
 
+	It("disables compression for a single request", func() {
+		mux.HandleFunc("/gzipped/optional", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Accept-Encoding") != "gzip" {
+				w.Write([]byte("Hello, World!\n"))
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			gw := gzip.NewWriter(w)
+			defer gw.Close()
+			gw.Write([]byte("Hello, World!\n"))
+		})
+
+		tr.DisableCompression = false
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/gzipped/optional", port), nil)
+		Expect(err).ToNot(HaveOccurred())
+		resp, err := tr.RoundTripOpt(req, http3.RoundTripOpt{DisableCompression: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(resp.Uncompressed).To(BeFalse())
+		body, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("Hello, World!\n"))
+
+		// other requests still use compression
+		resp, err = client.Get(fmt.Sprintf("https://localhost:%d/gzipped/optional", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(resp.Uncompressed).To(BeTrue())
+		body, err = io.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("Hello, World!\n"))
+	})
+
+	It("frames length-prefixed messages using a buffered response body", func() {
+		msgs := []string{"foo", "foobar", strings.Repeat("a", 200), ""}
+		mux.HandleFunc("/framed", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			for _, m := range msgs {
+				b := binary.BigEndian.AppendUint16(nil, uint16(len(m)))
+				w.Write(append(b, m...))
+				w.(http.Flusher).Flush()
+			}
+		})
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/framed", port), nil)
+		Expect(err).ToNot(HaveOccurred())
+		resp, err := tr.RoundTripOpt(req, http3.RoundTripOpt{BufferedBodySize: 1024})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		body, ok := resp.Body.(*http3.BufferedBody)
+		Expect(ok).To(BeTrue())
+		Expect(body.SetReadDeadline(time.Now().Add(3 * time.Second))).To(Succeed())
+		var received []string
+		for {
+			prefix, err := body.Peek(2)
+			if err == io.EOF {
+				break
+			}
+			Expect(err).ToNot(HaveOccurred())
+			l := 2 + int(binary.BigEndian.Uint16(prefix))
+			msg, err := body.Peek(l)
+			Expect(err).ToNot(HaveOccurred())
+			received = append(received, string(msg[2:]))
+			_, err = body.Discard(l)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(received).To(Equal(msgs))
+		Expect(body.Close()).To(Succeed())
+	})
+
 	It("handles context cancellations", func() {
 		mux.HandleFunc("/cancel", func(w http.ResponseWriter, r *http.Request) {
 			<-r.Context().Done()
@@ -381,6 +898,29 @@ var _ = Describe("HTTP tests", func() {
 		Expect(err).To(MatchError(context.Canceled))
 	})
 
+	It("aborts slow reads when the deadline of the request context is reached", func() {
+		mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		})
+
+		timeout := scaleDuration(100 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://localhost:%d/slow", port), nil)
+		Expect(err).ToNot(HaveOccurred())
+		start := time.Now()
+		rsp, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = io.ReadAll(rsp.Body)
+		Expect(err).To(HaveOccurred())
+		Expect(time.Since(start)).To(And(
+			BeNumerically(">=", timeout),
+			BeNumerically("<", 2*timeout),
+		))
+	})
+
 	It("cancels requests", func() {
 		handlerCalled := make(chan struct{})
 		mux.HandleFunc("/cancel", func(w http.ResponseWriter, r *http.Request) {
@@ -452,6 +992,358 @@ var _ = Describe("HTTP tests", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("uses the ResponseController for full-duplex requests", func() {
+		done := make(chan struct{})
+		mux.HandleFunc("/echoline", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			defer close(done)
+			w.WriteHeader(200)
+			w.(http.Flusher).Flush()
+			reader := bufio.NewReader(r.Body)
+			for {
+				msg, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				_, err = w.Write([]byte(msg))
+				Expect(err).ToNot(HaveOccurred())
+				w.(http.Flusher).Flush()
+			}
+		})
+
+		r, w := io.Pipe()
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("https://localhost:%d/echoline", port), r)
+		Expect(err).ToNot(HaveOccurred())
+		rsp, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+		rc := http3.NewResponseController(rsp)
+		Expect(rc.EnableFullDuplex()).To(Succeed())
+
+		reader := bufio.NewReader(rsp.Body)
+		fmt.Fprint(w, "foo\n")
+		msg, err := reader.ReadString('\n')
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg).To(Equal("foo\n"))
+
+		// nothing was sent, so reading runs into the deadline
+		Expect(rc.SetReadDeadline(time.Now().Add(deadlineDelay))).To(Succeed())
+		_, err = reader.ReadString('\n')
+		Expect(err).To(MatchError(os.ErrDeadlineExceeded))
+
+		// the response body can still be read after extending the deadline
+		Expect(rc.SetReadDeadline(time.Time{})).To(Succeed())
+		reader = bufio.NewReader(rsp.Body)
+		fmt.Fprint(w, "bar\n")
+		msg, err = reader.ReadString('\n')
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg).To(Equal("bar\n"))
+		Expect(req.Body.Close()).To(Succeed())
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("sends capsules on the request stream of a CONNECT request", func() {
+		capsules := make(chan []byte, 10)
+		server := &http3.Server{
+			TLSConfig: getTLSConfig(),
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				defer close(capsules)
+				Expect(r.Method).To(Equal(http.MethodConnect))
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				body := quicvarint.NewReader(r.Body)
+				for {
+					ct, cr, err := http3.ParseCapsule(body)
+					if err != nil {
+						return
+					}
+					Expect(ct).To(BeEquivalentTo(1337))
+					data, err := io.ReadAll(cr)
+					Expect(err).ToNot(HaveOccurred())
+					capsules <- data
+				}
+			}),
+		}
+		tlsConf := getTLSConfig()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		ln, err := quic.ListenAddr("localhost:0", tlsConf, getQuicConfig(nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			conn, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			server.ServeQUICConn(conn) // returns once the client closes
+		}()
+
+		req, err := http.NewRequest(http.MethodConnect, fmt.Sprintf("https://localhost:%d", ln.Addr().(*net.UDPAddr).Port), nil)
+		Expect(err).ToNot(HaveOccurred())
+		rsp, err := tr.RoundTripOpt(req, http3.RoundTripOpt{DontCloseRequestStream: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		w := http3.RequestStreamWriter(rsp)
+		Expect(w).ToNot(BeNil())
+		for i := 0; i < 3; i++ {
+			var b bytes.Buffer
+			Expect(http3.WriteCapsule(&b, 1337, []byte(fmt.Sprintf("capsule %d", i)))).To(Succeed())
+			_, err := w.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(capsules).Should(Receive(Equal([]byte(fmt.Sprintf("capsule %d", i)))))
+		}
+		// closing the writer ends the request body
+		Expect(w.Close()).To(Succeed())
+		Eventually(capsules).Should(BeClosed())
+		Expect(tr.Close()).To(Succeed())
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("only establishes a tunnel for successful Extended CONNECT requests", func() {
+		mux.HandleFunc("/tunnel", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodConnect))
+			Expect(r.Proto).To(Equal("webtransport"))
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			io.Copy(w, r.Body) // echo
+		})
+		newRequest := func(path string) *http.Request {
+			req, err := http.NewRequest(http.MethodConnect, fmt.Sprintf("https://localhost:%d%s", port, path), nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Proto = "webtransport"
+			return req
+		}
+
+		rsp, err := tr.RoundTripOpt(newRequest("/tunnel"), http3.RoundTripOpt{DontCloseRequestStream: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		w := http3.RequestStreamWriter(rsp)
+		Expect(w).ToNot(BeNil())
+		_, err = w.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+		data, err := io.ReadAll(gbytes.TimeoutReader(rsp.Body, 3*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("foobar"))
+
+		rsp, err = tr.RoundTripOpt(newRequest("/not-found"), http3.RoundTripOpt{DontCloseRequestStream: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(http3.RequestStreamWriter(rsp)).To(BeNil())
+		data, err = io.ReadAll(gbytes.TimeoutReader(rsp.Body, 3*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("not found"))
+	})
+
+	It("tunnels data through a CONNECT proxy", func() {
+		// the target of the tunnel is a TCP echo server
+		tcpLn, err := net.Listen("tcp", "localhost:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer tcpLn.Close()
+		go func() {
+			for {
+				c, err := tcpLn.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer c.Close()
+					io.Copy(c, c)
+				}()
+			}
+		}()
+
+		proxy := &http3.Server{
+			TLSConfig: getTLSConfig(),
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Method).To(Equal(http.MethodConnect))
+				Expect(r.URL.Path).To(BeEmpty())
+				Expect(r.URL.Scheme).To(BeEmpty())
+				target, err := net.Dial("tcp", r.Host)
+				if err != nil {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				defer target.Close()
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				go func() {
+					io.Copy(target, r.Body)
+					target.(*net.TCPConn).CloseWrite()
+				}()
+				b := make([]byte, 1024)
+				for {
+					n, err := target.Read(b)
+					if n > 0 {
+						w.Write(b[:n])
+						w.(http.Flusher).Flush()
+					}
+					if err != nil {
+						return
+					}
+				}
+			}),
+		}
+		tlsConf := getTLSConfig()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		ln, err := quic.ListenAddr("localhost:0", tlsConf, getQuicConfig(nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			conn, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			proxy.ServeQUICConn(conn) // returns once the client closes
+		}()
+
+		pr, pw := io.Pipe()
+		req, err := http.NewRequest(http.MethodConnect, fmt.Sprintf("https://localhost:%d", ln.Addr().(*net.UDPAddr).Port), pr)
+		Expect(err).ToNot(HaveOccurred())
+		req.Host = tcpLn.Addr().String()
+		rsp, err := tr.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+
+		// data is tunneled in both directions
+		for i := 0; i < 3; i++ {
+			msg := []byte(fmt.Sprintf("Hello through the tunnel, %d!", i))
+			_, err := pw.Write(msg)
+			Expect(err).ToNot(HaveOccurred())
+			b := make([]byte, len(msg))
+			_, err = io.ReadFull(gbytes.TimeoutReader(rsp.Body, 3*time.Second), b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b).To(Equal(msg))
+		}
+		// closing the request body closes the tunnel
+		Expect(pw.Close()).To(Succeed())
+		_, err = io.ReadAll(gbytes.TimeoutReader(rsp.Body, 3*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tr.Close()).To(Succeed())
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("dials the server through a CONNECT-UDP proxy", func() {
+		targets := make(chan string, 1)
+		proxy := &http3.Server{
+			TLSConfig:       getTLSConfig(),
+			EnableDatagrams: true,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Method).To(Equal(http.MethodConnect))
+				Expect(r.Proto).To(Equal("connect-udp"))
+				// the default URI template is /.well-known/masque/udp/{target_host}/{target_port}/
+				parts := strings.Split(r.URL.Path, "/")
+				Expect(parts).To(HaveLen(7))
+				target := net.JoinHostPort(parts[4], parts[5])
+				targets <- target
+				raddr, err := net.ResolveUDPAddr("udp", target)
+				Expect(err).ToNot(HaveOccurred())
+				conn, err := net.DialUDP("udp", nil, raddr)
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+				w.Header().Set("Capsule-Protocol", "?1")
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				str := w.(http3.HTTPStreamer).HTTPStream()
+				go func() {
+					b := make([]byte, 1500)
+					for {
+						n, err := conn.Read(b)
+						if err != nil {
+							return
+						}
+						str.SendDatagram(append([]byte{0}, b[:n]...)) // context ID 0
+					}
+				}()
+				go func() {
+					for {
+						data, err := str.ReceiveDatagram(context.Background())
+						if err != nil {
+							return
+						}
+						conn.Write(data[1:])
+					}
+				}()
+				// the client closes the stream when it closes the tunnel
+				io.Copy(io.Discard, str)
+			}),
+		}
+		tlsConf := getTLSConfig()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		ln, err := quic.ListenAddr("localhost:0", tlsConf, getQuicConfig(&quic.Config{EnableDatagrams: true}))
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			conn, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			proxy.ServeQUICConn(conn) // returns once the client closes
+		}()
+
+		proxyURL, err := url.Parse(fmt.Sprintf("https://localhost:%d", ln.Addr().(*net.UDPAddr).Port))
+		Expect(err).ToNot(HaveOccurred())
+		tr.Proxy = http.ProxyURL(proxyURL)
+		for i := 0; i < 2; i++ {
+			rsp, err := client.Get(fmt.Sprintf("https://localhost:%d/hello", port))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+			body, err := io.ReadAll(gbytes.TimeoutReader(rsp.Body, 3*time.Second))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("Hello, World!\n"))
+		}
+		// the second request reused the connection
+		Expect(targets).To(Receive(Equal(fmt.Sprintf("localhost:%d", port))))
+		Expect(tr.Close()).To(Succeed())
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("sends chunks of streamed request bodies without delay", func() {
+		chunks := make(chan time.Time, 10)
+		mux.HandleFunc("/chunks", func(w http.ResponseWriter, r *http.Request) {
+			b := make([]byte, 100)
+			for {
+				_, err := r.Body.Read(b)
+				if err != nil {
+					close(chunks)
+					return
+				}
+				chunks <- time.Now()
+			}
+		})
+
+		r, w := io.Pipe()
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("https://localhost:%d/chunks", port), r)
+		Expect(err).ToNot(HaveOccurred())
+		rspChan := make(chan *http.Response, 1)
+		go func() {
+			defer GinkgoRecover()
+			rsp, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			rspChan <- rsp
+		}()
+		for i := 0; i < 3; i++ {
+			start := time.Now()
+			_, err := w.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			var rcvd time.Time
+			Eventually(chunks).Should(Receive(&rcvd))
+			// the chunk is sent right away, and not buffered until the request body is closed
+			Expect(rcvd.Sub(start)).To(BeNumerically("<", scaleDuration(50*time.Millisecond)))
+		}
+		Expect(w.Close()).To(Succeed())
+		var rsp *http.Response
+		Eventually(rspChan).Should(Receive(&rsp))
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		Eventually(chunks).Should(BeClosed())
+	})
+
 	It("allows taking over the stream", func() {
 		handlerCalled := make(chan struct{})
 		mux.HandleFunc("/httpstreamer", func(w http.ResponseWriter, r *http.Request) {
@@ -532,6 +1424,101 @@ var _ = Describe("HTTP tests", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("errors when the stream limit is reached for longer than the maximum wait time", func() {
+		handlerStarted := make(chan struct{}, 1)
+		unblock := make(chan struct{})
+		mux.HandleFunc("/blocking", func(w http.ResponseWriter, r *http.Request) {
+			handlerStarted <- struct{}{}
+			<-unblock
+		})
+
+		tlsConf := getTLSConfig()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		ln, err := quic.ListenAddr("localhost:0", tlsConf, getQuicConfig(&quic.Config{MaxIncomingStreams: 1}))
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			conn, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			server.ServeQUICConn(conn) // returns once the client closes
+		}()
+
+		url := fmt.Sprintf("https://localhost:%d/blocking", ln.Addr().(*net.UDPAddr).Port)
+		errChan := make(chan error, 1)
+		go func() {
+			resp, err := client.Get(url)
+			if err == nil {
+				resp.Body.Close()
+			}
+			errChan <- err
+		}()
+		Eventually(handlerStarted).Should(Receive())
+
+		// the server only allows a single concurrent stream
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		Expect(err).ToNot(HaveOccurred())
+		start := time.Now()
+		_, err = tr.RoundTripOpt(req, http3.RoundTripOpt{MaxStreamWait: scaleDuration(50 * time.Millisecond)})
+		Expect(err).To(MatchError(http3.ErrStreamLimitReached))
+		Expect(time.Since(start)).To(BeNumerically(">=", scaleDuration(50*time.Millisecond)))
+		// with a non-blocking stream open, the request fails right away
+		_, err = tr.RoundTripOpt(req, http3.RoundTripOpt{NonBlockingStreamOpen: true})
+		Expect(err).To(MatchError(http3.ErrStreamLimitReached))
+
+		// once the first request completes, the connection can be used for new requests
+		close(unblock)
+		Eventually(errChan).Should(Receive(BeNil()))
+		resp, err := tr.RoundTripOpt(req, http3.RoundTripOpt{MaxStreamWait: scaleDuration(time.Second), OnlyCachedConn: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		client.Transport.(io.Closer).Close()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("uses address validation tokens when reconnecting", func() {
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		var unvalidated atomic.Int32
+		qtr := &quic.Transport{
+			Conn:        udpConn,
+			MaxTokenAge: time.Hour,
+			// Perform address validation (using a Retry) for connections without a valid token.
+			// This callback is not called if the client presents a token.
+			VerifySourceAddress: func(net.Addr) bool {
+				unvalidated.Add(1)
+				return true
+			},
+		}
+		defer qtr.Close()
+		tlsConf := getTLSConfig()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		ln, err := qtr.ListenEarly(tlsConf, getQuicConfig(nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		go server.ServeListener(ln)
+
+		gets := make(chan string, 100)
+		puts := make(chan string, 100)
+		tr.TokenStore = newTokenStore(gets, puts)
+		url := fmt.Sprintf("https://localhost:%d/hello", udpConn.LocalAddr().(*net.UDPAddr).Port)
+		resp, err := client.Get(url)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(unvalidated.Load()).To(BeEquivalentTo(1))
+		// wait for the NEW_TOKEN frame
+		Eventually(puts).Should(Receive())
+		tr.CloseIdleConnections()
+
+		// the second connection presents the token, and isn't subject to address validation
+		resp, err = client.Get(url)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(unvalidated.Load()).To(BeEquivalentTo(1))
+	})
+
 	It("supports read deadlines", func() {
 		mux.HandleFunc("/read-deadline", func(w http.ResponseWriter, r *http.Request) {
 			defer GinkgoRecover()
@@ -570,16 +1557,43 @@ var _ = Describe("HTTP tests", func() {
 			Expect(err).To(MatchError(os.ErrDeadlineExceeded))
 		})
 
-		expectedEnd := time.Now().Add(deadlineDelay)
+		expectedEnd := time.Now().Add(deadlineDelay)
+
+		resp, err := client.Get(fmt.Sprintf("https://localhost:%d/write-deadline", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+
+		body, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 2*deadlineDelay))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Now().After(expectedEnd)).To(BeTrue())
+		Expect(string(body)).To(ContainSubstring("aa"))
+	})
+
+	It("supports read deadlines on the response body", func() {
+		done := make(chan struct{})
+		mux.HandleFunc("/stall", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			w.Write([]byte("foobar"))
+			w.(http.Flusher).Flush()
+			<-done
+		})
+		defer close(done)
 
-		resp, err := client.Get(fmt.Sprintf("https://localhost:%d/write-deadline", port))
+		resp, err := client.Get(fmt.Sprintf("https://localhost:%d/stall", port))
 		Expect(err).ToNot(HaveOccurred())
 		Expect(resp.StatusCode).To(Equal(200))
+		deadlineBody, ok := resp.Body.(interface{ SetReadDeadline(time.Time) error })
+		Expect(ok).To(BeTrue())
 
-		body, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 2*deadlineDelay))
-		Expect(err).ToNot(HaveOccurred())
+		expectedEnd := time.Now().Add(deadlineDelay)
+		Expect(deadlineBody.SetReadDeadline(expectedEnd)).To(Succeed())
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).To(MatchError(os.ErrDeadlineExceeded))
+		var nerr net.Error
+		Expect(errors.As(err, &nerr)).To(BeTrue())
+		Expect(nerr.Timeout()).To(BeTrue())
 		Expect(time.Now().After(expectedEnd)).To(BeTrue())
-		Expect(string(body)).To(ContainSubstring("aa"))
+		Expect(string(body)).To(Equal("foobar"))
 	})
 
 	It("sets remote address", func() {
@@ -683,10 +1697,262 @@ var _ = Describe("HTTP tests", func() {
 		Eventually(cc.ReceivedSettings(), 5*time.Second, 10*time.Millisecond).Should(BeClosed())
 		settings := cc.Settings()
 		Expect(settings.EnableExtendedConnect).To(BeTrue())
-		Expect(settings.EnableDatagrams).To(BeFalse())
+		Expect(settings.EnableDatagrams).To(BeTrue())
 		Expect(settings.Other).To(BeEmpty())
 	})
 
+	It("sends the frames returned by ControlStreamInit on the control stream", func() {
+		token := quicvarint.Append(nil, 0x1f4d) // frame type
+		token = quicvarint.Append(token, 5)     // length
+		token = append(token, "token"...)
+		controlStreamInit := func() []byte { return token }
+
+		tlsConf := getTLSConfig()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		ln, err := quic.ListenAddr("localhost:0", tlsConf, getQuicConfig(nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		frames := make(chan []byte, 1)
+		go func() {
+			defer GinkgoRecover()
+			conn, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.CloseWithError(0, "")
+			str, err := conn.AcceptUniStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			r := quicvarint.NewReader(str)
+			streamType, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(streamType).To(BeEquivalentTo(0x0)) // control stream
+			// skip the SETTINGS frame
+			frameType, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frameType).To(BeEquivalentTo(0x4))
+			l, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = io.CopyN(io.Discard, r, int64(l))
+			Expect(err).ToNot(HaveOccurred())
+			b := make([]byte, len(token))
+			_, err = io.ReadFull(r, b)
+			Expect(err).ToNot(HaveOccurred())
+			frames <- b
+		}()
+
+		clientTLSConf := getTLSClientConfigWithoutServerName()
+		clientTLSConf.NextProtos = []string{http3.NextProtoH3}
+		conn, err := quic.DialAddr(context.Background(), ln.Addr().String(), clientTLSConf, getQuicConfig(nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.CloseWithError(0, "")
+		tr := &http3.Transport{ControlStreamInit: controlStreamInit}
+		tr.NewClientConn(conn)
+		Eventually(frames).Should(Receive(Equal(token)))
+
+		// the HTTP/3 server skips over the unknown frame
+		tr = &http3.Transport{
+			TLSClientConfig:   getTLSClientConfig(),
+			QUICConfig:        getQuicConfig(nil),
+			ControlStreamInit: controlStreamInit,
+		}
+		defer tr.Close()
+		cl := &http.Client{Transport: tr}
+		resp, err := cl.Get(fmt.Sprintf("https://localhost:%d/hello", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("reports the negotiated QUIC version and ALPN", func() {
+		tlsConf := tlsClientConfigWithoutServerName.Clone()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		conn, err := quic.DialAddr(
+			context.Background(),
+			fmt.Sprintf("localhost:%d", port),
+			tlsConf,
+			getQuicConfig(nil),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.CloseWithError(0, "")
+		var tr http3.Transport
+		cc := tr.NewClientConn(conn)
+		v, alpn := cc.NegotiatedProtocol()
+		Expect(v).To(Equal(version))
+		Expect(alpn).To(Equal(http3.NextProtoH3))
+	})
+
+	It("pings the server", func() {
+		tlsConf := tlsClientConfigWithoutServerName.Clone()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		conn, err := quic.DialAddr(
+			context.Background(),
+			fmt.Sprintf("localhost:%d", port),
+			tlsConf,
+			getQuicConfig(nil),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		var tr http3.Transport
+		cc := tr.NewClientConn(conn)
+		rtt, err := cc.Ping(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rtt).To(BeNumerically(">", 0))
+
+		Expect(conn.CloseWithError(quic.ApplicationErrorCode(http3.ErrCodeNoError), "")).To(Succeed())
+		_, err = cc.Ping(context.Background())
+		var h3Err *http3.Error
+		Expect(errors.As(err, &h3Err)).To(BeTrue())
+		Expect(h3Err.Remote).To(BeFalse())
+		Expect(h3Err.ErrorCode).To(Equal(http3.ErrCodeNoError))
+	})
+
+	It("sends requests using a header template", func() {
+		headers := make(chan http.Header, 2)
+		mux.HandleFunc("/template", func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header
+		})
+
+		tlsConf := tlsClientConfigWithoutServerName.Clone()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		conn, err := quic.DialAddr(
+			context.Background(),
+			fmt.Sprintf("localhost:%d", port),
+			tlsConf,
+			getQuicConfig(nil),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.CloseWithError(0, "")
+		var tr http3.Transport
+		cc := tr.NewClientConn(conn)
+
+		newRequest := func(ctx context.Context) *http.Request {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://localhost:%d/template", port), nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Foo", "bar")
+			return req
+		}
+		tmpl, err := cc.PrepareHeaders(newRequest(context.Background()))
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 2; i++ {
+			req := newRequest(context.WithValue(context.Background(), http3.HeaderTemplateContextKey, tmpl))
+			req.Header.Set("Request-Id", strconv.Itoa(i))
+			rsp, err := cc.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+			var hdr http.Header
+			Eventually(headers).Should(Receive(&hdr))
+			Expect(hdr.Get("Foo")).To(Equal("bar"))
+			Expect(hdr.Get("Request-Id")).To(Equal(strconv.Itoa(i)))
+		}
+	})
+
+	It("reports the RTT and the congestion window after a request", func() {
+		tlsConf := tlsClientConfigWithoutServerName.Clone()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		conn, err := quic.DialAddr(
+			context.Background(),
+			fmt.Sprintf("localhost:%d", port),
+			tlsConf,
+			getQuicConfig(nil),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.CloseWithError(0, "")
+		var tr http3.Transport
+		cc := tr.NewClientConn(conn)
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/hello", port), nil)
+		Expect(err).ToNot(HaveOccurred())
+		rsp, err := cc.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+		_, err = io.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+
+		stats := cc.ConnectionStats()
+		Expect(stats.SmoothedRTT).To(BeNumerically(">", 0))
+		Expect(stats.MinRTT).To(BeNumerically(">", 0))
+		Expect(stats.MinRTT).To(BeNumerically("<=", stats.LatestRTT))
+		Expect(stats.CongestionWindow).To(BeNumerically(">", 0))
+	})
+
+	It("uses the configured congestion control algorithm", func() {
+		connChan := make(chan quic.EarlyConnection, 1)
+		tr.CongestionControl = quic.CongestionControlCubic
+		tr.Dial = func(ctx context.Context, addr string, tlsConf *tls.Config, conf *quic.Config) (quic.EarlyConnection, error) {
+			conn, err := quic.DialAddrEarly(ctx, addr, tlsConf, conf)
+			if err == nil {
+				connChan <- conn
+			}
+			return conn, err
+		}
+		rsp, err := client.Get(fmt.Sprintf("https://localhost:%d/hello", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+		var conn quic.EarlyConnection
+		Expect(connChan).To(Receive(&conn))
+		Expect(conn.ConnectionState().CongestionControl).To(Equal(quic.CongestionControlCubic))
+	})
+
+	It("counts keep-alive PINGs sent while the connection is idle", func() {
+		tlsConf := tlsClientConfigWithoutServerName.Clone()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		conn, err := quic.DialAddr(
+			context.Background(),
+			fmt.Sprintf("localhost:%d", port),
+			tlsConf,
+			getQuicConfig(&quic.Config{KeepAlivePeriod: 50 * time.Millisecond}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.CloseWithError(0, "")
+		var tr http3.Transport
+		cc := tr.NewClientConn(conn)
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/hello", port), nil)
+		Expect(err).ToNot(HaveOccurred())
+		rsp, err := cc.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+		_, err = io.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() uint64 { return cc.ConnectionStats().KeepAlivePingsSent }).Should(BeNumerically(">=", 3))
+		// the server acknowledges every PING, so the connection never becomes idle for long
+		Expect(cc.ConnectionStats().IdleTime).To(BeNumerically("<", time.Second))
+	})
+
+	It("reports the number of active requests", func() {
+		release := make(chan struct{})
+		mux.HandleFunc("/active", func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.Write([]byte("done"))
+		})
+		tlsConf := tlsClientConfigWithoutServerName.Clone()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		conn, err := quic.DialAddr(context.Background(), fmt.Sprintf("localhost:%d", port), tlsConf, getQuicConfig(nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.CloseWithError(0, "")
+		var tr http3.Transport
+		cc := tr.NewClientConn(conn)
+		Expect(cc.ActiveRequests()).To(BeZero())
+
+		const num = 5
+		var wg sync.WaitGroup
+		wg.Add(num)
+		for i := 0; i < num; i++ {
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/active", port), nil)
+				Expect(err).ToNot(HaveOccurred())
+				rsp, err := cc.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				body, err := io.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("done"))
+			}()
+		}
+		Eventually(cc.ActiveRequests).Should(Equal(num))
+		Consistently(cc.ActiveRequests, scaleDuration(20*time.Millisecond)).Should(Equal(num))
+		close(release)
+		wg.Wait()
+		Eventually(cc.ActiveRequests).Should(BeZero())
+	})
+
 	It("receives the client's settings", func() {
 		settingsChan := make(chan *http3.Settings, 1)
 		mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
@@ -760,6 +2026,7 @@ var _ = Describe("HTTP tests", func() {
 		Expect(hdr).To(HaveKeyWithValue("Link", []string{header1, header2}))
 		Expect(cnt).To(Equal(1))
 		Expect(resp.Header).To(HaveKeyWithValue("Link", []string{header1, header2}))
+		Expect(http3.EarlyHintsLinks(resp)).To(Equal([]string{header1, header2}))
 		Expect(resp.Body.Close()).To(Succeed())
 	})
 
@@ -876,6 +2143,48 @@ var _ = Describe("HTTP tests", func() {
 			Expect(resetErr.(*quic.StreamError).ErrorCode).To(BeEquivalentTo(42))
 		})
 
+		It("drops datagrams when the send queue is full", func() {
+			type result struct {
+				sent, dropped int
+				maxQueueLen   int
+			}
+			resultChan := make(chan result, 1)
+			mux.HandleFunc("/datagrams", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				conn := w.(http3.Hijacker).Connection()
+				Eventually(conn.ReceivedSettings()).Should(BeClosed())
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+
+				str := w.(http3.HTTPStreamer).HTTPStream()
+				var res result
+				// Send datagrams faster than the connection can send them out.
+				for i := 0; i < 5000; i++ {
+					err := str.TrySendDatagram(make([]byte, 1000))
+					if errors.Is(err, quic.ErrDatagramQueueFull) {
+						res.dropped++
+					} else {
+						Expect(err).ToNot(HaveOccurred())
+						res.sent++
+					}
+					res.maxQueueLen = max(res.maxQueueLen, conn.DatagramQueueLen())
+				}
+				resultChan <- res
+				str.Close()
+			})
+
+			str, closeFn := openDatagramStream(fmt.Sprintf("https://localhost:%d/datagrams", port))
+			defer closeFn()
+			go str.Read([]byte{0})
+
+			var res result
+			Eventually(resultChan).Should(Receive(&res))
+			Expect(res.sent).ToNot(BeZero())
+			Expect(res.dropped).ToNot(BeZero())
+			Expect(res.maxQueueLen).To(BeNumerically(">", 0))
+			Expect(res.maxQueueLen).To(BeNumerically("<=", 32))
+		})
+
 		It("closes the send direction", func() {
 			errChan := make(chan error, 1)
 			datagramChan := make(chan []byte, 1)
@@ -1000,6 +2309,7 @@ var _ = Describe("HTTP tests", func() {
 			data, err := io.ReadAll(rsp.Body)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(string(data)).To(Equal("false"))
+			Expect(http3.ServedOver0RTT(rsp)).To(BeFalse())
 			Expect(num0RTTPackets.Load()).To(BeZero())
 			Eventually(puts).Should(Receive())
 
@@ -1015,7 +2325,53 @@ var _ = Describe("HTTP tests", func() {
 			data, err = io.ReadAll(rsp.Body)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(string(data)).To(Equal("true"))
+			Expect(http3.ServedOver0RTT(rsp)).To(BeTrue())
+			Expect(num0RTTPackets.Load()).To(BeNumerically(">", 0))
+		})
+
+		It("uses 0-RTT for a second connection, using the default session cache", func() {
+			proxy, num0RTTPackets := runCountingProxy(port, scaleDuration(50*time.Millisecond))
+			defer proxy.Close()
+
+			tr := &http3.Transport{
+				TLSClientConfig:    getTLSClientConfigWithoutServerName(),
+				QUICConfig:         getQuicConfig(nil),
+				DisableCompression: true,
+			}
+			defer tr.Close()
+
+			mux.HandleFunc("/0rtt", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(strconv.FormatBool(!r.TLS.HandshakeComplete)))
+			})
+			req, err := http.NewRequest(http3.MethodGet0RTT, fmt.Sprintf("https://localhost:%d/0rtt", proxy.LocalPort()), nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := tr.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := io.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("false"))
+			Expect(num0RTTPackets.Load()).To(BeZero())
+			// give the client some time to receive the session ticket
+			time.Sleep(scaleDuration(50 * time.Millisecond))
+			tr.CloseIdleConnections()
+
+			rsp, err = tr.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			data, err = io.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("true"))
+			Expect(http3.ServedOver0RTT(rsp)).To(BeTrue())
 			Expect(num0RTTPackets.Load()).To(BeNumerically(">", 0))
+
+			// after clearing the session cache, 0-RTT can't be used anymore
+			tr.ClearSessionCache()
+			tr.CloseIdleConnections()
+			rsp, err = tr.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			data, err = io.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("false"))
+			Expect(http3.ServedOver0RTT(rsp)).To(BeFalse())
 		})
 	})
 
@@ -1116,6 +2472,89 @@ var _ = Describe("HTTP tests", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("allows existing requests to complete when the client shuts down", func() {
+		delay := scaleDuration(100 * time.Millisecond)
+		received := make(chan struct{})
+		mux.HandleFunc("/client-shutdown", func(w http.ResponseWriter, r *http.Request) {
+			close(received)
+			time.Sleep(delay)
+			w.Write([]byte("shutdown"))
+		})
+
+		tlsConf := tlsClientConfigWithoutServerName.Clone()
+		tlsConf.NextProtos = []string{http3.NextProtoH3}
+		conn, err := quic.DialAddr(
+			context.Background(),
+			fmt.Sprintf("localhost:%d", port),
+			tlsConf,
+			getQuicConfig(nil),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.CloseWithError(0, "")
+		cc := (&http3.Transport{}).NewClientConn(conn)
+
+		rspChan := make(chan *http.Response, 1)
+		go func() {
+			defer GinkgoRecover()
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/client-shutdown", port), nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := cc.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			rspChan <- rsp
+		}()
+		Eventually(received).Should(BeClosed())
+
+		shutdownDone := make(chan error, 1)
+		go func() { shutdownDone <- cc.Shutdown(context.Background()) }()
+
+		var rsp *http.Response
+		Eventually(rspChan).Should(Receive(&rsp))
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		Consistently(shutdownDone, scaleDuration(20*time.Millisecond)).ShouldNot(Receive())
+		body, err := io.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(Equal([]byte("shutdown")))
+		Eventually(shutdownDone).Should(Receive(BeNil()))
+		Eventually(conn.Context().Done()).Should(BeClosed())
+
+		// no new requests are sent after shutting down
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%d/client-shutdown", port), nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cc.RoundTrip(req)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("gracefully shuts down the Transport", func() {
+		delay := scaleDuration(100 * time.Millisecond)
+		received := make(chan struct{})
+		mux.HandleFunc("/transport-shutdown", func(w http.ResponseWriter, r *http.Request) {
+			close(received)
+			time.Sleep(delay)
+			w.Write([]byte("shutdown"))
+		})
+
+		rspChan := make(chan *http.Response, 1)
+		go func() {
+			defer GinkgoRecover()
+			rsp, err := client.Get(fmt.Sprintf("https://localhost:%d/transport-shutdown", port))
+			Expect(err).ToNot(HaveOccurred())
+			rspChan <- rsp
+		}()
+		Eventually(received).Should(BeClosed())
+
+		shutdownDone := make(chan error, 1)
+		go func() { shutdownDone <- tr.Shutdown(context.Background()) }()
+
+		var rsp *http.Response
+		Eventually(rspChan).Should(Receive(&rsp))
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		Consistently(shutdownDone, scaleDuration(20*time.Millisecond)).ShouldNot(Receive())
+		body, err := io.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(Equal([]byte("shutdown")))
+		Eventually(shutdownDone).Should(Receive(BeNil()))
+	})
+
 	It("aborts long-lived requests on graceful shutdown", func() {
 		delay := scaleDuration(100 * time.Millisecond)
 		shutdownDone := make(chan struct{})
@@ -0,0 +1,54 @@
+package versionnegotiation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP3FallbackToSecondOfferedVersion(t *testing.T) {
+	tlsConf := getTLSConfig().Clone()
+	tlsConf.NextProtos = []string{http3.NextProtoH3}
+	// the server only supports the second version offered by the client
+	ln, err := quic.ListenAddrEarly(
+		"localhost:0",
+		tlsConf,
+		maybeAddQLOGTracer(&quic.Config{Versions: []quic.Version{quic.Version2}}),
+	)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	server := &http3.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, w.(http3.Hijacker).Connection().ConnectionState().Version)
+		}),
+	}
+	defer server.Close()
+	go server.ServeListener(ln)
+
+	tr := &http3.Transport{
+		TLSClientConfig: getTLSClientConfig(),
+		QUICConfig:      maybeAddQLOGTracer(&quic.Config{Versions: []quic.Version{quic.Version1, quic.Version2}}),
+	}
+	defer tr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://localhost:%d/", ln.Addr().(*net.UDPAddr).Port), nil)
+	require.NoError(t, err)
+	rsp, err := tr.RoundTrip(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.Equal(t, quic.Version2.String(), string(body))
+}
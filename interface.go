@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"time"
@@ -26,6 +27,29 @@ const (
 	Version2 = protocol.Version2
 )
 
+// A CongestionControlAlgorithm is a congestion control algorithm used for sending data.
+// The zero value selects the default algorithm.
+type CongestionControlAlgorithm uint8
+
+const (
+	// CongestionControlNewReno is the NewReno congestion controller, as described in RFC 9002.
+	// It is the default.
+	CongestionControlNewReno CongestionControlAlgorithm = iota + 1
+	// CongestionControlCubic is the CUBIC congestion controller (RFC 9438).
+	CongestionControlCubic
+)
+
+func (a CongestionControlAlgorithm) String() string {
+	switch a {
+	case CongestionControlNewReno:
+		return "NewReno"
+	case CongestionControlCubic:
+		return "CUBIC"
+	default:
+		return fmt.Sprintf("unknown congestion control algorithm (%d)", uint8(a))
+	}
+}
+
 // A ClientToken is a token received by the client.
 // It can be used to skip address validation on future connection attempts.
 type ClientToken struct {
@@ -50,6 +74,10 @@ type TokenStore interface {
 // when the server rejects a 0-RTT connection attempt.
 var Err0RTTRejected = errors.New("0-RTT rejected")
 
+// ErrDatagramQueueFull is returned from Connection.TrySendDatagram
+// when the datagram send queue is full.
+var ErrDatagramQueueFull = errors.New("datagram send queue full")
+
 // ConnectionTracingKey can be used to associate a ConnectionTracer with a Connection.
 // It is set on the Connection.Context() context,
 // as well as on the context passed to logging.Tracer.NewConnectionTracer.
@@ -197,15 +225,29 @@ type Connection interface {
 	// ConnectionState returns basic details about the QUIC connection.
 	// Warning: This API should not be considered stable and might change soon.
 	ConnectionState() ConnectionState
+	// ConnectionStats returns the current RTT estimates and the congestion window of the connection.
+	// Warning: This API should not be considered stable and might change soon.
+	ConnectionStats() ConnectionStats
 
 	// SendDatagram sends a message using a QUIC datagram, as specified in RFC 9221.
 	// There is no delivery guarantee for DATAGRAM frames, they are not retransmitted if lost.
 	// The payload of the datagram needs to fit into a single QUIC packet.
 	// In addition, a datagram may be dropped before being sent out if the available packet size suddenly decreases.
 	// If the payload is too large to be sent at the current time, a DatagramTooLargeError is returned.
+	// If the send queue is full, SendDatagram blocks until a queued datagram has been sent.
 	SendDatagram(payload []byte) error
+	// TrySendDatagram is like SendDatagram, but it doesn't block if the send queue is full.
+	// Instead, the datagram is dropped and ErrDatagramQueueFull is returned.
+	TrySendDatagram(payload []byte) error
+	// DatagramQueueLen returns the number of datagrams queued for sending.
+	DatagramQueueLen() int
 	// ReceiveDatagram gets a message received in a datagram, as specified in RFC 9221.
 	ReceiveDatagram(context.Context) ([]byte, error)
+	// Ping sends a PING frame and waits until the peer acknowledges it.
+	// It returns the time between sending the PING frame and receiving the acknowledgement,
+	// which includes the peer's acknowledgement delay.
+	// It returns an error if the context is canceled or the connection is closed before that.
+	Ping(context.Context) (time.Duration, error)
 }
 
 // An EarlyConnection is a connection that is handshaking.
@@ -330,6 +372,9 @@ type Config struct {
 	// If set too high, the path might not support packets that large, leading to a timeout of the QUIC handshake.
 	// Values below 1200 are invalid.
 	InitialPacketSize uint16
+	// CongestionControl is the congestion control algorithm used for sending data.
+	// If not set, CongestionControlNewReno is used.
+	CongestionControl CongestionControlAlgorithm
 	// DisablePathMTUDiscovery disables Path MTU Discovery (RFC 8899).
 	// This allows the sending of QUIC packets that fully utilize the available MTU of the path.
 	// Path MTU discovery is only available on systems that allow setting of the Don't Fragment (DF) bit.
@@ -368,4 +413,27 @@ type ConnectionState struct {
 	Version Version
 	// GSO says if generic segmentation offload is used
 	GSO bool
+	// CongestionControl is the congestion control algorithm used on the connection.
+	CongestionControl CongestionControlAlgorithm
+}
+
+// ConnectionStats contains statistics about the QUIC connection.
+// RTT values are zero until the first RTT sample was obtained.
+type ConnectionStats struct {
+	// MinRTT is the minimum RTT observed on the connection.
+	MinRTT time.Duration
+	// LatestRTT is the most recent RTT sample.
+	LatestRTT time.Duration
+	// SmoothedRTT is the exponentially weighted moving average of the RTT samples,
+	// as defined in section 5.3 of RFC 9002.
+	SmoothedRTT time.Duration
+	// MeanDeviation is the mean deviation of the RTT samples.
+	MeanDeviation time.Duration
+	// CongestionWindow is the current congestion window, in bytes.
+	CongestionWindow uint64
+	// KeepAlivePingsSent is the number of PING frames sent to keep the connection alive,
+	// see Config.KeepAlivePeriod.
+	KeepAlivePingsSent uint64
+	// IdleTime is the time that passed since the last packet was received from the peer.
+	IdleTime time.Duration
 }
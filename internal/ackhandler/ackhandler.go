@@ -15,10 +15,11 @@ func NewAckHandler(
 	rttStats *utils.RTTStats,
 	clientAddressValidated bool,
 	enableECN bool,
+	useReno bool,
 	pers protocol.Perspective,
 	tracer *logging.ConnectionTracer,
 	logger utils.Logger,
 ) (SentPacketHandler, ReceivedPacketHandler) {
-	sph := newSentPacketHandler(initialPacketNumber, initialMaxDatagramSize, rttStats, clientAddressValidated, enableECN, pers, tracer, logger)
+	sph := newSentPacketHandler(initialPacketNumber, initialMaxDatagramSize, rttStats, clientAddressValidated, enableECN, useReno, pers, tracer, logger)
 	return sph, newReceivedPacketHandler(sph, logger)
 }
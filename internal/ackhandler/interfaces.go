@@ -35,6 +35,19 @@ type SentPacketHandler interface {
 
 	GetLossDetectionTimeout() time.Time
 	OnLossDetectionTimeout() error
+
+	// ConnectionStats returns a snapshot of the RTT estimates and the congestion window.
+	// It is safe to call it concurrently with the other methods.
+	ConnectionStats() ConnectionStats
+}
+
+// ConnectionStats contains the RTT estimates and the current congestion window.
+type ConnectionStats struct {
+	MinRTT           time.Duration
+	LatestRTT        time.Duration
+	SmoothedRTT      time.Duration
+	MeanDeviation    time.Duration
+	CongestionWindow protocol.ByteCount
 }
 
 type sentPacketTracker interface {
@@ -3,6 +3,7 @@ package ackhandler
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go/internal/congestion"
@@ -97,6 +98,13 @@ type sentPacketHandler struct {
 
 	perspective protocol.Perspective
 
+	// stats is updated every time the RTT estimate or the congestion window might have changed.
+	// It is read by ConnectionStats, which may be called from a different go routine.
+	stats struct {
+		minRTT, latestRTT, smoothedRTT, meanDeviation atomic.Int64 // time.Duration
+		congestionWindow                              atomic.Int64 // protocol.ByteCount
+	}
+
 	tracer *logging.ConnectionTracer
 	logger utils.Logger
 }
@@ -114,6 +122,7 @@ func newSentPacketHandler(
 	rttStats *utils.RTTStats,
 	clientAddressValidated bool,
 	enableECN bool,
+	useReno bool,
 	pers protocol.Perspective,
 	tracer *logging.ConnectionTracer,
 	logger utils.Logger,
@@ -122,7 +131,7 @@ func newSentPacketHandler(
 		congestion.DefaultClock{},
 		rttStats,
 		initialMaxDatagramSize,
-		true, // use Reno
+		useReno,
 		tracer,
 	)
 
@@ -142,6 +151,7 @@ func newSentPacketHandler(
 		h.enableECN = true
 		h.ecnTracker = newECNTracker(logger, tracer)
 	}
+	h.updateStats()
 	return h
 }
 
@@ -386,6 +396,7 @@ func (h *sentPacketHandler) ReceivedAck(ack *wire.AckFrame, encLevel protocol.En
 	if h.tracer != nil && h.tracer.UpdatedMetrics != nil {
 		h.tracer.UpdatedMetrics(h.rttStats, h.congestion.GetCongestionWindow(), h.bytesInFlight, h.packetsInFlight())
 	}
+	h.updateStats()
 
 	h.setLossDetectionTimer()
 	return acked1RTTPacket, nil
@@ -671,6 +682,7 @@ func (h *sentPacketHandler) detectLostPackets(now time.Time, encLevel protocol.E
 
 func (h *sentPacketHandler) OnLossDetectionTimeout() error {
 	defer h.setLossDetectionTimer()
+	defer h.updateStats()
 	earliestLossTime, encLevel := h.getLossTimeAndSpace()
 	if !earliestLossTime.IsZero() {
 		if h.logger.Debug() {
@@ -823,6 +835,27 @@ func (h *sentPacketHandler) TimeUntilSend() time.Time {
 
 func (h *sentPacketHandler) SetMaxDatagramSize(s protocol.ByteCount) {
 	h.congestion.SetMaxDatagramSize(s)
+	h.updateStats()
+}
+
+func (h *sentPacketHandler) updateStats() {
+	h.stats.minRTT.Store(int64(h.rttStats.MinRTT()))
+	h.stats.latestRTT.Store(int64(h.rttStats.LatestRTT()))
+	h.stats.smoothedRTT.Store(int64(h.rttStats.SmoothedRTT()))
+	h.stats.meanDeviation.Store(int64(h.rttStats.MeanDeviation()))
+	h.stats.congestionWindow.Store(int64(h.congestion.GetCongestionWindow()))
+}
+
+// ConnectionStats returns the stats stored by the last call to updateStats.
+// The values are loaded individually, so a concurrent update might only be partially reflected.
+func (h *sentPacketHandler) ConnectionStats() ConnectionStats {
+	return ConnectionStats{
+		MinRTT:           time.Duration(h.stats.minRTT.Load()),
+		LatestRTT:        time.Duration(h.stats.latestRTT.Load()),
+		SmoothedRTT:      time.Duration(h.stats.smoothedRTT.Load()),
+		MeanDeviation:    time.Duration(h.stats.meanDeviation.Load()),
+		CongestionWindow: protocol.ByteCount(h.stats.congestionWindow.Load()),
+	}
 }
 
 func (h *sentPacketHandler) isAmplificationLimited() bool {
@@ -898,6 +931,7 @@ func (h *sentPacketHandler) ResetForRetry(now time.Time) error {
 			h.tracer.UpdatedMetrics(h.rttStats, h.congestion.GetCongestionWindow(), h.bytesInFlight, h.packetsInFlight())
 		}
 	}
+	h.updateStats()
 	h.initialPackets = newPacketNumberSpace(h.initialPackets.pns.Peek(), false)
 	h.appDataPackets = newPacketNumberSpace(h.appDataPackets.pns.Peek(), true)
 	oldAlarm := h.alarm
@@ -44,7 +44,7 @@ var _ = Describe("SentPacketHandler", func() {
 	JustBeforeEach(func() {
 		lostPackets = nil
 		var rttStats utils.RTTStats
-		handler = newSentPacketHandler(42, protocol.InitialPacketSize, &rttStats, false, false, perspective, nil, utils.DefaultLogger)
+		handler = newSentPacketHandler(42, protocol.InitialPacketSize, &rttStats, false, false, true, perspective, nil, utils.DefaultLogger)
 		streamFrame = wire.StreamFrame{
 			StreamID: 5,
 			Data:     []byte{0x13, 0x37},
@@ -412,6 +412,20 @@ var _ = Describe("SentPacketHandler", func() {
 				Expect(handler.rttStats.LatestRTT()).To(BeNumerically("~", 1*time.Minute, 1*time.Second))
 			})
 
+			It("reports the RTT and the congestion window in the connection stats", func() {
+				Expect(handler.ConnectionStats().CongestionWindow).To(Equal(handler.congestion.GetCongestionWindow()))
+				getPacket(1, protocol.Encryption1RTT).SendTime = time.Now().Add(-time.Minute)
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+				_, err := handler.ReceivedAck(ack, protocol.Encryption1RTT, time.Now())
+				Expect(err).ToNot(HaveOccurred())
+				stats := handler.ConnectionStats()
+				Expect(stats.LatestRTT).To(BeNumerically("~", time.Minute, time.Second))
+				Expect(stats.SmoothedRTT).To(Equal(handler.rttStats.SmoothedRTT()))
+				Expect(stats.MinRTT).To(Equal(handler.rttStats.MinRTT()))
+				Expect(stats.MeanDeviation).To(Equal(handler.rttStats.MeanDeviation()))
+				Expect(stats.CongestionWindow).To(Equal(handler.congestion.GetCongestionWindow()))
+			})
+
 			It("ignores the DelayTime for Initial and Handshake packets", func() {
 				sentPacket(initialPacket(&packet{PacketNumber: 1}))
 				handler.rttStats.SetMaxAckDelay(time.Hour)
@@ -543,6 +557,7 @@ var _ = Describe("SentPacketHandler", func() {
 		It("should call MaybeExitSlowStart and OnPacketAcked", func() {
 			rcvTime := time.Now().Add(-5 * time.Second)
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(3)
+			cong.EXPECT().GetCongestionWindow().AnyTimes()
 			gomock.InOrder(
 				cong.EXPECT().MaybeExitSlowStart(), // must be called before packets are acked
 				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(1), protocol.ByteCount(1), protocol.ByteCount(3), rcvTime),
@@ -558,6 +573,7 @@ var _ = Describe("SentPacketHandler", func() {
 
 		It("doesn't call OnPacketAcked when a retransmitted packet is acked", func() {
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+			cong.EXPECT().GetCongestionWindow().AnyTimes()
 			sentPacket(ackElicitingPacket(&packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
 			sentPacket(ackElicitingPacket(&packet{PacketNumber: 2}))
 			// lose packet 1
@@ -577,6 +593,7 @@ var _ = Describe("SentPacketHandler", func() {
 
 		It("doesn't call OnCongestionEvent when a Path MTU probe packet is lost", func() {
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+			cong.EXPECT().GetCongestionWindow().AnyTimes()
 			var mtuPacketDeclaredLost bool
 			sentPacket(ackElicitingPacket(&packet{
 				PacketNumber:         1,
@@ -604,6 +621,7 @@ var _ = Describe("SentPacketHandler", func() {
 
 		It("calls OnPacketAcked and OnCongestionEvent with the right bytes_in_flight value", func() {
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(4)
+			cong.EXPECT().GetCongestionWindow().AnyTimes()
 			sentPacket(ackElicitingPacket(&packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
 			sentPacket(ackElicitingPacket(&packet{PacketNumber: 2, SendTime: time.Now().Add(-30 * time.Minute)}))
 			sentPacket(ackElicitingPacket(&packet{PacketNumber: 3, SendTime: time.Now().Add(-30 * time.Minute)}))
@@ -984,7 +1002,7 @@ var _ = Describe("SentPacketHandler", func() {
 	Context("amplification limit, for the server, with validated address", func() {
 		JustBeforeEach(func() {
 			var rttStats utils.RTTStats
-			handler = newSentPacketHandler(42, protocol.InitialPacketSize, &rttStats, true, false, perspective, nil, utils.DefaultLogger)
+			handler = newSentPacketHandler(42, protocol.InitialPacketSize, &rttStats, true, false, true, perspective, nil, utils.DefaultLogger)
 		})
 
 		It("do not limits the window", func() {
@@ -1439,11 +1457,12 @@ var _ = Describe("SentPacketHandler", func() {
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 			cong.EXPECT().OnPacketAcked(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 			cong.EXPECT().MaybeExitSlowStart().AnyTimes()
+			cong.EXPECT().GetCongestionWindow().AnyTimes()
 			ecnHandler = NewMockECNHandler(mockCtrl)
 			lostPackets = nil
 			var rttStats utils.RTTStats
 			rttStats.UpdateRTT(time.Hour, 0, time.Now())
-			handler = newSentPacketHandler(42, protocol.InitialPacketSize, &rttStats, false, false, perspective, nil, utils.DefaultLogger)
+			handler = newSentPacketHandler(42, protocol.InitialPacketSize, &rttStats, false, false, true, perspective, nil, utils.DefaultLogger)
 			handler.ecnTracker = ecnHandler
 			handler.congestion = cong
 		})
@@ -42,6 +42,44 @@ func (m *MockSentPacketHandler) EXPECT() *MockSentPacketHandlerMockRecorder {
 	return m.recorder
 }
 
+// ConnectionStats mocks base method.
+func (m *MockSentPacketHandler) ConnectionStats() ackhandler.ConnectionStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnectionStats")
+	ret0, _ := ret[0].(ackhandler.ConnectionStats)
+	return ret0
+}
+
+// ConnectionStats indicates an expected call of ConnectionStats.
+func (mr *MockSentPacketHandlerMockRecorder) ConnectionStats() *MockSentPacketHandlerConnectionStatsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionStats", reflect.TypeOf((*MockSentPacketHandler)(nil).ConnectionStats))
+	return &MockSentPacketHandlerConnectionStatsCall{Call: call}
+}
+
+// MockSentPacketHandlerConnectionStatsCall wrap *gomock.Call
+type MockSentPacketHandlerConnectionStatsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockSentPacketHandlerConnectionStatsCall) Return(arg0 ackhandler.ConnectionStats) *MockSentPacketHandlerConnectionStatsCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockSentPacketHandlerConnectionStatsCall) Do(f func() ackhandler.ConnectionStats) *MockSentPacketHandlerConnectionStatsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockSentPacketHandlerConnectionStatsCall) DoAndReturn(f func() ackhandler.ConnectionStats) *MockSentPacketHandlerConnectionStatsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // DropPackets mocks base method.
 func (m *MockSentPacketHandler) DropPackets(arg0 protocol.EncryptionLevel) {
 	m.ctrl.T.Helper()
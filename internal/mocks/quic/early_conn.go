@@ -13,6 +13,7 @@ import (
 	context "context"
 	net "net"
 	reflect "reflect"
+	time "time"
 
 	quic "github.com/quic-go/quic-go"
 	qerr "github.com/quic-go/quic-go/internal/qerr"
@@ -196,6 +197,44 @@ func (c *MockEarlyConnectionConnectionStateCall) DoAndReturn(f func() quic.Conne
 	return c
 }
 
+// ConnectionStats mocks base method.
+func (m *MockEarlyConnection) ConnectionStats() quic.ConnectionStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnectionStats")
+	ret0, _ := ret[0].(quic.ConnectionStats)
+	return ret0
+}
+
+// ConnectionStats indicates an expected call of ConnectionStats.
+func (mr *MockEarlyConnectionMockRecorder) ConnectionStats() *MockEarlyConnectionConnectionStatsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionStats", reflect.TypeOf((*MockEarlyConnection)(nil).ConnectionStats))
+	return &MockEarlyConnectionConnectionStatsCall{Call: call}
+}
+
+// MockEarlyConnectionConnectionStatsCall wrap *gomock.Call
+type MockEarlyConnectionConnectionStatsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockEarlyConnectionConnectionStatsCall) Return(arg0 quic.ConnectionStats) *MockEarlyConnectionConnectionStatsCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockEarlyConnectionConnectionStatsCall) Do(f func() quic.ConnectionStats) *MockEarlyConnectionConnectionStatsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockEarlyConnectionConnectionStatsCall) DoAndReturn(f func() quic.ConnectionStats) *MockEarlyConnectionConnectionStatsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // Context mocks base method.
 func (m *MockEarlyConnection) Context() context.Context {
 	m.ctrl.T.Helper()
@@ -234,6 +273,44 @@ func (c *MockEarlyConnectionContextCall) DoAndReturn(f func() context.Context) *
 	return c
 }
 
+// DatagramQueueLen mocks base method.
+func (m *MockEarlyConnection) DatagramQueueLen() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DatagramQueueLen")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// DatagramQueueLen indicates an expected call of DatagramQueueLen.
+func (mr *MockEarlyConnectionMockRecorder) DatagramQueueLen() *MockEarlyConnectionDatagramQueueLenCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DatagramQueueLen", reflect.TypeOf((*MockEarlyConnection)(nil).DatagramQueueLen))
+	return &MockEarlyConnectionDatagramQueueLenCall{Call: call}
+}
+
+// MockEarlyConnectionDatagramQueueLenCall wrap *gomock.Call
+type MockEarlyConnectionDatagramQueueLenCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockEarlyConnectionDatagramQueueLenCall) Return(arg0 int) *MockEarlyConnectionDatagramQueueLenCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockEarlyConnectionDatagramQueueLenCall) Do(f func() int) *MockEarlyConnectionDatagramQueueLenCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockEarlyConnectionDatagramQueueLenCall) DoAndReturn(f func() int) *MockEarlyConnectionDatagramQueueLenCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // HandshakeComplete mocks base method.
 func (m *MockEarlyConnection) HandshakeComplete() <-chan struct{} {
 	m.ctrl.T.Helper()
@@ -505,6 +582,45 @@ func (c *MockEarlyConnectionOpenUniStreamSyncCall) DoAndReturn(f func(context.Co
 	return c
 }
 
+// Ping mocks base method.
+func (m *MockEarlyConnection) Ping(arg0 context.Context) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", arg0)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockEarlyConnectionMockRecorder) Ping(arg0 any) *MockEarlyConnectionPingCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockEarlyConnection)(nil).Ping), arg0)
+	return &MockEarlyConnectionPingCall{Call: call}
+}
+
+// MockEarlyConnectionPingCall wrap *gomock.Call
+type MockEarlyConnectionPingCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockEarlyConnectionPingCall) Return(arg0 time.Duration, arg1 error) *MockEarlyConnectionPingCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockEarlyConnectionPingCall) Do(f func(context.Context) (time.Duration, error)) *MockEarlyConnectionPingCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockEarlyConnectionPingCall) DoAndReturn(f func(context.Context) (time.Duration, error)) *MockEarlyConnectionPingCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // ReceiveDatagram mocks base method.
 func (m *MockEarlyConnection) ReceiveDatagram(arg0 context.Context) ([]byte, error) {
 	m.ctrl.T.Helper()
@@ -619,3 +735,41 @@ func (c *MockEarlyConnectionSendDatagramCall) DoAndReturn(f func([]byte) error)
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
+
+// TrySendDatagram mocks base method.
+func (m *MockEarlyConnection) TrySendDatagram(arg0 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrySendDatagram", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TrySendDatagram indicates an expected call of TrySendDatagram.
+func (mr *MockEarlyConnectionMockRecorder) TrySendDatagram(arg0 any) *MockEarlyConnectionTrySendDatagramCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrySendDatagram", reflect.TypeOf((*MockEarlyConnection)(nil).TrySendDatagram), arg0)
+	return &MockEarlyConnectionTrySendDatagramCall{Call: call}
+}
+
+// MockEarlyConnectionTrySendDatagramCall wrap *gomock.Call
+type MockEarlyConnectionTrySendDatagramCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockEarlyConnectionTrySendDatagramCall) Return(arg0 error) *MockEarlyConnectionTrySendDatagramCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockEarlyConnectionTrySendDatagramCall) Do(f func([]byte) error) *MockEarlyConnectionTrySendDatagramCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockEarlyConnectionTrySendDatagramCall) DoAndReturn(f func([]byte) error) *MockEarlyConnectionTrySendDatagramCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
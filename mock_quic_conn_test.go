@@ -13,6 +13,7 @@ import (
 	context "context"
 	net "net"
 	reflect "reflect"
+	time "time"
 
 	qerr "github.com/quic-go/quic-go/internal/qerr"
 	gomock "go.uber.org/mock/gomock"
@@ -195,6 +196,44 @@ func (c *MockQUICConnConnectionStateCall) DoAndReturn(f func() ConnectionState)
 	return c
 }
 
+// ConnectionStats mocks base method.
+func (m *MockQUICConn) ConnectionStats() ConnectionStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnectionStats")
+	ret0, _ := ret[0].(ConnectionStats)
+	return ret0
+}
+
+// ConnectionStats indicates an expected call of ConnectionStats.
+func (mr *MockQUICConnMockRecorder) ConnectionStats() *MockQUICConnConnectionStatsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionStats", reflect.TypeOf((*MockQUICConn)(nil).ConnectionStats))
+	return &MockQUICConnConnectionStatsCall{Call: call}
+}
+
+// MockQUICConnConnectionStatsCall wrap *gomock.Call
+type MockQUICConnConnectionStatsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockQUICConnConnectionStatsCall) Return(arg0 ConnectionStats) *MockQUICConnConnectionStatsCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockQUICConnConnectionStatsCall) Do(f func() ConnectionStats) *MockQUICConnConnectionStatsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockQUICConnConnectionStatsCall) DoAndReturn(f func() ConnectionStats) *MockQUICConnConnectionStatsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // Context mocks base method.
 func (m *MockQUICConn) Context() context.Context {
 	m.ctrl.T.Helper()
@@ -233,6 +272,44 @@ func (c *MockQUICConnContextCall) DoAndReturn(f func() context.Context) *MockQUI
 	return c
 }
 
+// DatagramQueueLen mocks base method.
+func (m *MockQUICConn) DatagramQueueLen() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DatagramQueueLen")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// DatagramQueueLen indicates an expected call of DatagramQueueLen.
+func (mr *MockQUICConnMockRecorder) DatagramQueueLen() *MockQUICConnDatagramQueueLenCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DatagramQueueLen", reflect.TypeOf((*MockQUICConn)(nil).DatagramQueueLen))
+	return &MockQUICConnDatagramQueueLenCall{Call: call}
+}
+
+// MockQUICConnDatagramQueueLenCall wrap *gomock.Call
+type MockQUICConnDatagramQueueLenCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockQUICConnDatagramQueueLenCall) Return(arg0 int) *MockQUICConnDatagramQueueLenCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockQUICConnDatagramQueueLenCall) Do(f func() int) *MockQUICConnDatagramQueueLenCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockQUICConnDatagramQueueLenCall) DoAndReturn(f func() int) *MockQUICConnDatagramQueueLenCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // HandshakeComplete mocks base method.
 func (m *MockQUICConn) HandshakeComplete() <-chan struct{} {
 	m.ctrl.T.Helper()
@@ -504,6 +581,45 @@ func (c *MockQUICConnOpenUniStreamSyncCall) DoAndReturn(f func(context.Context)
 	return c
 }
 
+// Ping mocks base method.
+func (m *MockQUICConn) Ping(arg0 context.Context) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", arg0)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockQUICConnMockRecorder) Ping(arg0 any) *MockQUICConnPingCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockQUICConn)(nil).Ping), arg0)
+	return &MockQUICConnPingCall{Call: call}
+}
+
+// MockQUICConnPingCall wrap *gomock.Call
+type MockQUICConnPingCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockQUICConnPingCall) Return(arg0 time.Duration, arg1 error) *MockQUICConnPingCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockQUICConnPingCall) Do(f func(context.Context) (time.Duration, error)) *MockQUICConnPingCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockQUICConnPingCall) DoAndReturn(f func(context.Context) (time.Duration, error)) *MockQUICConnPingCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // ReceiveDatagram mocks base method.
 func (m *MockQUICConn) ReceiveDatagram(arg0 context.Context) ([]byte, error) {
 	m.ctrl.T.Helper()
@@ -619,6 +735,44 @@ func (c *MockQUICConnSendDatagramCall) DoAndReturn(f func([]byte) error) *MockQU
 	return c
 }
 
+// TrySendDatagram mocks base method.
+func (m *MockQUICConn) TrySendDatagram(arg0 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrySendDatagram", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TrySendDatagram indicates an expected call of TrySendDatagram.
+func (mr *MockQUICConnMockRecorder) TrySendDatagram(arg0 any) *MockQUICConnTrySendDatagramCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrySendDatagram", reflect.TypeOf((*MockQUICConn)(nil).TrySendDatagram), arg0)
+	return &MockQUICConnTrySendDatagramCall{Call: call}
+}
+
+// MockQUICConnTrySendDatagramCall wrap *gomock.Call
+type MockQUICConnTrySendDatagramCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockQUICConnTrySendDatagramCall) Return(arg0 error) *MockQUICConnTrySendDatagramCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockQUICConnTrySendDatagramCall) Do(f func([]byte) error) *MockQUICConnTrySendDatagramCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockQUICConnTrySendDatagramCall) DoAndReturn(f func([]byte) error) *MockQUICConnTrySendDatagramCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // closeWithTransportError mocks base method.
 func (m *MockQUICConn) closeWithTransportError(arg0 qerr.TransportErrorCode) {
 	m.ctrl.T.Helper()
@@ -15,6 +15,7 @@ var _ Reader = &bytes.Reader{}
 
 type byteReader struct {
 	io.Reader
+	buf [1]byte // avoids allocating a buffer for every ReadByte call
 }
 
 var _ Reader = &byteReader{}
@@ -26,16 +27,15 @@ func NewReader(r io.Reader) Reader {
 	if r, ok := r.(Reader); ok {
 		return r
 	}
-	return &byteReader{r}
+	return &byteReader{Reader: r}
 }
 
 func (r *byteReader) ReadByte() (byte, error) {
-	var b [1]byte
-	n, err := r.Reader.Read(b[:])
+	n, err := r.Reader.Read(r.buf[:])
 	if n == 1 && err == io.EOF {
 		err = nil
 	}
-	return b[0], err
+	return r.buf[0], err
 }
 
 // Writer implements both the io.ByteWriter and io.Writer interfaces.